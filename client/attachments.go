@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+)
+
+const chunkSize = 32 << 10
+
+// attachmentCommand runs the /upload <path> and /download <attachment id>
+// commands. It reports whether text was one of them and, for a successful
+// upload, returns the attachment to send.
+func attachmentCommand(ctx context.Context, client pb.ChatServerClient, text string) (*pb.Attachment, bool) {
+	command, arg, _ := strings.Cut(text, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch command {
+	case "/upload":
+		attachment, err := uploadAttachment(ctx, client, arg)
+		if err != nil {
+			log.Printf("Failed to upload %s: %v", arg, err)
+			return nil, true
+		}
+		log.Printf("Uploaded %s as attachment %s", attachment.Filename, attachment.Id)
+		return attachment, true
+	case "/download":
+		path, err := downloadAttachment(ctx, client, arg)
+		if err != nil {
+			log.Printf("Failed to download attachment %s: %v", arg, err)
+			return nil, true
+		}
+		log.Printf("Downloaded attachment to %s", path)
+		return nil, true
+	}
+	return nil, false
+}
+
+func uploadAttachment(ctx context.Context, client pb.ChatServerClient, path string) (*pb.Attachment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	stream, err := client.UploadAttachment(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&pb.UploadAttachmentRequest{
+		Data: &pb.UploadAttachmentRequest_Info{Info: &pb.Attachment{
+			Filename:    filepath.Base(path),
+			ContentType: mime.TypeByExtension(filepath.Ext(path)),
+			Size:        size,
+			Sha256:      hex.EncodeToString(hash.Sum(nil)),
+		}},
+	}); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&pb.UploadAttachmentRequest{
+				Data: &pb.UploadAttachmentRequest_Chunk{Chunk: buf[:n]},
+			}); err != nil {
+				// The server aborted the upload, CloseAndRecv returns why
+				break
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Attachment, nil
+}
+
+// downloadAttachment saves an attachment in the current directory under its
+// original filename and returns the path it was written to.
+func downloadAttachment(ctx context.Context, client pb.ChatServerClient, attachmentID string) (string, error) {
+	stream, err := client.DownloadAttachment(ctx, &pb.DownloadAttachmentRequest{AttachmentId: attachmentID})
+	if err != nil {
+		return "", err
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		return "", err
+	}
+	info := first.GetInfo()
+	if info == nil {
+		return "", fmt.Errorf("missing attachment info")
+	}
+
+	path := filepath.Base(info.Filename)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	w := io.MultiWriter(f, hash)
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		if _, err := w.Write(resp.GetChunk()); err != nil {
+			os.Remove(path)
+			return "", err
+		}
+	}
+
+	checksum, _ := hex.DecodeString(info.Sha256)
+	if !bytes.Equal(hash.Sum(nil), checksum) {
+		os.Remove(path)
+		return "", fmt.Errorf("checksum mismatch")
+	}
+	return path, nil
+}
@@ -3,26 +3,94 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	pb "github.com/Melo04/grpc-chat/pb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// clusterServiceConfig makes the client stick to the first reachable node of
+// a cluster and retry calls that fail because a node went away.
+const clusterServiceConfig = `{
+	"loadBalancingConfig": [{"pick_first": {}}],
+	"methodConfig": [{
+		"name": [{"service": "pb.ChatServer"}],
+		"retryPolicy": {
+			"maxAttempts": 5,
+			"initialBackoff": "0.2s",
+			"maxBackoff": "2s",
+			"backoffMultiplier": 2,
+			"retryableStatusCodes": ["UNAVAILABLE"]
+		}
+	}]
+}`
+
 var (
-	serverAddr = flag.String("addr", "localhost:50051", "The server address in the format of host:port")
+	serverAddr = flag.String("addr", "localhost:50051", "The server address in the format of host:port, or a comma-separated list of the nodes of a cluster")
 	username   = flag.String("username", "", "username for login")
 	password   = flag.String("password", "", "password for login")
+
+	useTLS        = flag.Bool("tls", false, "Connect over TLS, verifying the server with the system roots unless -tls-ca is given")
+	tlsCA         = flag.String("tls-ca", "", "PEM bundle of the CAs to verify the server with, implies -tls")
+	tlsCert       = flag.String("tls-cert", "", "PEM client certificate file for servers requiring mutual TLS, implies -tls")
+	tlsKey        = flag.String("tls-key", "", "PEM private key file of -tls-cert")
+	tlsServerName = flag.String("tls-server-name", "", "The name to verify the server certificate against, by default the host of -addr")
 )
 
+// transportCredentials returns the credentials for connecting to the server
+// as set by the TLS flags.
+func transportCredentials() (credentials.TransportCredentials, error) {
+	if !*useTLS && *tlsCA == "" && *tlsCert == "" {
+		return insecure.NewCredentials(), nil
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return nil, fmt.Errorf("-tls-cert and -tls-key go together")
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: *tlsServerName,
+	}
+	if *tlsCA != "" {
+		data, err := os.ReadFile(*tlsCA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", *tlsCA)
+		}
+	}
+	if *tlsCert != "" {
+		if _, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey); err != nil {
+			return nil, err
+		}
+		// The files are read again on every handshake, so reconnecting
+		// picks up a renewed certificate
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+			return &cert, err
+		}
+	}
+	return credentials.NewTLS(config), nil
+}
+
 var serverIDMap = make(map[string]string)
 
 func createChatServer(ctx context.Context, client pb.ChatServerClient, serverName string) string {
@@ -77,6 +145,7 @@ func listMessages(ctx context.Context, client pb.ChatServerClient, serverID, cha
 		log.Fatalf("Failed to list messages: Server does not exist")
 	}
 
+	var lastMessageID string
 	for {
 		msg, err := stream.Recv()
 		if err == io.EOF {
@@ -85,7 +154,22 @@ func listMessages(ctx context.Context, client pb.ChatServerClient, serverID, cha
 		if err != nil {
 			log.Fatalf("Failed to list messages: Channel does not exist")
 		}
-		log.Printf("Message from %s: %s", msg.Username, msg.Text)
+		log.Printf("Message from %s: %s (id %s)", msg.Username, msg.Text, msg.Id)
+		for _, attachment := range msg.Attachments {
+			log.Printf("Attachment %s: %s (%d bytes)", attachment.Id, attachment.Filename, attachment.Size)
+		}
+		lastMessageID = msg.Id
+	}
+
+	if lastMessageID == "" {
+		return
+	}
+	if _, err := client.MarkRead(ctx, &pb.MarkReadRequest{
+		ServerId:      serverID,
+		ChannelId:     channelId,
+		UpToMessageId: lastMessageID,
+	}); err != nil {
+		log.Printf("Failed to mark channel as read: %v", err)
 	}
 }
 
@@ -93,17 +177,62 @@ func getServerIDByName(serverName string) string {
 	return serverIDMap[serverName]
 }
 
-func sendMessages(ctx context.Context, client pb.ChatServerClient, serverID, channelID, username, text string) {
+// getChannelIDByName looks up a channel of the chat server by name. Channels
+// that were never created are addressed by their name.
+func getChannelIDByName(ctx context.Context, client pb.ChatServerClient, serverID, channelName string) string {
+	resp, err := client.ListChannels(ctx, &pb.ListChannelsRequest{ServerId: serverID})
+	if err != nil {
+		return channelName
+	}
+	for _, channel := range resp.Channels {
+		if channel.Name == channelName {
+			return channel.Id
+		}
+	}
+	return channelName
+}
+
+func listChannels(ctx context.Context, client pb.ChatServerClient, serverID string) {
+	resp, err := client.ListChannels(ctx, &pb.ListChannelsRequest{ServerId: serverID})
+	if err != nil {
+		log.Fatalf("Failed to list channels: %v", err)
+	}
+	for _, channel := range resp.Channels {
+		if channel.Topic != "" {
+			log.Printf("#%s - %s (%d unread, %d mentions)", channel.Name, channel.Topic, channel.UnreadCount, channel.MentionCount)
+			continue
+		}
+		log.Printf("#%s (%d unread, %d mentions)", channel.Name, channel.UnreadCount, channel.MentionCount)
+	}
+}
+
+func unreadSummary(ctx context.Context, client pb.ChatServerClient) {
+	resp, err := client.GetUnreadSummary(ctx, &pb.GetUnreadSummaryRequest{})
+	if err != nil {
+		log.Fatalf("Failed to get unread summary: %v", err)
+	}
+	log.Printf("%d unread messages, %d mentions", resp.UnreadCount, resp.MentionCount)
+	for _, server := range resp.Servers {
+		// Remember the servers so they can be addressed by name
+		serverIDMap[server.ServerName] = server.ServerId
+		for _, channel := range server.Channels {
+			log.Printf("%s #%s: %d unread, %d mentions", server.ServerName, channel.Name, channel.UnreadCount, channel.MentionCount)
+		}
+	}
+}
+
+func sendMessages(ctx context.Context, client pb.ChatServerClient, serverID, channelID, username, text string, attachmentIDs []string) {
 	stream, err := client.SendMessages(ctx)
 	if err != nil {
 		log.Fatalf("Failed to create stream: %v", err)
 	}
 
 	if err := stream.Send(&pb.SendMessageRequest{
-		ServerId:  serverID,
-		ChannelId: channelID,
-		Username:  username,
-		Text:      text,
+		ServerId:      serverID,
+		ChannelId:     channelID,
+		Username:      username,
+		Text:          text,
+		AttachmentIds: attachmentIDs,
 	}); err != nil {
 		log.Fatalf("failed to send message: %v", err)
 	}
@@ -121,6 +250,15 @@ func chat(ctx context.Context, client pb.ChatServerClient, serverID, channelID,
 		log.Fatalf("failed to start chat: %v", err)
 	}
 
+	// An empty frame starts receiving the channel without posting anything
+	if err := stream.Send(&pb.ChatMessage{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Username:  username,
+	}); err != nil {
+		log.Fatalf("failed to join channel: %v", err)
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 
@@ -131,18 +269,30 @@ func chat(ctx context.Context, client pb.ChatServerClient, serverID, channelID,
 		defer wg.Done()
 		scanner := bufio.NewScanner(os.Stdin)
 		for {
-			fmt.Print("Enter message (enter q to stop): ")
+			fmt.Print("Enter message (enter q to stop, /upload <file>, /download <id>, /ttl <seconds> <text> or /whisper <user> <text>): ")
 			scanner.Scan()
 			text := scanner.Text()
 			if text == "q" {
 				close(quitChan)
 				break
 			}
+			text, ttl, visibleTo := messageOptions(text)
+			var attachmentIDs []string
+			if attachment, ok := attachmentCommand(ctx, client, text); ok {
+				if attachment == nil {
+					continue
+				}
+				text = ""
+				attachmentIDs = []string{attachment.Id}
+			}
 			if err := stream.Send(&pb.ChatMessage{
-				ServerId:  serverID,
-				ChannelId: channelID,
-				Username:  username,
-				Text:      text,
+				ServerId:      serverID,
+				ChannelId:     channelID,
+				Username:      username,
+				Text:          text,
+				AttachmentIds: attachmentIDs,
+				TtlSeconds:    ttl,
+				VisibleTo:     visibleTo,
 			}); err != nil {
 				log.Fatalf("failed to send message: %v", err)
 			}
@@ -170,15 +320,474 @@ func chat(ctx context.Context, client pb.ChatServerClient, serverID, channelID,
 				if err != nil {
 					log.Fatalf("error receiving message: %v", err)
 				}
-				log.Printf("Message received from %s: %s", msg.Username, msg.Text)
+				if msg.Typing {
+					if msg.Username != username {
+						log.Printf("%s is typing...", msg.Username)
+					}
+					continue
+				}
+				if msg.Text == "" && len(msg.AttachmentIds) == 0 {
+					continue
+				}
+				if msg.IsBot {
+					msg.Username += " [bot]"
+				}
+				switch {
+				case msg.VisibleTo != "":
+					log.Printf("Message received from %s (only visible to %s): %s", msg.Username, msg.VisibleTo, msg.Text)
+				case msg.TtlSeconds > 0:
+					log.Printf("Message received from %s (disappears after %ds): %s", msg.Username, msg.TtlSeconds, msg.Text)
+				default:
+					log.Printf("Message received from %s: %s", msg.Username, msg.Text)
+				}
+				for _, id := range msg.AttachmentIds {
+					log.Printf("Attachment %s (enter /download %s to save it)", id, id)
+				}
 			}
-			
+
 		}
 	}()
 
 	wg.Wait()
 }
 
+// messageOptions strips a leading /ttl <seconds> or /whisper <user> from a
+// chat message and returns the options it sets.
+func messageOptions(text string) (string, int64, string) {
+	command, rest, _ := strings.Cut(text, " ")
+	arg, rest, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	switch command {
+	case "/ttl":
+		ttl, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			log.Printf("Invalid ttl %q, sending a regular message", arg)
+			return rest, 0, ""
+		}
+		return rest, ttl, ""
+	case "/whisper":
+		return rest, 0, arg
+	}
+	return text, 0, ""
+}
+
+func subscribe(ctx context.Context, client pb.ChatServerClient, serverID string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.Subscribe(ctx, &pb.SubscribeRequest{ServerId: serverID})
+	if err != nil {
+		log.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	go func() {
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			printEvent(event)
+		}
+	}()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Println("Listening for server events (enter q to stop): ")
+		scanner.Scan()
+		if scanner.Text() == "q" {
+			return
+		}
+	}
+}
+
+func listMembers(ctx context.Context, client pb.ChatServerClient, serverID string) {
+	resp, err := client.ListMembers(ctx, &pb.ListMembersRequest{ServerId: serverID})
+	if err != nil {
+		log.Fatalf("Failed to list members: %v", err)
+	}
+	for _, member := range resp.Members {
+		if member.CustomStatus != "" {
+			log.Printf("%s [%s] (%s): %s", member.Username, member.Role, member.Presence, member.CustomStatus)
+			continue
+		}
+		log.Printf("%s [%s] (%s)", member.Username, member.Role, member.Presence)
+	}
+}
+
+func setRole(ctx context.Context, client pb.ChatServerClient, serverID, member, role string) {
+	if _, err := client.SetRole(ctx, &pb.SetRoleRequest{
+		ServerId: serverID,
+		Username: member,
+		Role:     role,
+	}); err != nil {
+		log.Printf("Failed to set role: %v", err)
+		return
+	}
+	log.Printf("%s is now %s", member, role)
+}
+
+func searchMessages(ctx context.Context, client pb.ChatServerClient, scanner *bufio.Scanner, query string) {
+	var pageToken string
+	for {
+		resp, err := client.SearchMessages(ctx, &pb.SearchMessagesRequest{
+			Query:     query,
+			PageToken: pageToken,
+		})
+		if err != nil {
+			log.Printf("Failed to search messages: %v", err)
+			return
+		}
+		if resp.TotalCount == 0 {
+			log.Printf("No messages found")
+			return
+		}
+		for _, result := range resp.Results {
+			log.Printf("%s: %s", result.Message.GetUsername(), result.Snippet)
+		}
+
+		pageToken = resp.NextPageToken
+		if pageToken == "" {
+			return
+		}
+		fmt.Printf("%d results, enter n for the next page: ", resp.TotalCount)
+		scanner.Scan()
+		if scanner.Text() != "n" {
+			return
+		}
+	}
+}
+
+func pinMessage(ctx context.Context, client pb.ChatServerClient, serverID, channelID, messageID string, pin bool) {
+	var err error
+	if pin {
+		_, err = client.PinMessage(ctx, &pb.PinMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: messageID})
+	} else {
+		_, err = client.UnpinMessage(ctx, &pb.UnpinMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: messageID})
+	}
+	if err != nil {
+		log.Printf("Failed to update pin: %v", err)
+		return
+	}
+	log.Printf("Pins updated")
+}
+
+func listPins(ctx context.Context, client pb.ChatServerClient, serverID, channelID string) {
+	resp, err := client.ListPins(ctx, &pb.ListPinsRequest{ServerId: serverID, ChannelId: channelID})
+	if err != nil {
+		log.Fatalf("Failed to list pins: %v", err)
+	}
+	for _, pin := range resp.Pins {
+		log.Printf("%s: %s (pinned by %s)", pin.Message.GetUsername(), pin.Message.GetText(), pin.PinnedBy)
+	}
+}
+
+func saveMessage(ctx context.Context, client pb.ChatServerClient, serverID, channelID, messageID string) {
+	if _, err := client.SaveMessage(ctx, &pb.SaveMessageRequest{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		MessageId: messageID,
+	}); err != nil {
+		log.Printf("Failed to save message: %v", err)
+		return
+	}
+	log.Printf("Message saved")
+}
+
+func listSaved(ctx context.Context, client pb.ChatServerClient) {
+	resp, err := client.ListSaved(ctx, &pb.ListSavedRequest{})
+	if err != nil {
+		log.Fatalf("Failed to list saved messages: %v", err)
+	}
+	for _, saved := range resp.Messages {
+		log.Printf("%s: %s (id %s)", saved.Message.GetUsername(), saved.Message.GetText(), saved.Message.GetId())
+	}
+}
+
+func scheduleMessage(ctx context.Context, client pb.ChatServerClient, serverID, channelID, sendAt, text string) {
+	at, err := time.Parse(time.RFC3339, sendAt)
+	if err != nil {
+		d, durErr := time.ParseDuration(sendAt)
+		if durErr != nil {
+			fmt.Println("Please enter a valid delay or time")
+			return
+		}
+		at = time.Now().Add(d)
+	}
+
+	resp, err := client.ScheduleMessage(ctx, &pb.ScheduleMessageRequest{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Text:      text,
+		SendAt:    timestamppb.New(at),
+	})
+	if err != nil {
+		log.Printf("Failed to schedule message: %v", err)
+		return
+	}
+	log.Printf("Message %s scheduled for %s", resp.Scheduled.Id, resp.Scheduled.SendAt.AsTime().Local().Format(time.RFC1123))
+}
+
+func listScheduled(ctx context.Context, client pb.ChatServerClient) {
+	resp, err := client.ListScheduled(ctx, &pb.ListScheduledRequest{})
+	if err != nil {
+		log.Fatalf("Failed to list scheduled messages: %v", err)
+	}
+	for _, scheduled := range resp.Scheduled {
+		log.Printf("%s: %s (id %s)", scheduled.SendAt.AsTime().Local().Format(time.RFC1123), scheduled.Text, scheduled.Id)
+	}
+}
+
+func cancelScheduled(ctx context.Context, client pb.ChatServerClient, id string) {
+	if _, err := client.CancelScheduled(ctx, &pb.CancelScheduledRequest{Id: id}); err != nil {
+		log.Printf("Failed to cancel scheduled message: %v", err)
+		return
+	}
+	log.Printf("Scheduled message %s cancelled", id)
+}
+
+func createBot(ctx context.Context, client pb.ChatServerClient, name string) {
+	resp, err := client.CreateBot(ctx, &pb.CreateBotRequest{Name: name})
+	if err != nil {
+		log.Printf("Failed to create bot: %v", err)
+		return
+	}
+	log.Printf("Bot %s created, its API key is %s (it will not be shown again)", resp.Bot.Name, resp.ApiKey)
+}
+
+func listBots(ctx context.Context, client pb.ChatServerClient) {
+	resp, err := client.ListBots(ctx, &pb.ListBotsRequest{})
+	if err != nil {
+		log.Fatalf("Failed to list bots: %v", err)
+	}
+	for _, bot := range resp.Bots {
+		log.Printf("%s (created %s)", bot.Name, bot.CreatedAt.AsTime().Local().Format(time.RFC1123))
+	}
+}
+
+func deleteBot(ctx context.Context, client pb.ChatServerClient, name string) {
+	if _, err := client.DeleteBot(ctx, &pb.DeleteBotRequest{Name: name}); err != nil {
+		log.Printf("Failed to delete bot: %v", err)
+		return
+	}
+	log.Printf("Bot %s deleted", name)
+}
+
+func createWebhook(ctx context.Context, client pb.ChatServerClient, serverID, channelID, url string) {
+	resp, err := client.CreateWebhook(ctx, &pb.CreateWebhookRequest{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Url:       url,
+	})
+	if err != nil {
+		log.Printf("Failed to create webhook: %v", err)
+		return
+	}
+	log.Printf("Webhook %s created, its signing secret is %s (it will not be shown again)", resp.Webhook.Id, resp.Secret)
+}
+
+func listWebhooks(ctx context.Context, client pb.ChatServerClient, serverID string) {
+	resp, err := client.ListWebhooks(ctx, &pb.ListWebhooksRequest{ServerId: serverID})
+	if err != nil {
+		log.Printf("Failed to list webhooks: %v", err)
+		return
+	}
+	for _, webhook := range resp.Webhooks {
+		log.Printf("%s -> %s (created by %s)", webhook.Id, webhook.Url, webhook.CreatedBy)
+	}
+}
+
+func deleteWebhook(ctx context.Context, client pb.ChatServerClient, serverID, webhookID string) {
+	if _, err := client.DeleteWebhook(ctx, &pb.DeleteWebhookRequest{ServerId: serverID, WebhookId: webhookID}); err != nil {
+		log.Printf("Failed to delete webhook: %v", err)
+		return
+	}
+	log.Printf("Webhook %s deleted", webhookID)
+}
+
+func listWebhookDeliveries(ctx context.Context, client pb.ChatServerClient, serverID, webhookID string, deadLetters bool) {
+	resp, err := client.ListWebhookDeliveries(ctx, &pb.ListWebhookDeliveriesRequest{
+		ServerId:    serverID,
+		WebhookId:   webhookID,
+		DeadLetters: deadLetters,
+	})
+	if err != nil {
+		log.Printf("Failed to list webhook deliveries: %v", err)
+		return
+	}
+	for _, delivery := range resp.Deliveries {
+		log.Printf("%s %s: %s after %d attempts %s", delivery.CreatedAt.AsTime().Local().Format(time.RFC1123), delivery.EventType, delivery.Status, delivery.Attempts, delivery.LastError)
+	}
+}
+
+func createIncomingWebhook(ctx context.Context, client pb.ChatServerClient, serverID, channelID, name string) {
+	resp, err := client.CreateIncomingWebhook(ctx, &pb.CreateIncomingWebhookRequest{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Name:      name,
+	})
+	if err != nil {
+		log.Printf("Failed to create incoming webhook: %v", err)
+		return
+	}
+	log.Printf("Incoming webhook %s created, POST {\"text\": \"...\"} to %s on the HTTP port of the server (it will not be shown again)", resp.Webhook.Id, resp.Path)
+}
+
+func listIncomingWebhooks(ctx context.Context, client pb.ChatServerClient, serverID string) {
+	resp, err := client.ListIncomingWebhooks(ctx, &pb.ListIncomingWebhooksRequest{ServerId: serverID})
+	if err != nil {
+		log.Printf("Failed to list incoming webhooks: %v", err)
+		return
+	}
+	for _, webhook := range resp.Webhooks {
+		log.Printf("%s posts as %s (created by %s)", webhook.Id, webhook.Name, webhook.CreatedBy)
+	}
+}
+
+func deleteIncomingWebhook(ctx context.Context, client pb.ChatServerClient, serverID, webhookID string) {
+	if _, err := client.DeleteIncomingWebhook(ctx, &pb.DeleteIncomingWebhookRequest{ServerId: serverID, WebhookId: webhookID}); err != nil {
+		log.Printf("Failed to delete incoming webhook: %v", err)
+		return
+	}
+	log.Printf("Incoming webhook %s deleted", webhookID)
+}
+
+func linkChannel(ctx context.Context, client pb.ChatServerClient, serverID, channelID, peer, link string) {
+	resp, err := client.LinkChannel(ctx, &pb.LinkChannelRequest{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Peer:      peer,
+		Link:      link,
+	})
+	if err != nil {
+		log.Printf("Failed to link channel: %v", err)
+		return
+	}
+	log.Printf("Channel linked with %s as %s, link it on %s under the same name", resp.Link.Peer, resp.Link.Link, resp.Link.Peer)
+}
+
+func listChannelLinks(ctx context.Context, client pb.ChatServerClient, serverID string) {
+	resp, err := client.ListChannelLinks(ctx, &pb.ListChannelLinksRequest{ServerId: serverID})
+	if err != nil {
+		log.Printf("Failed to list channel links: %v", err)
+		return
+	}
+	for _, link := range resp.Links {
+		log.Printf("%s links channel %s with %s (created by %s)", link.Link, link.ChannelId, link.Peer, link.CreatedBy)
+	}
+}
+
+func unlinkChannel(ctx context.Context, client pb.ChatServerClient, serverID, peer, link string) {
+	if _, err := client.UnlinkChannel(ctx, &pb.UnlinkChannelRequest{ServerId: serverID, Peer: peer, Link: link}); err != nil {
+		log.Printf("Failed to unlink channel: %v", err)
+		return
+	}
+	log.Printf("Link %s with %s removed", link, peer)
+}
+
+func setRetention(ctx context.Context, client pb.ChatServerClient, serverID, channelID, maxAge, maxCount, legalHold string) {
+	policy := &pb.RetentionPolicy{LegalHold: legalHold == "y"}
+	if maxAge != "" {
+		d, err := time.ParseDuration(maxAge)
+		if err != nil {
+			fmt.Println("Please enter a valid duration, for example 720h")
+			return
+		}
+		policy.MaxAgeSeconds = int64(d.Seconds())
+	}
+	if maxCount != "" {
+		n, err := strconv.Atoi(maxCount)
+		if err != nil {
+			fmt.Println("Please enter a valid integer")
+			return
+		}
+		policy.MaxCount = int32(n)
+	}
+
+	resp, err := client.UpdateChannel(ctx, &pb.UpdateChannelRequest{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Retention: policy,
+	})
+	if err != nil {
+		log.Printf("Failed to update channel: %v", err)
+		return
+	}
+	log.Printf("#%s now keeps messages for %ds, at most %d messages, legal hold %t",
+		resp.Channel.Name, resp.Channel.Retention.GetMaxAgeSeconds(), resp.Channel.Retention.GetMaxCount(), resp.Channel.Retention.GetLegalHold())
+}
+
+// showNotifications prints the notification inbox and clears it.
+func showNotifications(ctx context.Context, client pb.ChatServerClient) {
+	resp, err := client.ListNotifications(ctx, &pb.ListNotificationsRequest{})
+	if err != nil {
+		log.Fatalf("Failed to list notifications: %v", err)
+	}
+	if len(resp.Notifications) == 0 {
+		log.Printf("No new notifications")
+	}
+	for _, notification := range resp.Notifications {
+		log.Printf("%s mentioned you: %s", notification.Message.GetUsername(), notification.Message.GetText())
+		if _, err := client.AckNotification(ctx, &pb.AckNotificationRequest{NotificationId: notification.Id}); err != nil {
+			log.Printf("Failed to acknowledge notification: %v", err)
+		}
+	}
+}
+
+func setStatus(ctx context.Context, client pb.ChatServerClient, status, customStatus string) {
+	presence, ok := pb.Presence_value[strings.ToUpper(status)]
+	if !ok {
+		fmt.Println("Status must be one of online, idle, do_not_disturb or invisible")
+		return
+	}
+	if _, err := client.SetStatus(ctx, &pb.SetStatusRequest{
+		Presence:     pb.Presence(presence),
+		CustomStatus: customStatus,
+	}); err != nil {
+		log.Fatalf("Failed to set status: %v", err)
+	}
+	log.Printf("Status set to %s", pb.Presence(presence))
+}
+
+func printEvent(event *pb.Event) {
+	switch p := event.Payload.(type) {
+	case *pb.Event_MessageCreated:
+		log.Printf("[%s] %s: %s", p.MessageCreated.ChannelId, p.MessageCreated.Message.GetUsername(), p.MessageCreated.Message.GetText())
+	case *pb.Event_MessageEdited:
+		log.Printf("[%s] %s edited: %s", p.MessageEdited.ChannelId, p.MessageEdited.Message.GetUsername(), p.MessageEdited.Message.GetText())
+	case *pb.Event_MessageDeleted:
+		log.Printf("[%s] message %s deleted", p.MessageDeleted.ChannelId, p.MessageDeleted.MessageId)
+	case *pb.Event_MessageExpired:
+		log.Printf("[%s] message %s expired", p.MessageExpired.ChannelId, p.MessageExpired.MessageId)
+	case *pb.Event_MemberJoined:
+		if p.MemberJoined.InvitedBy != "" {
+			log.Printf("%s was invited by %s", p.MemberJoined.Username, p.MemberJoined.InvitedBy)
+			break
+		}
+		log.Printf("%s joined the server", p.MemberJoined.Username)
+	case *pb.Event_MemberLeft:
+		if p.MemberLeft.KickedBy != "" {
+			log.Printf("%s was kicked by %s", p.MemberLeft.Username, p.MemberLeft.KickedBy)
+			break
+		}
+		log.Printf("%s left the server", p.MemberLeft.Username)
+	case *pb.Event_ChannelCreated:
+		log.Printf("Channel %s created", p.ChannelCreated.ChannelName)
+	case *pb.Event_ChannelRenamed:
+		log.Printf("Channel %s renamed to %s", p.ChannelRenamed.ChannelId, p.ChannelRenamed.ChannelName)
+	case *pb.Event_ChannelTopicChanged:
+		log.Printf("%s set the topic of %s to %q", p.ChannelTopicChanged.ChangedBy, p.ChannelTopicChanged.ChannelId, p.ChannelTopicChanged.Topic)
+	case *pb.Event_ChannelDeleted:
+		log.Printf("Channel %s deleted", p.ChannelDeleted.ChannelId)
+	case *pb.Event_RoleChanged:
+		log.Printf("%s is now %s", p.RoleChanged.Username, p.RoleChanged.Role)
+	case *pb.Event_MessagePinned:
+		log.Printf("[%s] %s pinned: %s", p.MessagePinned.Pin.GetChannelId(), p.MessagePinned.Pin.GetPinnedBy(), p.MessagePinned.Pin.GetMessage().GetText())
+	case *pb.Event_MessageUnpinned:
+		log.Printf("[%s] %s unpinned message %s", p.MessageUnpinned.ChannelId, p.MessageUnpinned.UnpinnedBy, p.MessageUnpinned.MessageId)
+	case *pb.Event_PresenceUpdated:
+		log.Printf("%s is %s", p.PresenceUpdated.Username, p.PresenceUpdated.Presence)
+	}
+}
+
 func main() {
 	flag.Parse()
 
@@ -192,10 +801,28 @@ func main() {
 		os.Exit(1)
 	}
 
+	creds, err := transportCredentials()
+	if err != nil {
+		log.Fatalf("failed to set up TLS: %v", err)
+	}
 	var opts []grpc.DialOption
-	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	opts = append(opts, grpc.WithTransportCredentials(creds))
 
-	conn, err := grpc.Dial(*serverAddr, opts...)
+	// With several addresses the client fails over to the next node when
+	// the one it uses goes down
+	target := *serverAddr
+	if addrs := strings.Split(*serverAddr, ","); len(addrs) > 1 {
+		var state resolver.State
+		for _, addr := range addrs {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: strings.TrimSpace(addr)})
+		}
+		cluster := manual.NewBuilderWithScheme("cluster")
+		cluster.InitialState(state)
+		opts = append(opts, grpc.WithResolvers(cluster), grpc.WithDefaultServiceConfig(clusterServiceConfig))
+		target = cluster.Scheme() + ":///chat"
+	}
+
+	conn, err := grpc.Dial(target, opts...)
 	if err != nil {
 		log.Fatalf("failed to dial server: %v", err)
 	}
@@ -217,7 +844,7 @@ func main() {
 	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", res.GetToken()))
 
 	for {
-		fmt.Println("=====> gRPC Chat Server <===== \n1. create server\n2. join server\n3. leave server\n4. create channels\n5. list messages\n6. send messages\n7. chat (send and receive messages)\n8. exit\nEnter number to activate command: ")
+		fmt.Println("=====> gRPC Chat Server <===== \n1. create server\n2. join server\n3. leave server\n4. create channels\n5. list messages\n6. send messages\n7. chat (send and receive messages)\n8. subscribe to server events\n9. list members\n10. set status\n11. list channels\n12. unread summary\n13. notifications\n14. set member role\n15. search messages\n16. pin message\n17. unpin message\n18. list pins\n19. save message\n20. list saved messages\n21. set channel retention\n22. schedule message\n23. list scheduled messages\n24. cancel scheduled message\n25. create bot\n26. list bots\n27. delete bot\n28. create webhook\n29. list webhooks\n30. delete webhook\n31. list webhook deliveries\n32. create incoming webhook\n33. delete incoming webhook\n34. link channel with another instance\n35. list channel links\n36. unlink channel\n37. exit\nEnter number to activate command: ")
 		scanner := bufio.NewScanner(os.Stdin)
 		scanner.Scan()
 		input := scanner.Text()
@@ -261,7 +888,8 @@ func main() {
 			scanner.Scan()
 			channelName := scanner.Text()
 			serverID := getServerIDByName(serverName)
-			listMessages(ctx, client, serverID, channelName)
+			channelID := getChannelIDByName(ctx, client, serverID, channelName)
+			listMessages(ctx, client, serverID, channelID)
 		case 6:
 			fmt.Println("Enter server name to send messages: ")
 			scanner.Scan()
@@ -270,14 +898,21 @@ func main() {
 			fmt.Println("Enter channel name to send messages: ")
 			scanner.Scan()
 			channelName := scanner.Text()
+			channelID := getChannelIDByName(ctx, client, serverID, channelName)
 			for {
-				fmt.Print("Enter message (enter q to stop): ")
+				fmt.Print("Enter message (enter q to stop, /upload <file> or /download <id>): ")
 				scanner.Scan()
 				message := scanner.Text()
 				if message == "q" {
 					break
 				}
-				sendMessages(ctx, client, serverID, channelName, *username, message)
+				if attachment, ok := attachmentCommand(ctx, client, message); ok {
+					if attachment != nil {
+						sendMessages(ctx, client, serverID, channelID, *username, "", []string{attachment.Id})
+					}
+					continue
+				}
+				sendMessages(ctx, client, serverID, channelID, *username, message, nil)
 			}
 		case 7:
 			fmt.Println("Enter server name: ")
@@ -287,8 +922,240 @@ func main() {
 			fmt.Println("Enter channel name: ")
 			scanner.Scan()
 			channelName := scanner.Text()
-			chat(ctx, client, serverID, channelName, *username)
+			channelID := getChannelIDByName(ctx, client, serverID, channelName)
+			chat(ctx, client, serverID, channelID, *username)
 		case 8:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			subscribe(ctx, client, serverID)
+		case 9:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			listMembers(ctx, client, serverID)
+		case 10:
+			fmt.Println("Enter status (online, idle, do_not_disturb, invisible): ")
+			scanner.Scan()
+			status := scanner.Text()
+			fmt.Println("Enter custom status (leave empty for none): ")
+			scanner.Scan()
+			customStatus := scanner.Text()
+			setStatus(ctx, client, status, customStatus)
+		case 11:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			listChannels(ctx, client, serverID)
+		case 12:
+			unreadSummary(ctx, client)
+		case 13:
+			showNotifications(ctx, client)
+		case 14:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			fmt.Println("Enter username: ")
+			scanner.Scan()
+			member := scanner.Text()
+			fmt.Println("Enter role (admin, moderator, member or a custom role): ")
+			scanner.Scan()
+			role := scanner.Text()
+			setRole(ctx, client, serverID, member, role)
+		case 15:
+			fmt.Println("Enter search query (supports \"phrases\", from:, in:, before:, after: and has:): ")
+			scanner.Scan()
+			query := scanner.Text()
+			searchMessages(ctx, client, scanner, query)
+		case 16, 17, 19:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			fmt.Println("Enter channel name: ")
+			scanner.Scan()
+			channelName := scanner.Text()
+			channelID := getChannelIDByName(ctx, client, serverID, channelName)
+			fmt.Println("Enter message id: ")
+			scanner.Scan()
+			messageID := scanner.Text()
+			if command == 19 {
+				saveMessage(ctx, client, serverID, channelID, messageID)
+			} else {
+				pinMessage(ctx, client, serverID, channelID, messageID, command == 16)
+			}
+		case 18:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			fmt.Println("Enter channel name: ")
+			scanner.Scan()
+			channelName := scanner.Text()
+			channelID := getChannelIDByName(ctx, client, serverID, channelName)
+			listPins(ctx, client, serverID, channelID)
+		case 20:
+			listSaved(ctx, client)
+		case 21:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			fmt.Println("Enter channel name: ")
+			scanner.Scan()
+			channelName := scanner.Text()
+			channelID := getChannelIDByName(ctx, client, serverID, channelName)
+			fmt.Println("Enter maximum message age, for example 720h (leave empty for no limit): ")
+			scanner.Scan()
+			maxAge := scanner.Text()
+			fmt.Println("Enter maximum number of messages (leave empty for no limit): ")
+			scanner.Scan()
+			maxCount := scanner.Text()
+			fmt.Println("Place the channel on legal hold? (y/n): ")
+			scanner.Scan()
+			legalHold := scanner.Text()
+			setRetention(ctx, client, serverID, channelID, maxAge, maxCount, legalHold)
+		case 22:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			fmt.Println("Enter channel name: ")
+			scanner.Scan()
+			channelName := scanner.Text()
+			channelID := getChannelIDByName(ctx, client, serverID, channelName)
+			fmt.Println("Enter when to send it, as a delay like 8h or a time like 2006-01-02T09:00:00+08:00: ")
+			scanner.Scan()
+			sendAt := scanner.Text()
+			fmt.Println("Enter message: ")
+			scanner.Scan()
+			text := scanner.Text()
+			scheduleMessage(ctx, client, serverID, channelID, sendAt, text)
+		case 23:
+			listScheduled(ctx, client)
+		case 24:
+			fmt.Println("Enter scheduled message id: ")
+			scanner.Scan()
+			id := scanner.Text()
+			cancelScheduled(ctx, client, id)
+		case 25:
+			fmt.Println("Enter bot name: ")
+			scanner.Scan()
+			name := scanner.Text()
+			createBot(ctx, client, name)
+		case 26:
+			listBots(ctx, client)
+		case 27:
+			fmt.Println("Enter bot name: ")
+			scanner.Scan()
+			name := scanner.Text()
+			deleteBot(ctx, client, name)
+		case 28:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			fmt.Println("Enter channel name (leave empty for the whole server): ")
+			scanner.Scan()
+			channelName := scanner.Text()
+			channelID := ""
+			if channelName != "" {
+				channelID = getChannelIDByName(ctx, client, serverID, channelName)
+			}
+			fmt.Println("Enter webhook url: ")
+			scanner.Scan()
+			url := scanner.Text()
+			createWebhook(ctx, client, serverID, channelID, url)
+		case 29:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			listWebhooks(ctx, client, serverID)
+		case 30:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			fmt.Println("Enter webhook id: ")
+			scanner.Scan()
+			webhookID := scanner.Text()
+			deleteWebhook(ctx, client, serverID, webhookID)
+		case 31:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			fmt.Println("Enter webhook id: ")
+			scanner.Scan()
+			webhookID := scanner.Text()
+			fmt.Println("Only show dead letters? (y/n): ")
+			scanner.Scan()
+			deadLetters := scanner.Text()
+			listWebhookDeliveries(ctx, client, serverID, webhookID, deadLetters == "y")
+		case 32:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			fmt.Println("Enter channel name: ")
+			scanner.Scan()
+			channelName := scanner.Text()
+			channelID := getChannelIDByName(ctx, client, serverID, channelName)
+			fmt.Println("Enter the name messages are posted as: ")
+			scanner.Scan()
+			name := scanner.Text()
+			createIncomingWebhook(ctx, client, serverID, channelID, name)
+		case 33:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			listIncomingWebhooks(ctx, client, serverID)
+			fmt.Println("Enter webhook id: ")
+			scanner.Scan()
+			webhookID := scanner.Text()
+			deleteIncomingWebhook(ctx, client, serverID, webhookID)
+		case 34:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			fmt.Println("Enter channel name: ")
+			scanner.Scan()
+			channelName := scanner.Text()
+			channelID := getChannelIDByName(ctx, client, serverID, channelName)
+			fmt.Println("Enter the name of the other instance: ")
+			scanner.Scan()
+			peer := scanner.Text()
+			fmt.Println("Enter the link name, the same on both instances: ")
+			scanner.Scan()
+			link := scanner.Text()
+			linkChannel(ctx, client, serverID, channelID, peer, link)
+		case 35:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			listChannelLinks(ctx, client, serverID)
+		case 36:
+			fmt.Println("Enter server name: ")
+			scanner.Scan()
+			serverName := scanner.Text()
+			serverID := getServerIDByName(serverName)
+			listChannelLinks(ctx, client, serverID)
+			fmt.Println("Enter the name of the other instance: ")
+			scanner.Scan()
+			peer := scanner.Text()
+			fmt.Println("Enter the link name: ")
+			scanner.Scan()
+			link := scanner.Text()
+			unlinkChannel(ctx, client, serverID, peer, link)
+		case 37:
 			fmt.Println("Exiting...")
 			os.Exit(0)
 		default:
@@ -38,6 +38,89 @@ type ChatServerClient interface {
 	SendMessages(ctx context.Context, opts ...grpc.CallOption) (ChatServer_SendMessagesClient, error)
 	// Bidirectional streaming RPC to chat in a chat server
 	Chat(ctx context.Context, opts ...grpc.CallOption) (ChatServer_ChatClient, error)
+	// Server streaming RPC to subscribe to every event in a chat server
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (ChatServer_SubscribeClient, error)
+	// Unary RPC to set the presence and custom status of the caller
+	SetStatus(ctx context.Context, in *SetStatusRequest, opts ...grpc.CallOption) (*SetStatusResponse, error)
+	// Unary RPC to list the members of a chat server with their presence
+	ListMembers(ctx context.Context, in *ListMembersRequest, opts ...grpc.CallOption) (*ListMembersResponse, error)
+	// Unary RPC to tell a channel that the caller is typing
+	StartTyping(ctx context.Context, in *StartTypingRequest, opts ...grpc.CallOption) (*StartTypingResponse, error)
+	// Unary RPC to list the channels of a chat server with unread counts
+	ListChannels(ctx context.Context, in *ListChannelsRequest, opts ...grpc.CallOption) (*ListChannelsResponse, error)
+	// Unary RPC to get a channel of a chat server
+	GetChannel(ctx context.Context, in *GetChannelRequest, opts ...grpc.CallOption) (*GetChannelResponse, error)
+	// Unary RPC to rename a channel or change its retention policy
+	UpdateChannel(ctx context.Context, in *UpdateChannelRequest, opts ...grpc.CallOption) (*UpdateChannelResponse, error)
+	// Unary RPC to delete a channel along with its messages
+	DeleteChannel(ctx context.Context, in *DeleteChannelRequest, opts ...grpc.CallOption) (*DeleteChannelResponse, error)
+	// Unary RPC to change the text of one of the caller's messages
+	EditMessage(ctx context.Context, in *EditMessageRequest, opts ...grpc.CallOption) (*EditMessageResponse, error)
+	// Unary RPC to delete a message
+	DeleteMessage(ctx context.Context, in *DeleteMessageRequest, opts ...grpc.CallOption) (*DeleteMessageResponse, error)
+	// Unary RPC to mark a channel as read up to a message
+	MarkRead(ctx context.Context, in *MarkReadRequest, opts ...grpc.CallOption) (*MarkReadResponse, error)
+	// Unary RPC to summarise unread messages across all joined chat servers
+	GetUnreadSummary(ctx context.Context, in *GetUnreadSummaryRequest, opts ...grpc.CallOption) (*GetUnreadSummaryResponse, error)
+	// Unary RPC to change the role of a member of a chat server
+	SetRole(ctx context.Context, in *SetRoleRequest, opts ...grpc.CallOption) (*SetRoleResponse, error)
+	// Unary RPC to list the notifications in the caller's inbox
+	ListNotifications(ctx context.Context, in *ListNotificationsRequest, opts ...grpc.CallOption) (*ListNotificationsResponse, error)
+	// Unary RPC to remove a notification from the caller's inbox
+	AckNotification(ctx context.Context, in *AckNotificationRequest, opts ...grpc.CallOption) (*AckNotificationResponse, error)
+	// Server streaming RPC to receive new notifications as they arrive
+	StreamNotifications(ctx context.Context, in *StreamNotificationsRequest, opts ...grpc.CallOption) (ChatServer_StreamNotificationsClient, error)
+	// Unary RPC to search the message history of the caller's chat servers
+	SearchMessages(ctx context.Context, in *SearchMessagesRequest, opts ...grpc.CallOption) (*SearchMessagesResponse, error)
+	// Client streaming RPC to upload a file to attach to messages
+	UploadAttachment(ctx context.Context, opts ...grpc.CallOption) (ChatServer_UploadAttachmentClient, error)
+	// Server streaming RPC to download an attachment
+	DownloadAttachment(ctx context.Context, in *DownloadAttachmentRequest, opts ...grpc.CallOption) (ChatServer_DownloadAttachmentClient, error)
+	// Unary RPC to pin a message to its channel
+	PinMessage(ctx context.Context, in *PinMessageRequest, opts ...grpc.CallOption) (*PinMessageResponse, error)
+	// Unary RPC to unpin a message from its channel
+	UnpinMessage(ctx context.Context, in *UnpinMessageRequest, opts ...grpc.CallOption) (*UnpinMessageResponse, error)
+	// Unary RPC to list the pinned messages of a channel
+	ListPins(ctx context.Context, in *ListPinsRequest, opts ...grpc.CallOption) (*ListPinsResponse, error)
+	// Unary RPC to bookmark a message for the caller
+	SaveMessage(ctx context.Context, in *SaveMessageRequest, opts ...grpc.CallOption) (*SaveMessageResponse, error)
+	// Unary RPC to remove a bookmark of the caller
+	UnsaveMessage(ctx context.Context, in *UnsaveMessageRequest, opts ...grpc.CallOption) (*UnsaveMessageResponse, error)
+	// Unary RPC to list the messages bookmarked by the caller
+	ListSaved(ctx context.Context, in *ListSavedRequest, opts ...grpc.CallOption) (*ListSavedResponse, error)
+	// Unary RPC to post a message to a channel at a later time
+	ScheduleMessage(ctx context.Context, in *ScheduleMessageRequest, opts ...grpc.CallOption) (*ScheduleMessageResponse, error)
+	// Unary RPC to list the caller's messages that are waiting to be posted
+	ListScheduled(ctx context.Context, in *ListScheduledRequest, opts ...grpc.CallOption) (*ListScheduledResponse, error)
+	// Unary RPC to cancel a scheduled message before it is posted
+	CancelScheduled(ctx context.Context, in *CancelScheduledRequest, opts ...grpc.CallOption) (*CancelScheduledResponse, error)
+	// Unary RPC to create a bot account owned by the caller and get its API key
+	CreateBot(ctx context.Context, in *CreateBotRequest, opts ...grpc.CallOption) (*CreateBotResponse, error)
+	// Unary RPC to list the bot accounts owned by the caller
+	ListBots(ctx context.Context, in *ListBotsRequest, opts ...grpc.CallOption) (*ListBotsResponse, error)
+	// Unary RPC to delete a bot account owned by the caller
+	DeleteBot(ctx context.Context, in *DeleteBotRequest, opts ...grpc.CallOption) (*DeleteBotResponse, error)
+	// Unary RPC to register an HTTP endpoint that receives the events of a
+	// chat server or channel
+	CreateWebhook(ctx context.Context, in *CreateWebhookRequest, opts ...grpc.CallOption) (*CreateWebhookResponse, error)
+	// Unary RPC to list the outgoing webhooks of a chat server
+	ListWebhooks(ctx context.Context, in *ListWebhooksRequest, opts ...grpc.CallOption) (*ListWebhooksResponse, error)
+	// Unary RPC to delete an outgoing webhook
+	DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...grpc.CallOption) (*DeleteWebhookResponse, error)
+	// Unary RPC to list the recent or dead-lettered deliveries of a webhook
+	ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesResponse, error)
+	// Unary RPC to create a URL that external systems can POST messages to
+	CreateIncomingWebhook(ctx context.Context, in *CreateIncomingWebhookRequest, opts ...grpc.CallOption) (*CreateIncomingWebhookResponse, error)
+	// Unary RPC to list the incoming webhooks of a chat server
+	ListIncomingWebhooks(ctx context.Context, in *ListIncomingWebhooksRequest, opts ...grpc.CallOption) (*ListIncomingWebhooksResponse, error)
+	// Unary RPC to revoke an incoming webhook
+	DeleteIncomingWebhook(ctx context.Context, in *DeleteIncomingWebhookRequest, opts ...grpc.CallOption) (*DeleteIncomingWebhookResponse, error)
+	// Unary RPC to link a channel with a channel of a federated instance
+	LinkChannel(ctx context.Context, in *LinkChannelRequest, opts ...grpc.CallOption) (*LinkChannelResponse, error)
+	// Unary RPC to list the federated channel links of a chat server
+	ListChannelLinks(ctx context.Context, in *ListChannelLinksRequest, opts ...grpc.CallOption) (*ListChannelLinksResponse, error)
+	// Unary RPC to remove a federated channel link
+	UnlinkChannel(ctx context.Context, in *UnlinkChannelRequest, opts ...grpc.CallOption) (*UnlinkChannelResponse, error)
 }
 
 type chatServerClient struct {
@@ -190,278 +273,2394 @@ func (x *chatServerChatClient) Recv() (*ChatMessage, error) {
 	return m, nil
 }
 
+func (c *chatServerClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (ChatServer_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ChatServer_ServiceDesc.Streams[3], "/pb.ChatServer/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chatServerSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ChatServer_SubscribeClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type chatServerSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *chatServerSubscribeClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *chatServerClient) SetStatus(ctx context.Context, in *SetStatusRequest, opts ...grpc.CallOption) (*SetStatusResponse, error) {
+	out := new(SetStatusResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/SetStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ListMembers(ctx context.Context, in *ListMembersRequest, opts ...grpc.CallOption) (*ListMembersResponse, error) {
+	out := new(ListMembersResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ListMembers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) StartTyping(ctx context.Context, in *StartTypingRequest, opts ...grpc.CallOption) (*StartTypingResponse, error) {
+	out := new(StartTypingResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/StartTyping", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ListChannels(ctx context.Context, in *ListChannelsRequest, opts ...grpc.CallOption) (*ListChannelsResponse, error) {
+	out := new(ListChannelsResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ListChannels", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) GetChannel(ctx context.Context, in *GetChannelRequest, opts ...grpc.CallOption) (*GetChannelResponse, error) {
+	out := new(GetChannelResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/GetChannel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) UpdateChannel(ctx context.Context, in *UpdateChannelRequest, opts ...grpc.CallOption) (*UpdateChannelResponse, error) {
+	out := new(UpdateChannelResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/UpdateChannel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) DeleteChannel(ctx context.Context, in *DeleteChannelRequest, opts ...grpc.CallOption) (*DeleteChannelResponse, error) {
+	out := new(DeleteChannelResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/DeleteChannel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) EditMessage(ctx context.Context, in *EditMessageRequest, opts ...grpc.CallOption) (*EditMessageResponse, error) {
+	out := new(EditMessageResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/EditMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) DeleteMessage(ctx context.Context, in *DeleteMessageRequest, opts ...grpc.CallOption) (*DeleteMessageResponse, error) {
+	out := new(DeleteMessageResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/DeleteMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) MarkRead(ctx context.Context, in *MarkReadRequest, opts ...grpc.CallOption) (*MarkReadResponse, error) {
+	out := new(MarkReadResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/MarkRead", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) GetUnreadSummary(ctx context.Context, in *GetUnreadSummaryRequest, opts ...grpc.CallOption) (*GetUnreadSummaryResponse, error) {
+	out := new(GetUnreadSummaryResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/GetUnreadSummary", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) SetRole(ctx context.Context, in *SetRoleRequest, opts ...grpc.CallOption) (*SetRoleResponse, error) {
+	out := new(SetRoleResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/SetRole", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ListNotifications(ctx context.Context, in *ListNotificationsRequest, opts ...grpc.CallOption) (*ListNotificationsResponse, error) {
+	out := new(ListNotificationsResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ListNotifications", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) AckNotification(ctx context.Context, in *AckNotificationRequest, opts ...grpc.CallOption) (*AckNotificationResponse, error) {
+	out := new(AckNotificationResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/AckNotification", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) StreamNotifications(ctx context.Context, in *StreamNotificationsRequest, opts ...grpc.CallOption) (ChatServer_StreamNotificationsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ChatServer_ServiceDesc.Streams[4], "/pb.ChatServer/StreamNotifications", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chatServerStreamNotificationsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ChatServer_StreamNotificationsClient interface {
+	Recv() (*Notification, error)
+	grpc.ClientStream
+}
+
+type chatServerStreamNotificationsClient struct {
+	grpc.ClientStream
+}
+
+func (x *chatServerStreamNotificationsClient) Recv() (*Notification, error) {
+	m := new(Notification)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *chatServerClient) SearchMessages(ctx context.Context, in *SearchMessagesRequest, opts ...grpc.CallOption) (*SearchMessagesResponse, error) {
+	out := new(SearchMessagesResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/SearchMessages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) UploadAttachment(ctx context.Context, opts ...grpc.CallOption) (ChatServer_UploadAttachmentClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ChatServer_ServiceDesc.Streams[5], "/pb.ChatServer/UploadAttachment", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chatServerUploadAttachmentClient{stream}
+	return x, nil
+}
+
+type ChatServer_UploadAttachmentClient interface {
+	Send(*UploadAttachmentRequest) error
+	CloseAndRecv() (*UploadAttachmentResponse, error)
+	grpc.ClientStream
+}
+
+type chatServerUploadAttachmentClient struct {
+	grpc.ClientStream
+}
+
+func (x *chatServerUploadAttachmentClient) Send(m *UploadAttachmentRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *chatServerUploadAttachmentClient) CloseAndRecv() (*UploadAttachmentResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(UploadAttachmentResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *chatServerClient) DownloadAttachment(ctx context.Context, in *DownloadAttachmentRequest, opts ...grpc.CallOption) (ChatServer_DownloadAttachmentClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ChatServer_ServiceDesc.Streams[6], "/pb.ChatServer/DownloadAttachment", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chatServerDownloadAttachmentClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ChatServer_DownloadAttachmentClient interface {
+	Recv() (*DownloadAttachmentResponse, error)
+	grpc.ClientStream
+}
+
+type chatServerDownloadAttachmentClient struct {
+	grpc.ClientStream
+}
+
+func (x *chatServerDownloadAttachmentClient) Recv() (*DownloadAttachmentResponse, error) {
+	m := new(DownloadAttachmentResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *chatServerClient) PinMessage(ctx context.Context, in *PinMessageRequest, opts ...grpc.CallOption) (*PinMessageResponse, error) {
+	out := new(PinMessageResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/PinMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) UnpinMessage(ctx context.Context, in *UnpinMessageRequest, opts ...grpc.CallOption) (*UnpinMessageResponse, error) {
+	out := new(UnpinMessageResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/UnpinMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ListPins(ctx context.Context, in *ListPinsRequest, opts ...grpc.CallOption) (*ListPinsResponse, error) {
+	out := new(ListPinsResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ListPins", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) SaveMessage(ctx context.Context, in *SaveMessageRequest, opts ...grpc.CallOption) (*SaveMessageResponse, error) {
+	out := new(SaveMessageResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/SaveMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) UnsaveMessage(ctx context.Context, in *UnsaveMessageRequest, opts ...grpc.CallOption) (*UnsaveMessageResponse, error) {
+	out := new(UnsaveMessageResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/UnsaveMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ListSaved(ctx context.Context, in *ListSavedRequest, opts ...grpc.CallOption) (*ListSavedResponse, error) {
+	out := new(ListSavedResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ListSaved", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ScheduleMessage(ctx context.Context, in *ScheduleMessageRequest, opts ...grpc.CallOption) (*ScheduleMessageResponse, error) {
+	out := new(ScheduleMessageResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ScheduleMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ListScheduled(ctx context.Context, in *ListScheduledRequest, opts ...grpc.CallOption) (*ListScheduledResponse, error) {
+	out := new(ListScheduledResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ListScheduled", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) CancelScheduled(ctx context.Context, in *CancelScheduledRequest, opts ...grpc.CallOption) (*CancelScheduledResponse, error) {
+	out := new(CancelScheduledResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/CancelScheduled", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) CreateBot(ctx context.Context, in *CreateBotRequest, opts ...grpc.CallOption) (*CreateBotResponse, error) {
+	out := new(CreateBotResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/CreateBot", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ListBots(ctx context.Context, in *ListBotsRequest, opts ...grpc.CallOption) (*ListBotsResponse, error) {
+	out := new(ListBotsResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ListBots", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) DeleteBot(ctx context.Context, in *DeleteBotRequest, opts ...grpc.CallOption) (*DeleteBotResponse, error) {
+	out := new(DeleteBotResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/DeleteBot", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) CreateWebhook(ctx context.Context, in *CreateWebhookRequest, opts ...grpc.CallOption) (*CreateWebhookResponse, error) {
+	out := new(CreateWebhookResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/CreateWebhook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ListWebhooks(ctx context.Context, in *ListWebhooksRequest, opts ...grpc.CallOption) (*ListWebhooksResponse, error) {
+	out := new(ListWebhooksResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ListWebhooks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...grpc.CallOption) (*DeleteWebhookResponse, error) {
+	out := new(DeleteWebhookResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/DeleteWebhook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesResponse, error) {
+	out := new(ListWebhookDeliveriesResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ListWebhookDeliveries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) CreateIncomingWebhook(ctx context.Context, in *CreateIncomingWebhookRequest, opts ...grpc.CallOption) (*CreateIncomingWebhookResponse, error) {
+	out := new(CreateIncomingWebhookResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/CreateIncomingWebhook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ListIncomingWebhooks(ctx context.Context, in *ListIncomingWebhooksRequest, opts ...grpc.CallOption) (*ListIncomingWebhooksResponse, error) {
+	out := new(ListIncomingWebhooksResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ListIncomingWebhooks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) DeleteIncomingWebhook(ctx context.Context, in *DeleteIncomingWebhookRequest, opts ...grpc.CallOption) (*DeleteIncomingWebhookResponse, error) {
+	out := new(DeleteIncomingWebhookResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/DeleteIncomingWebhook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) LinkChannel(ctx context.Context, in *LinkChannelRequest, opts ...grpc.CallOption) (*LinkChannelResponse, error) {
+	out := new(LinkChannelResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/LinkChannel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) ListChannelLinks(ctx context.Context, in *ListChannelLinksRequest, opts ...grpc.CallOption) (*ListChannelLinksResponse, error) {
+	out := new(ListChannelLinksResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/ListChannelLinks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServerClient) UnlinkChannel(ctx context.Context, in *UnlinkChannelRequest, opts ...grpc.CallOption) (*UnlinkChannelResponse, error) {
+	out := new(UnlinkChannelResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChatServer/UnlinkChannel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ChatServerServer is the server API for ChatServer service.
 // All implementations must embed UnimplementedChatServerServer
 // for forward compatibility
-type ChatServerServer interface {
-	// Unary RPC to login
-	Login(context.Context, *LoginRequest) (*LoginResponse, error)
-	// Unary RPC to create a new chat server
-	CreateChatServer(context.Context, *CreateChatServerRequest) (*CreateChatServerResponse, error)
-	// Unary RPC to join a chat server
-	JoinChatServer(context.Context, *JoinChatServerRequest) (*JoinChatServerResponse, error)
-	// Unary RPC to leave a chat server
-	LeaveChatServer(context.Context, *LeaveChatServerRequest) (*LeaveChatServerResponse, error)
-	// Unary RPC to create a new channel in a chat server
-	CreateChannel(context.Context, *CreateChannelRequest) (*CreateChannelResponse, error)
-	// Server streaming RPC to list messages in a chat server
-	ListMessages(*ListMessagesRequest, ChatServer_ListMessagesServer) error
-	// Client Streaming RPC to send messages to a chat server
-	SendMessages(ChatServer_SendMessagesServer) error
-	// Bidirectional streaming RPC to chat in a chat server
-	Chat(ChatServer_ChatServer) error
-	mustEmbedUnimplementedChatServerServer()
+type ChatServerServer interface {
+	// Unary RPC to login
+	Login(context.Context, *LoginRequest) (*LoginResponse, error)
+	// Unary RPC to create a new chat server
+	CreateChatServer(context.Context, *CreateChatServerRequest) (*CreateChatServerResponse, error)
+	// Unary RPC to join a chat server
+	JoinChatServer(context.Context, *JoinChatServerRequest) (*JoinChatServerResponse, error)
+	// Unary RPC to leave a chat server
+	LeaveChatServer(context.Context, *LeaveChatServerRequest) (*LeaveChatServerResponse, error)
+	// Unary RPC to create a new channel in a chat server
+	CreateChannel(context.Context, *CreateChannelRequest) (*CreateChannelResponse, error)
+	// Server streaming RPC to list messages in a chat server
+	ListMessages(*ListMessagesRequest, ChatServer_ListMessagesServer) error
+	// Client Streaming RPC to send messages to a chat server
+	SendMessages(ChatServer_SendMessagesServer) error
+	// Bidirectional streaming RPC to chat in a chat server
+	Chat(ChatServer_ChatServer) error
+	// Server streaming RPC to subscribe to every event in a chat server
+	Subscribe(*SubscribeRequest, ChatServer_SubscribeServer) error
+	// Unary RPC to set the presence and custom status of the caller
+	SetStatus(context.Context, *SetStatusRequest) (*SetStatusResponse, error)
+	// Unary RPC to list the members of a chat server with their presence
+	ListMembers(context.Context, *ListMembersRequest) (*ListMembersResponse, error)
+	// Unary RPC to tell a channel that the caller is typing
+	StartTyping(context.Context, *StartTypingRequest) (*StartTypingResponse, error)
+	// Unary RPC to list the channels of a chat server with unread counts
+	ListChannels(context.Context, *ListChannelsRequest) (*ListChannelsResponse, error)
+	// Unary RPC to get a channel of a chat server
+	GetChannel(context.Context, *GetChannelRequest) (*GetChannelResponse, error)
+	// Unary RPC to rename a channel or change its retention policy
+	UpdateChannel(context.Context, *UpdateChannelRequest) (*UpdateChannelResponse, error)
+	// Unary RPC to delete a channel along with its messages
+	DeleteChannel(context.Context, *DeleteChannelRequest) (*DeleteChannelResponse, error)
+	// Unary RPC to change the text of one of the caller's messages
+	EditMessage(context.Context, *EditMessageRequest) (*EditMessageResponse, error)
+	// Unary RPC to delete a message
+	DeleteMessage(context.Context, *DeleteMessageRequest) (*DeleteMessageResponse, error)
+	// Unary RPC to mark a channel as read up to a message
+	MarkRead(context.Context, *MarkReadRequest) (*MarkReadResponse, error)
+	// Unary RPC to summarise unread messages across all joined chat servers
+	GetUnreadSummary(context.Context, *GetUnreadSummaryRequest) (*GetUnreadSummaryResponse, error)
+	// Unary RPC to change the role of a member of a chat server
+	SetRole(context.Context, *SetRoleRequest) (*SetRoleResponse, error)
+	// Unary RPC to list the notifications in the caller's inbox
+	ListNotifications(context.Context, *ListNotificationsRequest) (*ListNotificationsResponse, error)
+	// Unary RPC to remove a notification from the caller's inbox
+	AckNotification(context.Context, *AckNotificationRequest) (*AckNotificationResponse, error)
+	// Server streaming RPC to receive new notifications as they arrive
+	StreamNotifications(*StreamNotificationsRequest, ChatServer_StreamNotificationsServer) error
+	// Unary RPC to search the message history of the caller's chat servers
+	SearchMessages(context.Context, *SearchMessagesRequest) (*SearchMessagesResponse, error)
+	// Client streaming RPC to upload a file to attach to messages
+	UploadAttachment(ChatServer_UploadAttachmentServer) error
+	// Server streaming RPC to download an attachment
+	DownloadAttachment(*DownloadAttachmentRequest, ChatServer_DownloadAttachmentServer) error
+	// Unary RPC to pin a message to its channel
+	PinMessage(context.Context, *PinMessageRequest) (*PinMessageResponse, error)
+	// Unary RPC to unpin a message from its channel
+	UnpinMessage(context.Context, *UnpinMessageRequest) (*UnpinMessageResponse, error)
+	// Unary RPC to list the pinned messages of a channel
+	ListPins(context.Context, *ListPinsRequest) (*ListPinsResponse, error)
+	// Unary RPC to bookmark a message for the caller
+	SaveMessage(context.Context, *SaveMessageRequest) (*SaveMessageResponse, error)
+	// Unary RPC to remove a bookmark of the caller
+	UnsaveMessage(context.Context, *UnsaveMessageRequest) (*UnsaveMessageResponse, error)
+	// Unary RPC to list the messages bookmarked by the caller
+	ListSaved(context.Context, *ListSavedRequest) (*ListSavedResponse, error)
+	// Unary RPC to post a message to a channel at a later time
+	ScheduleMessage(context.Context, *ScheduleMessageRequest) (*ScheduleMessageResponse, error)
+	// Unary RPC to list the caller's messages that are waiting to be posted
+	ListScheduled(context.Context, *ListScheduledRequest) (*ListScheduledResponse, error)
+	// Unary RPC to cancel a scheduled message before it is posted
+	CancelScheduled(context.Context, *CancelScheduledRequest) (*CancelScheduledResponse, error)
+	// Unary RPC to create a bot account owned by the caller and get its API key
+	CreateBot(context.Context, *CreateBotRequest) (*CreateBotResponse, error)
+	// Unary RPC to list the bot accounts owned by the caller
+	ListBots(context.Context, *ListBotsRequest) (*ListBotsResponse, error)
+	// Unary RPC to delete a bot account owned by the caller
+	DeleteBot(context.Context, *DeleteBotRequest) (*DeleteBotResponse, error)
+	// Unary RPC to register an HTTP endpoint that receives the events of a
+	// chat server or channel
+	CreateWebhook(context.Context, *CreateWebhookRequest) (*CreateWebhookResponse, error)
+	// Unary RPC to list the outgoing webhooks of a chat server
+	ListWebhooks(context.Context, *ListWebhooksRequest) (*ListWebhooksResponse, error)
+	// Unary RPC to delete an outgoing webhook
+	DeleteWebhook(context.Context, *DeleteWebhookRequest) (*DeleteWebhookResponse, error)
+	// Unary RPC to list the recent or dead-lettered deliveries of a webhook
+	ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesResponse, error)
+	// Unary RPC to create a URL that external systems can POST messages to
+	CreateIncomingWebhook(context.Context, *CreateIncomingWebhookRequest) (*CreateIncomingWebhookResponse, error)
+	// Unary RPC to list the incoming webhooks of a chat server
+	ListIncomingWebhooks(context.Context, *ListIncomingWebhooksRequest) (*ListIncomingWebhooksResponse, error)
+	// Unary RPC to revoke an incoming webhook
+	DeleteIncomingWebhook(context.Context, *DeleteIncomingWebhookRequest) (*DeleteIncomingWebhookResponse, error)
+	// Unary RPC to link a channel with a channel of a federated instance
+	LinkChannel(context.Context, *LinkChannelRequest) (*LinkChannelResponse, error)
+	// Unary RPC to list the federated channel links of a chat server
+	ListChannelLinks(context.Context, *ListChannelLinksRequest) (*ListChannelLinksResponse, error)
+	// Unary RPC to remove a federated channel link
+	UnlinkChannel(context.Context, *UnlinkChannelRequest) (*UnlinkChannelResponse, error)
+	mustEmbedUnimplementedChatServerServer()
+}
+
+// UnimplementedChatServerServer must be embedded to have forward compatible implementations.
+type UnimplementedChatServerServer struct {
+}
+
+func (UnimplementedChatServerServer) Login(context.Context, *LoginRequest) (*LoginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedChatServerServer) CreateChatServer(context.Context, *CreateChatServerRequest) (*CreateChatServerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateChatServer not implemented")
+}
+func (UnimplementedChatServerServer) JoinChatServer(context.Context, *JoinChatServerRequest) (*JoinChatServerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method JoinChatServer not implemented")
+}
+func (UnimplementedChatServerServer) LeaveChatServer(context.Context, *LeaveChatServerRequest) (*LeaveChatServerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LeaveChatServer not implemented")
+}
+func (UnimplementedChatServerServer) CreateChannel(context.Context, *CreateChannelRequest) (*CreateChannelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateChannel not implemented")
+}
+func (UnimplementedChatServerServer) ListMessages(*ListMessagesRequest, ChatServer_ListMessagesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListMessages not implemented")
+}
+func (UnimplementedChatServerServer) SendMessages(ChatServer_SendMessagesServer) error {
+	return status.Errorf(codes.Unimplemented, "method SendMessages not implemented")
+}
+func (UnimplementedChatServerServer) Chat(ChatServer_ChatServer) error {
+	return status.Errorf(codes.Unimplemented, "method Chat not implemented")
+}
+func (UnimplementedChatServerServer) Subscribe(*SubscribeRequest, ChatServer_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedChatServerServer) SetStatus(context.Context, *SetStatusRequest) (*SetStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetStatus not implemented")
+}
+func (UnimplementedChatServerServer) ListMembers(context.Context, *ListMembersRequest) (*ListMembersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMembers not implemented")
+}
+func (UnimplementedChatServerServer) StartTyping(context.Context, *StartTypingRequest) (*StartTypingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartTyping not implemented")
+}
+func (UnimplementedChatServerServer) ListChannels(context.Context, *ListChannelsRequest) (*ListChannelsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListChannels not implemented")
+}
+func (UnimplementedChatServerServer) GetChannel(context.Context, *GetChannelRequest) (*GetChannelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChannel not implemented")
+}
+func (UnimplementedChatServerServer) UpdateChannel(context.Context, *UpdateChannelRequest) (*UpdateChannelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateChannel not implemented")
+}
+func (UnimplementedChatServerServer) DeleteChannel(context.Context, *DeleteChannelRequest) (*DeleteChannelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteChannel not implemented")
+}
+func (UnimplementedChatServerServer) EditMessage(context.Context, *EditMessageRequest) (*EditMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EditMessage not implemented")
+}
+func (UnimplementedChatServerServer) DeleteMessage(context.Context, *DeleteMessageRequest) (*DeleteMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMessage not implemented")
+}
+func (UnimplementedChatServerServer) MarkRead(context.Context, *MarkReadRequest) (*MarkReadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MarkRead not implemented")
+}
+func (UnimplementedChatServerServer) GetUnreadSummary(context.Context, *GetUnreadSummaryRequest) (*GetUnreadSummaryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUnreadSummary not implemented")
+}
+func (UnimplementedChatServerServer) SetRole(context.Context, *SetRoleRequest) (*SetRoleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRole not implemented")
+}
+func (UnimplementedChatServerServer) ListNotifications(context.Context, *ListNotificationsRequest) (*ListNotificationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNotifications not implemented")
+}
+func (UnimplementedChatServerServer) AckNotification(context.Context, *AckNotificationRequest) (*AckNotificationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AckNotification not implemented")
+}
+func (UnimplementedChatServerServer) StreamNotifications(*StreamNotificationsRequest, ChatServer_StreamNotificationsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamNotifications not implemented")
+}
+func (UnimplementedChatServerServer) SearchMessages(context.Context, *SearchMessagesRequest) (*SearchMessagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchMessages not implemented")
+}
+func (UnimplementedChatServerServer) UploadAttachment(ChatServer_UploadAttachmentServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadAttachment not implemented")
+}
+func (UnimplementedChatServerServer) DownloadAttachment(*DownloadAttachmentRequest, ChatServer_DownloadAttachmentServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadAttachment not implemented")
+}
+func (UnimplementedChatServerServer) PinMessage(context.Context, *PinMessageRequest) (*PinMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PinMessage not implemented")
+}
+func (UnimplementedChatServerServer) UnpinMessage(context.Context, *UnpinMessageRequest) (*UnpinMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnpinMessage not implemented")
+}
+func (UnimplementedChatServerServer) ListPins(context.Context, *ListPinsRequest) (*ListPinsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPins not implemented")
+}
+func (UnimplementedChatServerServer) SaveMessage(context.Context, *SaveMessageRequest) (*SaveMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SaveMessage not implemented")
+}
+func (UnimplementedChatServerServer) UnsaveMessage(context.Context, *UnsaveMessageRequest) (*UnsaveMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnsaveMessage not implemented")
+}
+func (UnimplementedChatServerServer) ListSaved(context.Context, *ListSavedRequest) (*ListSavedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSaved not implemented")
+}
+func (UnimplementedChatServerServer) ScheduleMessage(context.Context, *ScheduleMessageRequest) (*ScheduleMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScheduleMessage not implemented")
+}
+func (UnimplementedChatServerServer) ListScheduled(context.Context, *ListScheduledRequest) (*ListScheduledResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListScheduled not implemented")
+}
+func (UnimplementedChatServerServer) CancelScheduled(context.Context, *CancelScheduledRequest) (*CancelScheduledResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelScheduled not implemented")
+}
+func (UnimplementedChatServerServer) CreateBot(context.Context, *CreateBotRequest) (*CreateBotResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateBot not implemented")
+}
+func (UnimplementedChatServerServer) ListBots(context.Context, *ListBotsRequest) (*ListBotsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBots not implemented")
+}
+func (UnimplementedChatServerServer) DeleteBot(context.Context, *DeleteBotRequest) (*DeleteBotResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteBot not implemented")
+}
+func (UnimplementedChatServerServer) CreateWebhook(context.Context, *CreateWebhookRequest) (*CreateWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateWebhook not implemented")
+}
+func (UnimplementedChatServerServer) ListWebhooks(context.Context, *ListWebhooksRequest) (*ListWebhooksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhooks not implemented")
+}
+func (UnimplementedChatServerServer) DeleteWebhook(context.Context, *DeleteWebhookRequest) (*DeleteWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteWebhook not implemented")
+}
+func (UnimplementedChatServerServer) ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhookDeliveries not implemented")
+}
+func (UnimplementedChatServerServer) CreateIncomingWebhook(context.Context, *CreateIncomingWebhookRequest) (*CreateIncomingWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateIncomingWebhook not implemented")
+}
+func (UnimplementedChatServerServer) ListIncomingWebhooks(context.Context, *ListIncomingWebhooksRequest) (*ListIncomingWebhooksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListIncomingWebhooks not implemented")
+}
+func (UnimplementedChatServerServer) DeleteIncomingWebhook(context.Context, *DeleteIncomingWebhookRequest) (*DeleteIncomingWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteIncomingWebhook not implemented")
+}
+func (UnimplementedChatServerServer) LinkChannel(context.Context, *LinkChannelRequest) (*LinkChannelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LinkChannel not implemented")
+}
+func (UnimplementedChatServerServer) ListChannelLinks(context.Context, *ListChannelLinksRequest) (*ListChannelLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListChannelLinks not implemented")
+}
+func (UnimplementedChatServerServer) UnlinkChannel(context.Context, *UnlinkChannelRequest) (*UnlinkChannelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnlinkChannel not implemented")
+}
+func (UnimplementedChatServerServer) mustEmbedUnimplementedChatServerServer() {}
+
+// UnsafeChatServerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChatServerServer will
+// result in compilation errors.
+type UnsafeChatServerServer interface {
+	mustEmbedUnimplementedChatServerServer()
+}
+
+func RegisterChatServerServer(s grpc.ServiceRegistrar, srv ChatServerServer) {
+	s.RegisterService(&ChatServer_ServiceDesc, srv)
+}
+
+func _ChatServer_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/Login",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).Login(ctx, req.(*LoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_CreateChatServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateChatServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).CreateChatServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/CreateChatServer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).CreateChatServer(ctx, req.(*CreateChatServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_JoinChatServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JoinChatServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).JoinChatServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/JoinChatServer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).JoinChatServer(ctx, req.(*JoinChatServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_LeaveChatServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaveChatServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).LeaveChatServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/LeaveChatServer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).LeaveChatServer(ctx, req.(*LeaveChatServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_CreateChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateChannelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).CreateChannel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/CreateChannel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).CreateChannel(ctx, req.(*CreateChannelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListMessages_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListMessagesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChatServerServer).ListMessages(m, &chatServerListMessagesServer{stream})
+}
+
+type ChatServer_ListMessagesServer interface {
+	Send(*Message) error
+	grpc.ServerStream
+}
+
+type chatServerListMessagesServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatServerListMessagesServer) Send(m *Message) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ChatServer_SendMessages_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ChatServerServer).SendMessages(&chatServerSendMessagesServer{stream})
+}
+
+type ChatServer_SendMessagesServer interface {
+	SendAndClose(*SendMessagesResponse) error
+	Recv() (*SendMessageRequest, error)
+	grpc.ServerStream
+}
+
+type chatServerSendMessagesServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatServerSendMessagesServer) SendAndClose(m *SendMessagesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *chatServerSendMessagesServer) Recv() (*SendMessageRequest, error) {
+	m := new(SendMessageRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _ChatServer_Chat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ChatServerServer).Chat(&chatServerChatServer{stream})
+}
+
+type ChatServer_ChatServer interface {
+	Send(*ChatMessage) error
+	Recv() (*ChatMessage, error)
+	grpc.ServerStream
+}
+
+type chatServerChatServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatServerChatServer) Send(m *ChatMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *chatServerChatServer) Recv() (*ChatMessage, error) {
+	m := new(ChatMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _ChatServer_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChatServerServer).Subscribe(m, &chatServerSubscribeServer{stream})
+}
+
+type ChatServer_SubscribeServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type chatServerSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatServerSubscribeServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ChatServer_SetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).SetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/SetStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).SetStatus(ctx, req.(*SetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListMembers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMembersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ListMembers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ListMembers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ListMembers(ctx, req.(*ListMembersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_StartTyping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartTypingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).StartTyping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/StartTyping",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).StartTyping(ctx, req.(*StartTypingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListChannels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListChannelsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ListChannels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ListChannels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ListChannels(ctx, req.(*ListChannelsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_GetChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetChannelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).GetChannel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/GetChannel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).GetChannel(ctx, req.(*GetChannelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_UpdateChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateChannelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).UpdateChannel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/UpdateChannel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).UpdateChannel(ctx, req.(*UpdateChannelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_DeleteChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteChannelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).DeleteChannel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/DeleteChannel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).DeleteChannel(ctx, req.(*DeleteChannelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_EditMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EditMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).EditMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/EditMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).EditMessage(ctx, req.(*EditMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_DeleteMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).DeleteMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/DeleteMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).DeleteMessage(ctx, req.(*DeleteMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_MarkRead_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MarkReadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).MarkRead(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/MarkRead",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).MarkRead(ctx, req.(*MarkReadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_GetUnreadSummary_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUnreadSummaryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).GetUnreadSummary(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/GetUnreadSummary",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).GetUnreadSummary(ctx, req.(*GetUnreadSummaryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_SetRole_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRoleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).SetRole(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/SetRole",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).SetRole(ctx, req.(*SetRoleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListNotifications_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNotificationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ListNotifications(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ListNotifications",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ListNotifications(ctx, req.(*ListNotificationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_AckNotification_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AckNotificationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).AckNotification(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/AckNotification",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).AckNotification(ctx, req.(*AckNotificationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_StreamNotifications_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamNotificationsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChatServerServer).StreamNotifications(m, &chatServerStreamNotificationsServer{stream})
+}
+
+type ChatServer_StreamNotificationsServer interface {
+	Send(*Notification) error
+	grpc.ServerStream
+}
+
+type chatServerStreamNotificationsServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatServerStreamNotificationsServer) Send(m *Notification) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ChatServer_SearchMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchMessagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).SearchMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/SearchMessages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).SearchMessages(ctx, req.(*SearchMessagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_UploadAttachment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ChatServerServer).UploadAttachment(&chatServerUploadAttachmentServer{stream})
+}
+
+type ChatServer_UploadAttachmentServer interface {
+	SendAndClose(*UploadAttachmentResponse) error
+	Recv() (*UploadAttachmentRequest, error)
+	grpc.ServerStream
+}
+
+type chatServerUploadAttachmentServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatServerUploadAttachmentServer) SendAndClose(m *UploadAttachmentResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *chatServerUploadAttachmentServer) Recv() (*UploadAttachmentRequest, error) {
+	m := new(UploadAttachmentRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _ChatServer_DownloadAttachment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadAttachmentRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChatServerServer).DownloadAttachment(m, &chatServerDownloadAttachmentServer{stream})
+}
+
+type ChatServer_DownloadAttachmentServer interface {
+	Send(*DownloadAttachmentResponse) error
+	grpc.ServerStream
+}
+
+type chatServerDownloadAttachmentServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatServerDownloadAttachmentServer) Send(m *DownloadAttachmentResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ChatServer_PinMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PinMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).PinMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/PinMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).PinMessage(ctx, req.(*PinMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_UnpinMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnpinMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).UnpinMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/UnpinMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).UnpinMessage(ctx, req.(*UnpinMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListPins_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPinsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ListPins(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ListPins",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ListPins(ctx, req.(*ListPinsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_SaveMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SaveMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).SaveMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/SaveMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).SaveMessage(ctx, req.(*SaveMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_UnsaveMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnsaveMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).UnsaveMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/UnsaveMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).UnsaveMessage(ctx, req.(*UnsaveMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListSaved_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSavedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ListSaved(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ListSaved",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ListSaved(ctx, req.(*ListSavedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ScheduleMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScheduleMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ScheduleMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ScheduleMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ScheduleMessage(ctx, req.(*ScheduleMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListScheduled_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListScheduledRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ListScheduled(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ListScheduled",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ListScheduled(ctx, req.(*ListScheduledRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_CancelScheduled_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelScheduledRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).CancelScheduled(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/CancelScheduled",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).CancelScheduled(ctx, req.(*CancelScheduledRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_CreateBot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateBotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).CreateBot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/CreateBot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).CreateBot(ctx, req.(*CreateBotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListBots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ListBots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ListBots",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ListBots(ctx, req.(*ListBotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_DeleteBot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteBotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).DeleteBot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/DeleteBot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).DeleteBot(ctx, req.(*DeleteBotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_CreateWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).CreateWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/CreateWebhook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).CreateWebhook(ctx, req.(*CreateWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListWebhooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhooksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ListWebhooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ListWebhooks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ListWebhooks(ctx, req.(*ListWebhooksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_DeleteWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).DeleteWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/DeleteWebhook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).DeleteWebhook(ctx, req.(*DeleteWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListWebhookDeliveries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhookDeliveriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ListWebhookDeliveries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ListWebhookDeliveries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ListWebhookDeliveries(ctx, req.(*ListWebhookDeliveriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_CreateIncomingWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateIncomingWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).CreateIncomingWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/CreateIncomingWebhook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).CreateIncomingWebhook(ctx, req.(*CreateIncomingWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListIncomingWebhooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListIncomingWebhooksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ListIncomingWebhooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ListIncomingWebhooks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ListIncomingWebhooks(ctx, req.(*ListIncomingWebhooksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_DeleteIncomingWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteIncomingWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).DeleteIncomingWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/DeleteIncomingWebhook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).DeleteIncomingWebhook(ctx, req.(*DeleteIncomingWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_LinkChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LinkChannelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).LinkChannel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/LinkChannel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).LinkChannel(ctx, req.(*LinkChannelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_ListChannelLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListChannelLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).ListChannelLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/ListChannelLinks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).ListChannelLinks(ctx, req.(*ListChannelLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatServer_UnlinkChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnlinkChannelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServerServer).UnlinkChannel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChatServer/UnlinkChannel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServerServer).UnlinkChannel(ctx, req.(*UnlinkChannelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ChatServer_ServiceDesc is the grpc.ServiceDesc for ChatServer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ChatServer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.ChatServer",
+	HandlerType: (*ChatServerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Login",
+			Handler:    _ChatServer_Login_Handler,
+		},
+		{
+			MethodName: "CreateChatServer",
+			Handler:    _ChatServer_CreateChatServer_Handler,
+		},
+		{
+			MethodName: "JoinChatServer",
+			Handler:    _ChatServer_JoinChatServer_Handler,
+		},
+		{
+			MethodName: "LeaveChatServer",
+			Handler:    _ChatServer_LeaveChatServer_Handler,
+		},
+		{
+			MethodName: "CreateChannel",
+			Handler:    _ChatServer_CreateChannel_Handler,
+		},
+		{
+			MethodName: "SetStatus",
+			Handler:    _ChatServer_SetStatus_Handler,
+		},
+		{
+			MethodName: "ListMembers",
+			Handler:    _ChatServer_ListMembers_Handler,
+		},
+		{
+			MethodName: "StartTyping",
+			Handler:    _ChatServer_StartTyping_Handler,
+		},
+		{
+			MethodName: "ListChannels",
+			Handler:    _ChatServer_ListChannels_Handler,
+		},
+		{
+			MethodName: "GetChannel",
+			Handler:    _ChatServer_GetChannel_Handler,
+		},
+		{
+			MethodName: "UpdateChannel",
+			Handler:    _ChatServer_UpdateChannel_Handler,
+		},
+		{
+			MethodName: "DeleteChannel",
+			Handler:    _ChatServer_DeleteChannel_Handler,
+		},
+		{
+			MethodName: "EditMessage",
+			Handler:    _ChatServer_EditMessage_Handler,
+		},
+		{
+			MethodName: "DeleteMessage",
+			Handler:    _ChatServer_DeleteMessage_Handler,
+		},
+		{
+			MethodName: "MarkRead",
+			Handler:    _ChatServer_MarkRead_Handler,
+		},
+		{
+			MethodName: "GetUnreadSummary",
+			Handler:    _ChatServer_GetUnreadSummary_Handler,
+		},
+		{
+			MethodName: "SetRole",
+			Handler:    _ChatServer_SetRole_Handler,
+		},
+		{
+			MethodName: "ListNotifications",
+			Handler:    _ChatServer_ListNotifications_Handler,
+		},
+		{
+			MethodName: "AckNotification",
+			Handler:    _ChatServer_AckNotification_Handler,
+		},
+		{
+			MethodName: "SearchMessages",
+			Handler:    _ChatServer_SearchMessages_Handler,
+		},
+		{
+			MethodName: "PinMessage",
+			Handler:    _ChatServer_PinMessage_Handler,
+		},
+		{
+			MethodName: "UnpinMessage",
+			Handler:    _ChatServer_UnpinMessage_Handler,
+		},
+		{
+			MethodName: "ListPins",
+			Handler:    _ChatServer_ListPins_Handler,
+		},
+		{
+			MethodName: "SaveMessage",
+			Handler:    _ChatServer_SaveMessage_Handler,
+		},
+		{
+			MethodName: "UnsaveMessage",
+			Handler:    _ChatServer_UnsaveMessage_Handler,
+		},
+		{
+			MethodName: "ListSaved",
+			Handler:    _ChatServer_ListSaved_Handler,
+		},
+		{
+			MethodName: "ScheduleMessage",
+			Handler:    _ChatServer_ScheduleMessage_Handler,
+		},
+		{
+			MethodName: "ListScheduled",
+			Handler:    _ChatServer_ListScheduled_Handler,
+		},
+		{
+			MethodName: "CancelScheduled",
+			Handler:    _ChatServer_CancelScheduled_Handler,
+		},
+		{
+			MethodName: "CreateBot",
+			Handler:    _ChatServer_CreateBot_Handler,
+		},
+		{
+			MethodName: "ListBots",
+			Handler:    _ChatServer_ListBots_Handler,
+		},
+		{
+			MethodName: "DeleteBot",
+			Handler:    _ChatServer_DeleteBot_Handler,
+		},
+		{
+			MethodName: "CreateWebhook",
+			Handler:    _ChatServer_CreateWebhook_Handler,
+		},
+		{
+			MethodName: "ListWebhooks",
+			Handler:    _ChatServer_ListWebhooks_Handler,
+		},
+		{
+			MethodName: "DeleteWebhook",
+			Handler:    _ChatServer_DeleteWebhook_Handler,
+		},
+		{
+			MethodName: "ListWebhookDeliveries",
+			Handler:    _ChatServer_ListWebhookDeliveries_Handler,
+		},
+		{
+			MethodName: "CreateIncomingWebhook",
+			Handler:    _ChatServer_CreateIncomingWebhook_Handler,
+		},
+		{
+			MethodName: "ListIncomingWebhooks",
+			Handler:    _ChatServer_ListIncomingWebhooks_Handler,
+		},
+		{
+			MethodName: "DeleteIncomingWebhook",
+			Handler:    _ChatServer_DeleteIncomingWebhook_Handler,
+		},
+		{
+			MethodName: "LinkChannel",
+			Handler:    _ChatServer_LinkChannel_Handler,
+		},
+		{
+			MethodName: "ListChannelLinks",
+			Handler:    _ChatServer_ListChannelLinks_Handler,
+		},
+		{
+			MethodName: "UnlinkChannel",
+			Handler:    _ChatServer_UnlinkChannel_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListMessages",
+			Handler:       _ChatServer_ListMessages_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SendMessages",
+			Handler:       _ChatServer_SendMessages_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Chat",
+			Handler:       _ChatServer_Chat_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _ChatServer_Subscribe_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamNotifications",
+			Handler:       _ChatServer_StreamNotifications_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "UploadAttachment",
+			Handler:       _ChatServer_UploadAttachment_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadAttachment",
+			Handler:       _ChatServer_DownloadAttachment_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pb/app.proto",
+}
+
+// FederationClient is the client API for Federation service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FederationClient interface {
+	// Unary RPC to deliver a batch of events from the calling instance
+	Relay(ctx context.Context, in *RelayRequest, opts ...grpc.CallOption) (*RelayResponse, error)
+}
+
+type federationClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFederationClient(cc grpc.ClientConnInterface) FederationClient {
+	return &federationClient{cc}
+}
+
+func (c *federationClient) Relay(ctx context.Context, in *RelayRequest, opts ...grpc.CallOption) (*RelayResponse, error) {
+	out := new(RelayResponse)
+	err := c.cc.Invoke(ctx, "/pb.Federation/Relay", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FederationServer is the server API for Federation service.
+// All implementations must embed UnimplementedFederationServer
+// for forward compatibility
+type FederationServer interface {
+	// Unary RPC to deliver a batch of events from the calling instance
+	Relay(context.Context, *RelayRequest) (*RelayResponse, error)
+	mustEmbedUnimplementedFederationServer()
+}
+
+// UnimplementedFederationServer must be embedded to have forward compatible implementations.
+type UnimplementedFederationServer struct {
+}
+
+func (UnimplementedFederationServer) Relay(context.Context, *RelayRequest) (*RelayResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Relay not implemented")
+}
+func (UnimplementedFederationServer) mustEmbedUnimplementedFederationServer() {}
+
+// UnsafeFederationServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FederationServer will
+// result in compilation errors.
+type UnsafeFederationServer interface {
+	mustEmbedUnimplementedFederationServer()
+}
+
+func RegisterFederationServer(s grpc.ServiceRegistrar, srv FederationServer) {
+	s.RegisterService(&Federation_ServiceDesc, srv)
+}
+
+func _Federation_Relay_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RelayRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FederationServer).Relay(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Federation/Relay",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FederationServer).Relay(ctx, req.(*RelayRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Federation_ServiceDesc is the grpc.ServiceDesc for Federation service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Federation_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.Federation",
+	HandlerType: (*FederationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Relay",
+			Handler:    _Federation_Relay_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pb/app.proto",
+}
+
+// ClusterClient is the client API for Cluster service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ClusterClient interface {
+	// Unary RPC a follower forwards a command to the leader with
+	Apply(ctx context.Context, in *Command, opts ...grpc.CallOption) (*ApplyResponse, error)
+	// Unary RPC a new node asks the leader to add it to the cluster with
+	Join(ctx context.Context, in *JoinClusterRequest, opts ...grpc.CallOption) (*JoinClusterResponse, error)
+	// Unary RPC a leaving node asks the leader to remove it with
+	Leave(ctx context.Context, in *LeaveClusterRequest, opts ...grpc.CallOption) (*LeaveClusterResponse, error)
+	// Unary RPC to store a message on the node that owns its channel
+	StoreMessage(ctx context.Context, in *StoreMessageCommand, opts ...grpc.CallOption) (*Message, error)
+	// Unary RPC to edit or delete a message on the node that owns its
+	// channel
+	ChangeMessage(ctx context.Context, in *ChangeMessageRequest, opts ...grpc.CallOption) (*ApplyResponse, error)
+	// Unary RPC to hand the messages of a channel to its new owner
+	ImportChannel(ctx context.Context, in *ImportChannelRequest, opts ...grpc.CallOption) (*ImportChannelResponse, error)
+	// Unary RPC the owner of a channel delivers its message events to the
+	// subscribers of the other nodes with
+	Deliver(ctx context.Context, in *DeliverRequest, opts ...grpc.CallOption) (*DeliverResponse, error)
+	// Unary RPC to read a message from the node that owns its channel
+	FetchMessage(ctx context.Context, in *FetchMessageRequest, opts ...grpc.CallOption) (*Message, error)
+	// Unary RPC to count the unread messages of a user in channels the
+	// called node owns
+	CountUnread(ctx context.Context, in *CountUnreadRequest, opts ...grpc.CallOption) (*CountUnreadResponse, error)
+	// Unary RPC to search the channels the called node owns
+	SearchShard(ctx context.Context, in *SearchShardRequest, opts ...grpc.CallOption) (*SearchShardResponse, error)
+}
+
+type clusterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClusterClient(cc grpc.ClientConnInterface) ClusterClient {
+	return &clusterClient{cc}
+}
+
+func (c *clusterClient) Apply(ctx context.Context, in *Command, opts ...grpc.CallOption) (*ApplyResponse, error) {
+	out := new(ApplyResponse)
+	err := c.cc.Invoke(ctx, "/pb.Cluster/Apply", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Join(ctx context.Context, in *JoinClusterRequest, opts ...grpc.CallOption) (*JoinClusterResponse, error) {
+	out := new(JoinClusterResponse)
+	err := c.cc.Invoke(ctx, "/pb.Cluster/Join", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Leave(ctx context.Context, in *LeaveClusterRequest, opts ...grpc.CallOption) (*LeaveClusterResponse, error) {
+	out := new(LeaveClusterResponse)
+	err := c.cc.Invoke(ctx, "/pb.Cluster/Leave", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) StoreMessage(ctx context.Context, in *StoreMessageCommand, opts ...grpc.CallOption) (*Message, error) {
+	out := new(Message)
+	err := c.cc.Invoke(ctx, "/pb.Cluster/StoreMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) ChangeMessage(ctx context.Context, in *ChangeMessageRequest, opts ...grpc.CallOption) (*ApplyResponse, error) {
+	out := new(ApplyResponse)
+	err := c.cc.Invoke(ctx, "/pb.Cluster/ChangeMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) ImportChannel(ctx context.Context, in *ImportChannelRequest, opts ...grpc.CallOption) (*ImportChannelResponse, error) {
+	out := new(ImportChannelResponse)
+	err := c.cc.Invoke(ctx, "/pb.Cluster/ImportChannel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Deliver(ctx context.Context, in *DeliverRequest, opts ...grpc.CallOption) (*DeliverResponse, error) {
+	out := new(DeliverResponse)
+	err := c.cc.Invoke(ctx, "/pb.Cluster/Deliver", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) FetchMessage(ctx context.Context, in *FetchMessageRequest, opts ...grpc.CallOption) (*Message, error) {
+	out := new(Message)
+	err := c.cc.Invoke(ctx, "/pb.Cluster/FetchMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) CountUnread(ctx context.Context, in *CountUnreadRequest, opts ...grpc.CallOption) (*CountUnreadResponse, error) {
+	out := new(CountUnreadResponse)
+	err := c.cc.Invoke(ctx, "/pb.Cluster/CountUnread", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) SearchShard(ctx context.Context, in *SearchShardRequest, opts ...grpc.CallOption) (*SearchShardResponse, error) {
+	out := new(SearchShardResponse)
+	err := c.cc.Invoke(ctx, "/pb.Cluster/SearchShard", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClusterServer is the server API for Cluster service.
+// All implementations must embed UnimplementedClusterServer
+// for forward compatibility
+type ClusterServer interface {
+	// Unary RPC a follower forwards a command to the leader with
+	Apply(context.Context, *Command) (*ApplyResponse, error)
+	// Unary RPC a new node asks the leader to add it to the cluster with
+	Join(context.Context, *JoinClusterRequest) (*JoinClusterResponse, error)
+	// Unary RPC a leaving node asks the leader to remove it with
+	Leave(context.Context, *LeaveClusterRequest) (*LeaveClusterResponse, error)
+	// Unary RPC to store a message on the node that owns its channel
+	StoreMessage(context.Context, *StoreMessageCommand) (*Message, error)
+	// Unary RPC to edit or delete a message on the node that owns its
+	// channel
+	ChangeMessage(context.Context, *ChangeMessageRequest) (*ApplyResponse, error)
+	// Unary RPC to hand the messages of a channel to its new owner
+	ImportChannel(context.Context, *ImportChannelRequest) (*ImportChannelResponse, error)
+	// Unary RPC the owner of a channel delivers its message events to the
+	// subscribers of the other nodes with
+	Deliver(context.Context, *DeliverRequest) (*DeliverResponse, error)
+	// Unary RPC to read a message from the node that owns its channel
+	FetchMessage(context.Context, *FetchMessageRequest) (*Message, error)
+	// Unary RPC to count the unread messages of a user in channels the
+	// called node owns
+	CountUnread(context.Context, *CountUnreadRequest) (*CountUnreadResponse, error)
+	// Unary RPC to search the channels the called node owns
+	SearchShard(context.Context, *SearchShardRequest) (*SearchShardResponse, error)
+	mustEmbedUnimplementedClusterServer()
 }
 
-// UnimplementedChatServerServer must be embedded to have forward compatible implementations.
-type UnimplementedChatServerServer struct {
+// UnimplementedClusterServer must be embedded to have forward compatible implementations.
+type UnimplementedClusterServer struct {
 }
 
-func (UnimplementedChatServerServer) Login(context.Context, *LoginRequest) (*LoginResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+func (UnimplementedClusterServer) Apply(context.Context, *Command) (*ApplyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Apply not implemented")
 }
-func (UnimplementedChatServerServer) CreateChatServer(context.Context, *CreateChatServerRequest) (*CreateChatServerResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method CreateChatServer not implemented")
+func (UnimplementedClusterServer) Join(context.Context, *JoinClusterRequest) (*JoinClusterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Join not implemented")
 }
-func (UnimplementedChatServerServer) JoinChatServer(context.Context, *JoinChatServerRequest) (*JoinChatServerResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method JoinChatServer not implemented")
+func (UnimplementedClusterServer) Leave(context.Context, *LeaveClusterRequest) (*LeaveClusterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Leave not implemented")
 }
-func (UnimplementedChatServerServer) LeaveChatServer(context.Context, *LeaveChatServerRequest) (*LeaveChatServerResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method LeaveChatServer not implemented")
+func (UnimplementedClusterServer) StoreMessage(context.Context, *StoreMessageCommand) (*Message, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StoreMessage not implemented")
 }
-func (UnimplementedChatServerServer) CreateChannel(context.Context, *CreateChannelRequest) (*CreateChannelResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method CreateChannel not implemented")
+func (UnimplementedClusterServer) ChangeMessage(context.Context, *ChangeMessageRequest) (*ApplyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeMessage not implemented")
 }
-func (UnimplementedChatServerServer) ListMessages(*ListMessagesRequest, ChatServer_ListMessagesServer) error {
-	return status.Errorf(codes.Unimplemented, "method ListMessages not implemented")
+func (UnimplementedClusterServer) ImportChannel(context.Context, *ImportChannelRequest) (*ImportChannelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportChannel not implemented")
 }
-func (UnimplementedChatServerServer) SendMessages(ChatServer_SendMessagesServer) error {
-	return status.Errorf(codes.Unimplemented, "method SendMessages not implemented")
+func (UnimplementedClusterServer) Deliver(context.Context, *DeliverRequest) (*DeliverResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Deliver not implemented")
 }
-func (UnimplementedChatServerServer) Chat(ChatServer_ChatServer) error {
-	return status.Errorf(codes.Unimplemented, "method Chat not implemented")
+func (UnimplementedClusterServer) FetchMessage(context.Context, *FetchMessageRequest) (*Message, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FetchMessage not implemented")
 }
-func (UnimplementedChatServerServer) mustEmbedUnimplementedChatServerServer() {}
+func (UnimplementedClusterServer) CountUnread(context.Context, *CountUnreadRequest) (*CountUnreadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CountUnread not implemented")
+}
+func (UnimplementedClusterServer) SearchShard(context.Context, *SearchShardRequest) (*SearchShardResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchShard not implemented")
+}
+func (UnimplementedClusterServer) mustEmbedUnimplementedClusterServer() {}
 
-// UnsafeChatServerServer may be embedded to opt out of forward compatibility for this service.
-// Use of this interface is not recommended, as added methods to ChatServerServer will
+// UnsafeClusterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ClusterServer will
 // result in compilation errors.
-type UnsafeChatServerServer interface {
-	mustEmbedUnimplementedChatServerServer()
+type UnsafeClusterServer interface {
+	mustEmbedUnimplementedClusterServer()
 }
 
-func RegisterChatServerServer(s grpc.ServiceRegistrar, srv ChatServerServer) {
-	s.RegisterService(&ChatServer_ServiceDesc, srv)
+func RegisterClusterServer(s grpc.ServiceRegistrar, srv ClusterServer) {
+	s.RegisterService(&Cluster_ServiceDesc, srv)
 }
 
-func _ChatServer_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(LoginRequest)
+func _Cluster_Apply_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Command)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(ChatServerServer).Login(ctx, in)
+		return srv.(ClusterServer).Apply(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/pb.ChatServer/Login",
+		FullMethod: "/pb.Cluster/Apply",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ChatServerServer).Login(ctx, req.(*LoginRequest))
+		return srv.(ClusterServer).Apply(ctx, req.(*Command))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _ChatServer_CreateChatServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(CreateChatServerRequest)
+func _Cluster_Join_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JoinClusterRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(ChatServerServer).CreateChatServer(ctx, in)
+		return srv.(ClusterServer).Join(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/pb.ChatServer/CreateChatServer",
+		FullMethod: "/pb.Cluster/Join",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ChatServerServer).CreateChatServer(ctx, req.(*CreateChatServerRequest))
+		return srv.(ClusterServer).Join(ctx, req.(*JoinClusterRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _ChatServer_JoinChatServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(JoinChatServerRequest)
+func _Cluster_Leave_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaveClusterRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(ChatServerServer).JoinChatServer(ctx, in)
+		return srv.(ClusterServer).Leave(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/pb.ChatServer/JoinChatServer",
+		FullMethod: "/pb.Cluster/Leave",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ChatServerServer).JoinChatServer(ctx, req.(*JoinChatServerRequest))
+		return srv.(ClusterServer).Leave(ctx, req.(*LeaveClusterRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _ChatServer_LeaveChatServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(LeaveChatServerRequest)
+func _Cluster_StoreMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StoreMessageCommand)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(ChatServerServer).LeaveChatServer(ctx, in)
+		return srv.(ClusterServer).StoreMessage(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/pb.ChatServer/LeaveChatServer",
+		FullMethod: "/pb.Cluster/StoreMessage",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ChatServerServer).LeaveChatServer(ctx, req.(*LeaveChatServerRequest))
+		return srv.(ClusterServer).StoreMessage(ctx, req.(*StoreMessageCommand))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _ChatServer_CreateChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(CreateChannelRequest)
+func _Cluster_ChangeMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeMessageRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(ChatServerServer).CreateChannel(ctx, in)
+		return srv.(ClusterServer).ChangeMessage(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/pb.ChatServer/CreateChannel",
+		FullMethod: "/pb.Cluster/ChangeMessage",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ChatServerServer).CreateChannel(ctx, req.(*CreateChannelRequest))
+		return srv.(ClusterServer).ChangeMessage(ctx, req.(*ChangeMessageRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _ChatServer_ListMessages_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(ListMessagesRequest)
-	if err := stream.RecvMsg(m); err != nil {
-		return err
+func _Cluster_ImportChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportChannelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
 	}
-	return srv.(ChatServerServer).ListMessages(m, &chatServerListMessagesServer{stream})
-}
-
-type ChatServer_ListMessagesServer interface {
-	Send(*Message) error
-	grpc.ServerStream
-}
-
-type chatServerListMessagesServer struct {
-	grpc.ServerStream
-}
-
-func (x *chatServerListMessagesServer) Send(m *Message) error {
-	return x.ServerStream.SendMsg(m)
-}
-
-func _ChatServer_SendMessages_Handler(srv interface{}, stream grpc.ServerStream) error {
-	return srv.(ChatServerServer).SendMessages(&chatServerSendMessagesServer{stream})
-}
-
-type ChatServer_SendMessagesServer interface {
-	SendAndClose(*SendMessagesResponse) error
-	Recv() (*SendMessageRequest, error)
-	grpc.ServerStream
-}
-
-type chatServerSendMessagesServer struct {
-	grpc.ServerStream
-}
-
-func (x *chatServerSendMessagesServer) SendAndClose(m *SendMessagesResponse) error {
-	return x.ServerStream.SendMsg(m)
+	if interceptor == nil {
+		return srv.(ClusterServer).ImportChannel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Cluster/ImportChannel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).ImportChannel(ctx, req.(*ImportChannelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (x *chatServerSendMessagesServer) Recv() (*SendMessageRequest, error) {
-	m := new(SendMessageRequest)
-	if err := x.ServerStream.RecvMsg(m); err != nil {
+func _Cluster_Deliver_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeliverRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return m, nil
-}
-
-func _ChatServer_Chat_Handler(srv interface{}, stream grpc.ServerStream) error {
-	return srv.(ChatServerServer).Chat(&chatServerChatServer{stream})
-}
-
-type ChatServer_ChatServer interface {
-	Send(*ChatMessage) error
-	Recv() (*ChatMessage, error)
-	grpc.ServerStream
+	if interceptor == nil {
+		return srv.(ClusterServer).Deliver(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Cluster/Deliver",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).Deliver(ctx, req.(*DeliverRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-type chatServerChatServer struct {
-	grpc.ServerStream
+func _Cluster_FetchMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FetchMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).FetchMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Cluster/FetchMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).FetchMessage(ctx, req.(*FetchMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (x *chatServerChatServer) Send(m *ChatMessage) error {
-	return x.ServerStream.SendMsg(m)
+func _Cluster_CountUnread_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CountUnreadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).CountUnread(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Cluster/CountUnread",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).CountUnread(ctx, req.(*CountUnreadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (x *chatServerChatServer) Recv() (*ChatMessage, error) {
-	m := new(ChatMessage)
-	if err := x.ServerStream.RecvMsg(m); err != nil {
+func _Cluster_SearchShard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchShardRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return m, nil
+	if interceptor == nil {
+		return srv.(ClusterServer).SearchShard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Cluster/SearchShard",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).SearchShard(ctx, req.(*SearchShardRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-// ChatServer_ServiceDesc is the grpc.ServiceDesc for ChatServer service.
+// Cluster_ServiceDesc is the grpc.ServiceDesc for Cluster service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
-var ChatServer_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "pb.ChatServer",
-	HandlerType: (*ChatServerServer)(nil),
+var Cluster_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.Cluster",
+	HandlerType: (*ClusterServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
-			MethodName: "Login",
-			Handler:    _ChatServer_Login_Handler,
+			MethodName: "Apply",
+			Handler:    _Cluster_Apply_Handler,
 		},
 		{
-			MethodName: "CreateChatServer",
-			Handler:    _ChatServer_CreateChatServer_Handler,
+			MethodName: "Join",
+			Handler:    _Cluster_Join_Handler,
 		},
 		{
-			MethodName: "JoinChatServer",
-			Handler:    _ChatServer_JoinChatServer_Handler,
+			MethodName: "Leave",
+			Handler:    _Cluster_Leave_Handler,
 		},
 		{
-			MethodName: "LeaveChatServer",
-			Handler:    _ChatServer_LeaveChatServer_Handler,
+			MethodName: "StoreMessage",
+			Handler:    _Cluster_StoreMessage_Handler,
 		},
 		{
-			MethodName: "CreateChannel",
-			Handler:    _ChatServer_CreateChannel_Handler,
+			MethodName: "ChangeMessage",
+			Handler:    _Cluster_ChangeMessage_Handler,
 		},
-	},
-	Streams: []grpc.StreamDesc{
 		{
-			StreamName:    "ListMessages",
-			Handler:       _ChatServer_ListMessages_Handler,
-			ServerStreams: true,
+			MethodName: "ImportChannel",
+			Handler:    _Cluster_ImportChannel_Handler,
 		},
 		{
-			StreamName:    "SendMessages",
-			Handler:       _ChatServer_SendMessages_Handler,
-			ClientStreams: true,
+			MethodName: "Deliver",
+			Handler:    _Cluster_Deliver_Handler,
 		},
 		{
-			StreamName:    "Chat",
-			Handler:       _ChatServer_Chat_Handler,
-			ServerStreams: true,
-			ClientStreams: true,
+			MethodName: "FetchMessage",
+			Handler:    _Cluster_FetchMessage_Handler,
+		},
+		{
+			MethodName: "CountUnread",
+			Handler:    _Cluster_CountUnread_Handler,
+		},
+		{
+			MethodName: "SearchShard",
+			Handler:    _Cluster_SearchShard_Handler,
 		},
 	},
+	Streams:  []grpc.StreamDesc{},
 	Metadata: "pb/app.proto",
 }
@@ -0,0 +1,345 @@
+// Package bot helps write bots for the chat server. A bot authenticates with
+// the API key returned by CreateBot, follows the events of a chat server and
+// routes commands and mentions to handler funcs:
+//
+//	conn, _ := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	b := bot.New(pb.NewChatServerClient(conn), "deploybot", apiKey)
+//	b.Command("deploy", func(ctx context.Context, m *bot.Message) {
+//		m.Reply(ctx, "Deploying "+strings.Join(m.Args, " "))
+//	})
+//	log.Fatal(b.Run(ctx, serverID))
+//
+// Commands are messages starting with the command prefix, !deploy by
+// default, or mentions of the bot followed by a command name. Messages
+// starting with / are run by the server itself and never reach bots.
+package bot
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// HandlerFunc handles a message routed to the bot. Every call runs in its
+// own goroutine so a slow handler does not hold up the event stream. ctx is
+// the context passed to Run, so handlers outlive reconnects of the stream.
+type HandlerFunc func(ctx context.Context, m *Message)
+
+// Message is a message routed to a handler.
+type Message struct {
+	*pb.Message
+	ServerID  string
+	ChannelID string
+	// Args holds the words following the command name, or the words of a
+	// mention without the mention itself.
+	Args []string
+
+	bot *Bot
+}
+
+// Reply posts text to the channel the message was posted in.
+func (m *Message) Reply(ctx context.Context, text string) error {
+	return m.bot.send(ctx, m.ServerID, m.ChannelID, text, "")
+}
+
+// ReplyPrivately posts text to the channel the message was posted in, visible
+// only to its author.
+func (m *Message) ReplyPrivately(ctx context.Context, text string) error {
+	return m.bot.send(ctx, m.ServerID, m.ChannelID, text, m.GetUsername())
+}
+
+// Bot is a bot account connected to a chat server. Register handlers before
+// calling Run.
+type Bot struct {
+	client pb.ChatServerClient
+	name   string
+	apiKey string
+
+	// Prefix starts a command, "!" unless changed.
+	Prefix string
+	// MinBackoff and MaxBackoff bound the delay between reconnects.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Logger receives connection errors, log.Default() unless set.
+	Logger *log.Logger
+
+	commands map[string]HandlerFunc
+	mention  HandlerFunc
+	message  HandlerFunc
+}
+
+// New returns a bot that authenticates as name with apiKey.
+func New(client pb.ChatServerClient, name, apiKey string) *Bot {
+	return &Bot{
+		client:     client,
+		name:       name,
+		apiKey:     apiKey,
+		Prefix:     "!",
+		MinBackoff: time.Second,
+		MaxBackoff: 30 * time.Second,
+		Logger:     log.Default(),
+		commands:   make(map[string]HandlerFunc),
+	}
+}
+
+// Name returns the name of the bot account.
+func (b *Bot) Name() string {
+	return b.name
+}
+
+// Command routes the command name to h.
+func (b *Bot) Command(name string, h HandlerFunc) {
+	b.commands[strings.ToLower(name)] = h
+}
+
+// OnMention routes mentions of the bot that are not commands to h.
+func (b *Bot) OnMention(h HandlerFunc) {
+	b.mention = h
+}
+
+// OnMessage routes every other message to h.
+func (b *Bot) OnMessage(h HandlerFunc) {
+	b.message = h
+}
+
+// Client returns the client the bot uses. Calls made with it must use a
+// context from Context to be authenticated as the bot.
+func (b *Bot) Client() pb.ChatServerClient {
+	return b.client
+}
+
+// Context returns ctx carrying the API key of the bot.
+func (b *Bot) Context(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "x-api-key", b.apiKey)
+}
+
+// Join adds the bot to a chat server.
+func (b *Bot) Join(ctx context.Context, serverID string) error {
+	_, err := b.client.JoinChatServer(b.Context(ctx), &pb.JoinChatServerRequest{
+		ServerId: serverID,
+		Username: b.name,
+	})
+	return err
+}
+
+// Send posts text to a channel.
+func (b *Bot) Send(ctx context.Context, serverID, channelID, text string) error {
+	return b.send(ctx, serverID, channelID, text, "")
+}
+
+func (b *Bot) send(ctx context.Context, serverID, channelID, text, visibleTo string) error {
+	stream, err := b.client.SendMessages(b.Context(ctx))
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&pb.SendMessageRequest{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Username:  b.name,
+		Text:      text,
+		VisibleTo: visibleTo,
+	}); err != nil && err != io.EOF {
+		return err
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// Run follows the events of a chat server and dispatches messages to the
+// handlers until ctx is done or the server rejects the bot. When channelIDs
+// are given only those channels are followed. Run reconnects with
+// exponential backoff when the stream breaks and replays the messages posted
+// in the meantime.
+func (b *Bot) Run(ctx context.Context, serverID string, channelIDs ...string) error {
+	r := &runner{
+		bot:      b,
+		ctx:      ctx,
+		serverID: serverID,
+		lastSeq:  make(map[string]int64),
+	}
+	if len(channelIDs) > 0 {
+		r.channels = make(map[string]bool)
+		for _, id := range channelIDs {
+			r.channels[id] = true
+		}
+	}
+	defer r.handlers.Wait()
+
+	backoff := b.MinBackoff
+	for {
+		received, err := r.follow(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if code := status.Code(err); code == codes.Unauthenticated || code == codes.NotFound || code == codes.PermissionDenied {
+			return err
+		}
+		if received {
+			backoff = b.MinBackoff
+		}
+		b.Logger.Printf("bot %s: event stream broke: %v, reconnecting in %s", b.name, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > b.MaxBackoff {
+			backoff = b.MaxBackoff
+		}
+	}
+}
+
+// runner is a single Run of a bot.
+type runner struct {
+	bot *Bot
+	// ctx is the context of Run, handed to handlers
+	ctx      context.Context
+	serverID string
+	channels map[string]bool
+	// lastSeq holds the seq of the last message seen in each channel
+	lastSeq  map[string]int64
+	handlers sync.WaitGroup
+}
+
+// follow subscribes to the chat server and dispatches events until the
+// stream breaks. It reports whether any event was received.
+func (r *runner) follow(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := r.bot.client.Subscribe(r.bot.Context(ctx), &pb.SubscribeRequest{ServerId: r.serverID})
+	if err != nil {
+		return false, err
+	}
+
+	// Catch up on what was posted while the bot was disconnected. Events
+	// received meanwhile are deduplicated by seq.
+	if err := r.catchUp(ctx); err != nil {
+		return false, err
+	}
+
+	received := false
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return received, err
+		}
+		received = true
+		if created := event.GetMessageCreated(); created != nil {
+			r.dispatch(created.GetChannelId(), created.GetMessage())
+		}
+	}
+}
+
+func (r *runner) catchUp(ctx context.Context) error {
+	for channelID := range r.lastSeq {
+		stream, err := r.bot.client.ListMessages(r.bot.Context(ctx), &pb.ListMessagesRequest{
+			ServerId:  r.serverID,
+			ChannelId: channelID,
+		})
+		if err != nil {
+			return err
+		}
+		for {
+			msg, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			r.dispatch(channelID, msg)
+		}
+	}
+	return nil
+}
+
+// dispatch routes a message to the matching handler, if any.
+func (r *runner) dispatch(channelID string, msg *pb.Message) {
+	if r.channels != nil && !r.channels[channelID] {
+		return
+	}
+	// Ephemeral messages have no seq and are never replayed
+	if msg.GetSeq() > 0 {
+		if msg.GetSeq() <= r.lastSeq[channelID] {
+			return
+		}
+		r.lastSeq[channelID] = msg.GetSeq()
+	}
+	if msg.GetUsername() == r.bot.name {
+		return
+	}
+
+	h, args := r.bot.route(msg)
+	if h == nil {
+		return
+	}
+	m := &Message{
+		Message:   msg,
+		ServerID:  r.serverID,
+		ChannelID: channelID,
+		Args:      args,
+		bot:       r.bot,
+	}
+
+	r.handlers.Add(1)
+	go func() {
+		defer r.handlers.Done()
+		h(r.ctx, m)
+	}()
+}
+
+// route picks the handler for a message and the arguments to pass it.
+func (b *Bot) route(msg *pb.Message) (HandlerFunc, []string) {
+	text := strings.TrimSpace(msg.GetText())
+
+	if b.Prefix != "" && strings.HasPrefix(text, b.Prefix) {
+		words := strings.Fields(text[len(b.Prefix):])
+		if len(words) > 0 {
+			if h, ok := b.commands[strings.ToLower(words[0])]; ok {
+				return h, words[1:]
+			}
+		}
+	}
+
+	if b.mentioned(msg) {
+		var words []string
+		for _, word := range strings.Fields(text) {
+			if !strings.EqualFold(strings.TrimRight(word, ",:"), "@"+b.name) {
+				words = append(words, word)
+			}
+		}
+		if len(words) > 0 {
+			if h, ok := b.commands[strings.ToLower(words[0])]; ok {
+				return h, words[1:]
+			}
+		}
+		if b.mention != nil {
+			return b.mention, words
+		}
+	}
+
+	if b.message != nil {
+		return b.message, strings.Fields(text)
+	}
+	return nil, nil
+}
+
+func (b *Bot) mentioned(msg *pb.Message) bool {
+	for _, mention := range msg.GetMentions() {
+		if mention.GetKind() == pb.Mention_USER && mention.GetTarget() == b.name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+var (
+	attachmentsDir    = flag.String("attachments-dir", "attachments", "Directory where uploaded attachments are stored")
+	maxAttachmentSize = flag.Int64("max-attachment-size", 10<<20, "Maximum size of an uploaded attachment in bytes")
+)
+
+// attachmentChunkSize is the size of the chunks attachments are sent in.
+const attachmentChunkSize = 32 << 10
+
+// storedAttachment is an uploaded attachment along with who may see it.
+type storedAttachment struct {
+	info     *pb.Attachment
+	uploader string
+	// servers holds the chat servers the attachment was posted in
+	servers map[string]bool
+}
+
+func (s *server) UploadAttachment(stream pb.ChatServer_UploadAttachmentServer) error {
+	username, ok := s.userFromContext(stream.Context())
+	if !ok {
+		return grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return grpc.Errorf(codes.InvalidArgument, "missing attachment info")
+	}
+	if err != nil {
+		return err
+	}
+
+	info := first.GetInfo()
+	if info == nil {
+		return grpc.Errorf(codes.InvalidArgument, "the first frame must carry the attachment info")
+	}
+	if info.GetSize() < 0 || info.GetSize() > *maxAttachmentSize {
+		return grpc.Errorf(codes.InvalidArgument, "attachments must be at most %d bytes", *maxAttachmentSize)
+	}
+	checksum, err := hex.DecodeString(info.GetSha256())
+	if err != nil || len(checksum) != sha256.Size {
+		return grpc.Errorf(codes.InvalidArgument, "invalid sha256 checksum")
+	}
+
+	id := uuid.New().String()
+	w, err := s.blobs.Create(id)
+	if err != nil {
+		return grpc.Errorf(codes.Internal, "failed to store attachment: %v", err)
+	}
+
+	head, err := receiveAttachment(stream, w, info.GetSize(), checksum)
+	if closeErr := w.Close(); err == nil && closeErr != nil {
+		err = grpc.Errorf(codes.Internal, "failed to store attachment: %v", closeErr)
+	}
+	if err != nil {
+		s.blobs.Delete(id)
+		return err
+	}
+
+	attachment := &pb.Attachment{
+		Id:          id,
+		Filename:    filepath.Base(info.GetFilename()),
+		ContentType: info.GetContentType(),
+		Size:        info.GetSize(),
+		Sha256:      info.GetSha256(),
+	}
+	if attachment.ContentType == "" {
+		attachment.ContentType = http.DetectContentType(head)
+	}
+
+	s.mu.Lock()
+	s.attachments[id] = &storedAttachment{
+		info:     attachment,
+		uploader: username,
+		servers:  make(map[string]bool),
+	}
+	s.mu.Unlock()
+
+	return stream.SendAndClose(&pb.UploadAttachmentResponse{Attachment: attachment})
+}
+
+// receiveAttachment copies the chunks of an upload to w, checking them
+// against the declared size and checksum. It returns the first bytes of the
+// contents for content type detection.
+func receiveAttachment(stream pb.ChatServer_UploadAttachmentServer, w io.Writer, size int64, checksum []byte) ([]byte, error) {
+	hash := sha256.New()
+	var head []byte
+	var received int64
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		chunk := req.GetChunk()
+		received += int64(len(chunk))
+		if received > size {
+			return nil, grpc.Errorf(codes.InvalidArgument, "attachment is larger than declared")
+		}
+		if len(head) < 512 {
+			head = append(head, chunk[:min(len(chunk), 512-len(head))]...)
+		}
+
+		hash.Write(chunk)
+		if _, err := w.Write(chunk); err != nil {
+			return nil, grpc.Errorf(codes.Internal, "failed to store attachment: %v", err)
+		}
+	}
+
+	if received != size {
+		return nil, grpc.Errorf(codes.InvalidArgument, "attachment is smaller than declared")
+	}
+	if !bytes.Equal(hash.Sum(nil), checksum) {
+		return nil, grpc.Errorf(codes.DataLoss, "attachment checksum mismatch")
+	}
+	return head, nil
+}
+
+func (s *server) DownloadAttachment(req *pb.DownloadAttachmentRequest, stream pb.ChatServer_DownloadAttachmentServer) error {
+	username, ok := s.userFromContext(stream.Context())
+	if !ok {
+		return grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	attachment, exists := s.attachments[req.GetAttachmentId()]
+	allowed := exists && s.canAccessAttachment(attachment, username)
+	s.mu.Unlock()
+	if !exists {
+		return grpc.Errorf(codes.NotFound, "attachment not found")
+	}
+	if !allowed {
+		return grpc.Errorf(codes.PermissionDenied, "not allowed to download this attachment")
+	}
+
+	r, err := s.blobs.Open(attachment.info.GetId())
+	if err != nil {
+		return grpc.Errorf(codes.Internal, "failed to open attachment: %v", err)
+	}
+	defer r.Close()
+
+	if err := stream.Send(&pb.DownloadAttachmentResponse{
+		Data: &pb.DownloadAttachmentResponse_Info{Info: attachment.info},
+	}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, attachmentChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&pb.DownloadAttachmentResponse{
+				Data: &pb.DownloadAttachmentResponse_Chunk{Chunk: buf[:n]},
+			}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return grpc.Errorf(codes.Internal, "failed to read attachment: %v", err)
+		}
+	}
+}
+
+// canAccessAttachment reports whether the user uploaded the attachment or
+// belongs to a chat server it was posted in. The caller must hold s.mu.
+func (s *server) canAccessAttachment(attachment *storedAttachment, username string) bool {
+	if attachment.uploader == username {
+		return true
+	}
+	for serverID := range attachment.servers {
+		if s.isMember(serverID, username) {
+			return true
+		}
+	}
+	return false
+}
+
+// attachmentsFor resolves the attachments referenced by a message posted to
+// a chat server by the authenticated sender, who must be allowed to access
+// each of them. The caller must hold s.mu.
+func (s *server) attachmentsFor(serverID, sender string, ids []string) ([]*pb.Attachment, error) {
+	var attachments []*pb.Attachment
+	for _, id := range ids {
+		attachment, ok := s.attachments[id]
+		if !ok {
+			return nil, grpc.Errorf(codes.InvalidArgument, "unknown attachment %s", id)
+		}
+		if !s.canAccessAttachment(attachment, sender) {
+			return nil, grpc.Errorf(codes.PermissionDenied, "not allowed to post attachment %s", id)
+		}
+		attachment.servers[serverID] = true
+		attachments = append(attachments, attachment.info)
+	}
+	return attachments, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/codes"
+)
+
+// upload uploads an attachment and returns its id.
+func upload(t *testing.T, client pb.ChatServerClient, ctx context.Context, data []byte) string {
+	t.Helper()
+
+	stream, err := client.UploadAttachment(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	stream.Send(&pb.UploadAttachmentRequest{Data: &pb.UploadAttachmentRequest_Info{Info: &pb.Attachment{
+		Filename: "notes.txt",
+		Size:     int64(len(data)),
+		Sha256:   hex.EncodeToString(sum[:]),
+	}}})
+	stream.Send(&pb.UploadAttachmentRequest{Data: &pb.UploadAttachmentRequest_Chunk{Chunk: data}})
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.GetAttachment().GetId()
+}
+
+func TestAttachmentsArePostedByTheirUploader(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, mallory := login(t, client, "alice"), login(t, client, "mallory")
+	serverID, channelID := testChannel(t, client, alice)
+	otherServerID, otherChannelID := testChannel(t, client, mallory)
+	id := upload(t, client, alice, []byte("secret plans"))
+
+	err := send(mallory, client, &pb.SendMessageRequest{ServerId: otherServerID, ChannelId: otherChannelID, Username: "alice", AttachmentIds: []string{id}})
+	wantCode(t, err, codes.PermissionDenied)
+	err = send(mallory, client, &pb.SendMessageRequest{ServerId: otherServerID, ChannelId: otherChannelID, AttachmentIds: []string{id}})
+	wantCode(t, err, codes.PermissionDenied)
+
+	stream, err := client.DownloadAttachment(mallory, &pb.DownloadAttachmentRequest{AttachmentId: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	wantCode(t, err, codes.PermissionDenied)
+
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, AttachmentIds: []string{id}}); err != nil {
+		t.Fatal(err)
+	}
+	messages := listMessages(t, client, alice, serverID, channelID)
+	if len(messages) != 1 || len(messages[0].GetAttachments()) != 1 {
+		t.Fatalf("messages = %v", messages)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// BlobStore keeps the contents of attachments. Blobs are addressed by the
+// attachment id and are never modified once written.
+type BlobStore interface {
+	Create(id string) (io.WriteCloser, error)
+	Open(id string) (io.ReadCloser, error)
+	Delete(id string) error
+}
+
+// localBlobStore stores each blob as a file in a directory.
+type localBlobStore struct {
+	dir string
+}
+
+func newLocalBlobStore(dir string) (*localBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &localBlobStore{dir: dir}, nil
+}
+
+func (b *localBlobStore) path(id string) string {
+	// Ids are generated by the server, but never let one escape the directory
+	return filepath.Join(b.dir, filepath.Base(id))
+}
+
+func (b *localBlobStore) Create(id string) (io.WriteCloser, error) {
+	return os.OpenFile(b.path(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+}
+
+func (b *localBlobStore) Open(id string) (io.ReadCloser, error) {
+	return os.Open(b.path(id))
+}
+
+func (b *localBlobStore) Delete(id string) error {
+	err := os.Remove(b.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
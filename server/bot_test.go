@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/Melo04/grpc-chat/pkg/bot"
+	"google.golang.org/grpc"
+)
+
+// droppingClient is a client whose event streams can be broken on demand.
+type droppingClient struct {
+	pb.ChatServerClient
+
+	mu            sync.Mutex
+	subscriptions int
+	cancel        context.CancelFunc
+}
+
+func (c *droppingClient) Subscribe(ctx context.Context, req *pb.SubscribeRequest, opts ...grpc.CallOption) (pb.ChatServer_SubscribeClient, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	c.mu.Lock()
+	c.subscriptions++
+	c.cancel = cancel
+	c.mu.Unlock()
+	return c.ChatServerClient.Subscribe(ctx, req, opts...)
+}
+
+// drop breaks the current event stream.
+func (c *droppingClient) drop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+func (c *droppingClient) subscribed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscriptions
+}
+
+func TestBotAnswersCommandsAcrossReconnects(t *testing.T) {
+	_, client := startTestServer(t)
+	alice := login(t, client, "alice")
+	serverID, channelID := testChannel(t, client, alice)
+	created, err := client.CreateBot(alice, &pb.CreateBotRequest{Name: "echo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &droppingClient{ChatServerClient: client}
+	b := bot.New(conn, "echo", created.GetApiKey())
+	b.MinBackoff = 10 * time.Millisecond
+	b.Logger = log.New(io.Discard, "", 0)
+	b.Command("echo", func(ctx context.Context, m *bot.Message) {
+		m.Reply(ctx, strings.Join(m.Args, " "))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := b.Join(ctx, serverID); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx, serverID) }()
+
+	replies := func() []string {
+		var texts []string
+		for _, msg := range listMessages(t, client, alice, serverID, channelID) {
+			if msg.GetUsername() == "echo" {
+				texts = append(texts, msg.GetText())
+			}
+		}
+		return texts
+	}
+	eventually(t, 2*time.Second, func() bool { return conn.subscribed() == 1 })
+	time.Sleep(50 * time.Millisecond)
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "!echo one"}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, 2*time.Second, func() bool { return len(replies()) == 1 })
+
+	// A command posted while the stream is down is caught up on, and the
+	// one already answered is not answered again
+	conn.drop()
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "!echo two"}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, 2*time.Second, func() bool { return len(replies()) == 2 })
+	if got := replies(); got[0] != "one" || got[1] != "two" || conn.subscribed() < 2 {
+		t.Fatalf("got replies %q after %d subscriptions, want one and two after reconnecting", got, conn.subscribed())
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned %v once its context was done", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return once its context was done")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// apiKeyHeader is the metadata key bots send their API key in.
+const apiKeyHeader = "x-api-key"
+
+// maxBotsPerUser limits how many bot accounts a user can own.
+const maxBotsPerUser = 10
+
+// storedBot is a bot account along with the hash of its API key.
+type storedBot struct {
+	info    *pb.Bot
+	keyHash string
+}
+
+// hashSecret returns the hash API keys and tokens are stored as.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSecret returns a random API key or token with the given prefix.
+func newSecret(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// CreateBot creates a bot account owned by the caller. Bot names share the
+// namespace of usernames so a bot can be mentioned and invited like a user.
+func (s *server) CreateBot(ctx context.Context, req *pb.CreateBotRequest) (*pb.CreateBotResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if s.isBot(username) {
+		return nil, grpc.Errorf(codes.PermissionDenied, "bots cannot create bots")
+	}
+
+	name := req.GetName()
+	if name == "" || strings.ContainsAny(name, " \t@") || name == commandBot {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid bot name")
+	}
+
+	key, err := newSecret("bot_")
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "failed to generate API key: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[name]; exists {
+		return nil, grpc.Errorf(codes.AlreadyExists, "name %s is taken", name)
+	}
+	if _, exists := s.bots[name]; exists {
+		return nil, grpc.Errorf(codes.AlreadyExists, "name %s is taken", name)
+	}
+
+	owned := 0
+	for _, bot := range s.bots {
+		if bot.info.GetOwner() == username {
+			owned++
+		}
+	}
+	if owned >= maxBotsPerUser {
+		return nil, grpc.Errorf(codes.ResourceExhausted, "a user can own at most %d bots", maxBotsPerUser)
+	}
+
+	bot := &pb.Bot{
+		Name:      name,
+		Owner:     username,
+		CreatedAt: timestamppb.Now(),
+	}
+	_, err = s.commit(&pb.Command{Payload: &pb.Command_CreateBot{CreateBot: &pb.CreateBotCommand{
+		Bot:     bot,
+		KeyHash: hashSecret(key),
+	}}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CreateBotResponse{Bot: bot, ApiKey: key}, nil
+}
+
+func (s *server) ListBots(ctx context.Context, req *pb.ListBotsRequest) (*pb.ListBotsResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bots []*pb.Bot
+	for _, bot := range s.bots {
+		if bot.info.GetOwner() == username {
+			bots = append(bots, bot.info)
+		}
+	}
+	sort.Slice(bots, func(i, j int) bool { return bots[i].GetName() < bots[j].GetName() })
+
+	return &pb.ListBotsResponse{Bots: bots}, nil
+}
+
+// DeleteBot deletes a bot account, revoking its API key and removing it from
+// every chat server.
+func (s *server) DeleteBot(ctx context.Context, req *pb.DeleteBotRequest) (*pb.DeleteBotResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bot, exists := s.bots[req.GetName()]
+	if !exists || bot.info.GetOwner() != username {
+		return nil, grpc.Errorf(codes.NotFound, "bot not found")
+	}
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_DeleteBot{DeleteBot: &pb.DeleteBotCommand{
+		Name: req.GetName(),
+	}}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.DeleteBotResponse{}, nil
+}
+
+// botFromContext returns the bot owning the API key in the request metadata.
+// The caller must hold s.mu.
+func (s *server) botFromContext(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	keys := md[apiKeyHeader]
+	if len(keys) == 0 {
+		return "", false
+	}
+	name, ok := s.botKeys[hashSecret(keys[0])]
+	return name, ok
+}
+
+// isBot reports whether the name belongs to a bot account. The caller must
+// hold s.mu.
+func (s *server) isBot(name string) bool {
+	_, ok := s.bots[name]
+	return ok
+}
+
+// botDeleted reports whether the user authenticated as a bot that has been
+// deleted since.
+func (s *server) botDeleted(username string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, isUser := s.users[username]
+	return !isUser && !s.isBot(username)
+}
+
+// checkSender rejects a request naming a sender other than the caller, be it
+// a user, a bot or a federated user@peer. Messages are always posted as the
+// caller, so an empty username is fine.
+func checkSender(caller, username string) error {
+	if username != "" && username != caller {
+		return grpc.Errorf(codes.PermissionDenied, "cannot post as %s", username)
+	}
+	return nil
+}
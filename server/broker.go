@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/proto"
+)
+
+var brokerURL = flag.String("broker", "", "URL of the message broker replicas exchange events through, such as redis://localhost:6379, empty keeps events within this process. Only events are shared, not users, chat servers or messages")
+
+const (
+	// redisBrokerChannel is the Redis pub/sub channel events are published
+	// on.
+	redisBrokerChannel = "grpc-chat.events"
+	// redisPublishQueue is how many events may wait to be published to
+	// Redis before new ones only reach this replica.
+	redisPublishQueue = 1024
+	// redisPublishTimeout limits publishing a single event to Redis.
+	redisPublishTimeout = 5 * time.Second
+)
+
+// Broker carries events between the replicas of the server, so that streams
+// connected to one replica see the events published on every other. Every
+// replica receives every event, its own included, in the same order.
+//
+// A broker only shares events. Each replica keeps its own users, chat
+// servers, channels and messages, so a stream on one replica sees the events
+// of a chat server on another replica only if both replicas know the chat
+// server and the user. Replicas sharing their state are a Raft cluster
+// instead, see -raft-id, whose nodes publish the events of the replicated
+// log themselves.
+type Broker interface {
+	// Publish hands an event to every replica. It is called while locks of
+	// the server are held, so it must not wait for the network. An error
+	// means the event did not leave this replica.
+	Publish(event *pb.Event) error
+	// Subscribe registers deliver to be called with every event published
+	// by any replica. deliver must not block.
+	Subscribe(deliver func(*pb.Event))
+}
+
+// newBroker returns the broker for the given URL, or an in-process broker if
+// it is empty.
+func newBroker(rawURL string) (Broker, error) {
+	if rawURL == "" {
+		return &localBroker{}, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker URL: %w", err)
+	}
+	switch u.Scheme {
+	case "redis", "rediss":
+		return newRedisBroker(rawURL)
+	default:
+		return nil, fmt.Errorf("unsupported broker %q", u.Scheme)
+	}
+}
+
+// localBroker delivers events within the process, for a single replica.
+type localBroker struct {
+	mu      sync.Mutex
+	deliver []func(*pb.Event)
+}
+
+func (b *localBroker) Publish(event *pb.Event) error {
+	b.mu.Lock()
+	deliver := b.deliver
+	b.mu.Unlock()
+
+	for _, fn := range deliver {
+		fn(event)
+	}
+	return nil
+}
+
+func (b *localBroker) Subscribe(deliver func(*pb.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deliver = append(b.deliver, deliver)
+}
+
+// redisBroker exchanges events over a Redis pub/sub channel. Redis hands the
+// messages of a channel to every subscriber in the order they were published.
+// Events are published from a queue, so a slow or unreachable Redis does not
+// hold up the server.
+type redisBroker struct {
+	client *redis.Client
+	queue  chan redisEvent
+
+	mu      sync.Mutex
+	deliver []func(*pb.Event)
+}
+
+// redisEvent is an event waiting to be published, marshaled when it was
+// queued since its message may change afterwards.
+type redisEvent struct {
+	event *pb.Event
+	data  []byte
+}
+
+func newRedisBroker(rawURL string) (*redisBroker, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	// Wait for the subscription, so no event published once the server is
+	// up is missed
+	pubsub := client.Subscribe(context.Background(), redisBrokerChannel)
+	if _, err := pubsub.Receive(context.Background()); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to subscribe to Redis: %w", err)
+	}
+
+	b := &redisBroker{
+		client: client,
+		queue:  make(chan redisEvent, redisPublishQueue),
+	}
+	go b.receive(pubsub)
+	go b.publish()
+	return b, nil
+}
+
+// Publish queues an event to be published to Redis. It fails if the queue is
+// full, like while Redis is unreachable.
+func (b *redisBroker) Publish(event *pb.Event) error {
+	data, err := proto.Marshal(event)
+	if err != nil {
+		return err
+	}
+	select {
+	case b.queue <- redisEvent{event: event, data: data}:
+		return nil
+	default:
+		return fmt.Errorf("the Redis publish queue is full")
+	}
+}
+
+// publish publishes the queued events to Redis in order. An event Redis does
+// not take in time only reaches the subscribers of this replica.
+func (b *redisBroker) publish() {
+	for queued := range b.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), redisPublishTimeout)
+		err := b.client.Publish(ctx, redisBrokerChannel, queued.data).Err()
+		cancel()
+		if err != nil {
+			log.Printf("Failed to publish event for server %s to Redis, delivering it on this replica only: %v", queued.event.GetServerId(), err)
+			b.handOut(queued.event)
+		}
+	}
+}
+
+func (b *redisBroker) Subscribe(deliver func(*pb.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deliver = append(b.deliver, deliver)
+}
+
+// receive hands the events arriving on the subscription to the subscribers.
+// The client resubscribes by itself after losing the connection; events
+// published in the meantime are missed.
+func (b *redisBroker) receive(pubsub *redis.PubSub) {
+	for msg := range pubsub.Channel() {
+		event := &pb.Event{}
+		if err := proto.Unmarshal([]byte(msg.Payload), event); err != nil {
+			log.Printf("Dropping malformed event from Redis: %v", err)
+			continue
+		}
+		b.handOut(event)
+	}
+}
+
+// handOut hands an event to the subscribers of this replica.
+func (b *redisBroker) handOut(event *pb.Event) {
+	b.mu.Lock()
+	deliver := b.deliver
+	b.mu.Unlock()
+
+	for _, fn := range deliver {
+		fn(event)
+	}
+}
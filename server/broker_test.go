@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// startTestReplica returns the hub of a replica exchanging events through the
+// Redis server at addr.
+func startTestReplica(t *testing.T, addr string) *hub {
+	t.Helper()
+
+	broker, err := newRedisBroker("redis://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { broker.client.Close() })
+	return newHub(broker)
+}
+
+// receiveEvent returns the next event of a subscriber.
+func receiveEvent(t *testing.T, events chan *pb.Event) *pb.Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event received")
+		return nil
+	}
+}
+
+func TestRedisBrokerFansOutInOrder(t *testing.T) {
+	redis := miniredis.RunT(t)
+	a := startTestReplica(t, redis.Addr())
+	b := startTestReplica(t, redis.Addr())
+	onA := a.subscribe("server")
+	onB := b.subscribe("server")
+
+	// Both replicas publish at once, and must see the same order, with
+	// the events of each replica in the order it published them
+	const perReplica = 25
+	for _, replica := range []*hub{a, b} {
+		go func() {
+			for i := 0; i < perReplica; i++ {
+				replica.publish(&pb.Event{
+					ServerId: "server",
+					Payload:  &pb.Event_MemberJoined{MemberJoined: &pb.MemberJoined{Username: fmt.Sprintf("%p-%02d", replica, i)}},
+				})
+			}
+		}()
+	}
+
+	var seenByA, seenByB []string
+	for i := 0; i < 2*perReplica; i++ {
+		seenByA = append(seenByA, receiveEvent(t, onA).GetMemberJoined().GetUsername())
+		seenByB = append(seenByB, receiveEvent(t, onB).GetMemberJoined().GetUsername())
+	}
+	last := make(map[string]string)
+	for i := range seenByA {
+		if seenByA[i] != seenByB[i] {
+			t.Fatalf("event %d is %s on one replica and %s on the other", i, seenByA[i], seenByB[i])
+		}
+		publisher := seenByA[i][:len(seenByA[i])-3]
+		if seenByA[i] < last[publisher] {
+			t.Fatalf("got %s after %s", seenByA[i], last[publisher])
+		}
+		last[publisher] = seenByA[i]
+	}
+}
+
+func TestRedisBrokerFallsBackToThisReplica(t *testing.T) {
+	redis := miniredis.RunT(t)
+	h := startTestReplica(t, redis.Addr())
+	events := h.subscribe("server")
+	redis.Close()
+
+	done := make(chan struct{})
+	go func() {
+		h.publish(&pb.Event{
+			ServerId: "server",
+			Payload:  &pb.Event_MemberJoined{MemberJoined: &pb.MemberJoined{Username: "alice"}},
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("publishing waits for Redis")
+	}
+
+	if got := receiveEvent(t, events).GetMemberJoined().GetUsername(); got != "alice" {
+		t.Fatalf("got event for %s, want alice", got)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+)
+
+// maxPollOptions limits how many answers a /poll can offer.
+const maxPollOptions = 10
+
+func init() {
+	registerCommand(&command{
+		name:    "topic",
+		usage:   "[topic]",
+		help:    "Sets the topic of the channel, or clears it when left empty.",
+		minRole: roleModerator,
+		run:     runTopic,
+	})
+	registerCommand(&command{
+		name:    "me",
+		usage:   "<action>",
+		help:    "Posts an action, for example /me waves.",
+		minArgs: 1,
+		run:     runMe,
+	})
+	registerCommand(&command{
+		name:    "kick",
+		usage:   "<user>",
+		help:    "Removes a member from the chat server.",
+		minArgs: 1,
+		minRole: roleModerator,
+		run:     runKick,
+	})
+	registerCommand(&command{
+		name:    "invite",
+		usage:   "<user>",
+		help:    "Adds a user to the chat server.",
+		minArgs: 1,
+		run:     runInvite,
+	})
+	registerCommand(&command{
+		name:    "poll",
+		usage:   `"<question>" <option> <option>...`,
+		help:    "Posts a question to the channel with numbered options.",
+		minArgs: 3,
+		run:     runPoll,
+	})
+}
+
+func runTopic(s *server, call *commandCall) error {
+	if _, exists := s.channels[call.serverID][call.channelID]; !exists {
+		return fmt.Errorf("channel not found")
+	}
+
+	topic := call.text
+	if len(call.args) == 1 {
+		// Drop the quotes of /topic "..."
+		topic = call.args[0]
+	}
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_SetTopic{SetTopic: &pb.SetTopicCommand{
+		ServerId:  call.serverID,
+		ChannelId: call.channelID,
+		Topic:     topic,
+		ChangedBy: call.username,
+	}}})
+	return err
+}
+
+func runMe(s *server, call *commandCall) error {
+	return call.post(s, "* "+call.username+" "+call.text)
+}
+
+// runKick removes a member. Moderators can only kick members with a lower
+// role than their own.
+func runKick(s *server, call *commandCall) error {
+	target := strings.TrimPrefix(call.args[0], "@")
+	role, ok := s.members[call.serverID][target]
+	if !ok {
+		return fmt.Errorf("%s is not a member of the chat server", target)
+	}
+	if roleRank(role) >= roleRank(s.members[call.serverID][call.username]) {
+		return fmt.Errorf("not allowed to kick %s", target)
+	}
+
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_Leave{Leave: &pb.LeaveCommand{
+		ServerId: call.serverID,
+		Username: target,
+		KickedBy: call.username,
+	}}})
+	return err
+}
+
+func runInvite(s *server, call *commandCall) error {
+	target := strings.TrimPrefix(call.args[0], "@")
+	if _, exists := s.users[target]; !exists && !s.isBot(target) {
+		return fmt.Errorf("unknown user %s", target)
+	}
+	if s.isMember(call.serverID, target) {
+		return fmt.Errorf("%s is already a member of the chat server", target)
+	}
+
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_Join{Join: &pb.JoinCommand{
+		ServerId:  call.serverID,
+		Username:  target,
+		InvitedBy: call.username,
+	}}})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func runPoll(s *server, call *commandCall) error {
+	question, options := call.args[0], call.args[1:]
+	if len(options) > maxPollOptions {
+		return fmt.Errorf("a poll can have at most %d options", maxPollOptions)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Poll: %s", question)
+	for i, option := range options {
+		fmt.Fprintf(&b, "\n%d. %s", i+1, option)
+	}
+	return call.post(s, b.String())
+}
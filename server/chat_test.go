@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/codes"
+)
+
+func TestChatRequiresMember(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, mallory := login(t, client, "alice"), login(t, client, "mallory")
+	serverID, channelID := testChannel(t, client, alice)
+
+	stream, err := client.Chat(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(&pb.ChatMessage{ServerId: serverID, ChannelId: channelID, Typing: true})
+	_, err = stream.Recv()
+	wantCode(t, err, codes.Unauthenticated)
+
+	stream, err = client.Chat(mallory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(&pb.ChatMessage{ServerId: serverID, ChannelId: channelID, Typing: true})
+	_, err = stream.Recv()
+	wantCode(t, err, codes.PermissionDenied)
+
+	_, err = client.StartTyping(mallory, &pb.StartTypingRequest{ServerId: serverID, ChannelId: channelID})
+	wantCode(t, err, codes.PermissionDenied)
+	_, err = client.StartTyping(alice, &pb.StartTypingRequest{ServerId: serverID, ChannelId: "missing"})
+	wantCode(t, err, codes.NotFound)
+}
+
+func TestChatTypingUsesCaller(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, bob := login(t, client, "alice"), login(t, client, "bob")
+	serverID, channelID := testChannel(t, client, alice)
+	if _, err := client.JoinChatServer(bob, &pb.JoinChatServerRequest{ServerId: serverID, Username: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	next := subscribe(t, client, alice, serverID)
+
+	stream, err := client.Chat(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.CloseSend()
+	if err := stream.Send(&pb.ChatMessage{ServerId: serverID, ChannelId: channelID, Username: "alice", Typing: true}); err != nil {
+		t.Fatal(err)
+	}
+	typing := nextEvent[*pb.Event_Typing](t, next).Typing
+	if typing.GetUsername() != "bob" || !typing.GetTyping() {
+		t.Fatalf("typing event = %v", typing)
+	}
+}
+
+func TestChatEndsWhenChannelDeleted(t *testing.T) {
+	_, client := startTestServer(t)
+	alice := login(t, client, "alice")
+	serverID, channelID := testChannel(t, client, alice)
+
+	stream, err := client.Chat(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&pb.ChatMessage{ServerId: serverID, ChannelId: channelID, Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeleteChannel(alice, &pb.DeleteChannelRequest{ServerId: serverID, ChannelId: channelID}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	wantCode(t, err, codes.NotFound)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// commandBot is the username replies to slash commands are sent as.
+const commandBot = "system"
+
+// A command is a slash command that members can run by sending a message
+// starting with /name. Commands register themselves with registerCommand,
+// usually from an init function, and need no changes to the RPC handlers.
+type command struct {
+	name string
+	// usage lists the arguments, for example "<user> [reason]"
+	usage string
+	help  string
+	// minArgs is how many arguments the command needs at least
+	minArgs int
+	// minRole is the role needed to run the command
+	minRole string
+	run     func(s *server, call *commandCall) error
+}
+
+// commandCall is a single invocation of a command.
+type commandCall struct {
+	serverID  string
+	channelID string
+	username  string
+	args      []string
+	// text is everything after the command name, unparsed
+	text string
+}
+
+var commands = make(map[string]*command)
+
+// registerCommand makes a command available in every chat server.
+func registerCommand(c *command) {
+	if _, exists := commands[c.name]; exists {
+		panic("command /" + c.name + " registered twice")
+	}
+	if c.minRole == "" {
+		c.minRole = roleMember
+	}
+	commands[c.name] = c
+}
+
+// isCommand reports whether text invokes a slash command. Starting a message
+// with // posts it with a single leading slash instead.
+func isCommand(text string) bool {
+	return len(text) > 1 && text[0] == '/' && text[1] != '/' && !unicode.IsSpace(rune(text[1]))
+}
+
+// runCommand runs the slash command in a message. Unknown commands, missing
+// permissions and failures are answered with an ephemeral reply to the
+// sender instead of an error, so a typo does not end a Chat stream. The
+// caller must hold s.mu.
+func (s *server) runCommand(m newMessage) {
+	name, text, _ := strings.Cut(m.text[1:], " ")
+	call := &commandCall{
+		serverID:  m.serverID,
+		channelID: m.channelID,
+		username:  m.username,
+		text:      strings.TrimSpace(text),
+	}
+
+	c, ok := commands[strings.ToLower(name)]
+	if !ok {
+		call.reply(s, fmt.Sprintf("Unknown command /%s, run /help to list the commands", name))
+		return
+	}
+	if !s.hasRole(m.serverID, m.username, c.minRole) {
+		call.reply(s, fmt.Sprintf("You need to be a %s to run /%s", c.minRole, c.name))
+		return
+	}
+
+	args, err := parseCommandArgs(call.text)
+	if err == nil && len(args) < c.minArgs {
+		err = fmt.Errorf("not enough arguments")
+	}
+	if err != nil {
+		call.reply(s, fmt.Sprintf("%v. Usage: %s", err, c.synopsis()))
+		return
+	}
+	call.args = args
+
+	if err := c.run(s, call); err != nil {
+		call.reply(s, fmt.Sprintf("/%s failed: %v", c.name, err))
+	}
+}
+
+// replyEphemeral answers the sender of a message with a reply only they can
+// see. The caller must hold s.mu.
+func (s *server) replyEphemeral(serverID, channelID, username, text string) {
+	s.publishEphemeral(serverID, channelID, &pb.Message{
+		Username:  commandBot,
+		Text:      text,
+		Timestamp: timestamppb.Now(),
+		VisibleTo: username,
+	})
+}
+
+func (c *command) synopsis() string {
+	if c.usage == "" {
+		return "/" + c.name
+	}
+	return "/" + c.name + " " + c.usage
+}
+
+// parseCommandArgs splits the arguments of a command on spaces. Double quotes
+// group words into a single argument and \" escapes a quote inside them.
+func parseCommandArgs(text string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg, quoted := false, false
+
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case quoted && ch == '\\' && i+1 < len(text) && text[i+1] == '"':
+			arg.WriteByte('"')
+			i++
+		case ch == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && (ch == ' ' || ch == '\t'):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(ch)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+func init() {
+	registerCommand(&command{
+		name:  "help",
+		usage: "[command]",
+		help:  "Lists the commands you can run, or explains one of them.",
+		run:   runHelp,
+	})
+}
+
+func runHelp(s *server, call *commandCall) error {
+	if len(call.args) > 0 {
+		c, ok := commands[strings.ToLower(strings.TrimPrefix(call.args[0], "/"))]
+		if !ok {
+			return fmt.Errorf("unknown command %s", call.args[0])
+		}
+		call.reply(s, fmt.Sprintf("%s: %s", c.synopsis(), c.help))
+		return nil
+	}
+
+	var names []string
+	for name, c := range commands {
+		if s.hasRole(call.serverID, call.username, c.minRole) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Commands:")
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n%s - %s", commands[name].synopsis(), commands[name].help)
+	}
+	call.reply(s, b.String())
+	return nil
+}
+
+// post posts a message to the channel the command was run in as the user
+// who ran it. The caller must hold s.mu.
+func (call *commandCall) post(s *server, text string) error {
+	_, err := s.storeMessage(call.serverID, call.channelID, &pb.Message{
+		Username:  call.username,
+		Text:      text,
+		Timestamp: timestamppb.Now(),
+	})
+	return err
+}
+
+// reply answers the user who ran the command with a message only they can
+// see. The caller must hold s.mu.
+func (call *commandCall) reply(s *server, text string) {
+	s.replyEphemeral(call.serverID, call.channelID, call.username, text)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/codes"
+)
+
+func TestSendMessagesPostsAsCaller(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, mallory := login(t, client, "alice"), login(t, client, "mallory")
+	serverID, channelID := testChannel(t, client, alice)
+
+	err := send(context.Background(), client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Username: "alice", Text: "hi"})
+	wantCode(t, err, codes.Unauthenticated)
+	err = send(mallory, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Username: "mallory", Text: "hi"})
+	wantCode(t, err, codes.PermissionDenied)
+
+	if _, err := client.JoinChatServer(mallory, &pb.JoinChatServerRequest{ServerId: serverID, Username: "mallory"}); err != nil {
+		t.Fatal(err)
+	}
+	err = send(mallory, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Username: "alice", Text: "/topic pwned"})
+	wantCode(t, err, codes.PermissionDenied)
+	err = send(mallory, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "/topic pwned"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel, err := client.GetChannel(alice, &pb.GetChannelRequest{ServerId: serverID, ChannelId: channelID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel.GetChannel().GetTopic() != "" {
+		t.Fatalf("a member changed the topic: %q", channel.GetChannel().GetTopic())
+	}
+
+	for _, sender := range []string{"alice", "alice@example.org"} {
+		err = send(mallory, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Username: sender, Text: "it's me"})
+		wantCode(t, err, codes.PermissionDenied)
+	}
+	err = send(mallory, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "it's me, mallory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := listMessages(t, client, alice, serverID, channelID)
+	if len(messages) != 1 || messages[0].GetUsername() != "mallory" {
+		t.Fatalf("messages = %v", messages)
+	}
+}
+
+func TestCommandBotNameIsReserved(t *testing.T) {
+	_, client := startTestServer(t)
+
+	_, err := client.Login(context.Background(), &pb.LoginRequest{Username: commandBot, Password: "secret"})
+	wantCode(t, err, codes.PermissionDenied)
+}
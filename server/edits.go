@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EditMessage changes the text of a message. Only the author may edit it,
+// and messages relayed from federated instances are edited there.
+func (s *server) EditMessage(ctx context.Context, req *pb.EditMessageRequest) (*pb.EditMessageResponse, error) {
+	owner, ctx, err := s.sharding.forward(ctx, req.GetChannelId())
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil {
+		return owner.EditMessage(ctx, req)
+	}
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if req.GetText() == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "messages cannot be edited to be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, err := s.channelMessage(req.GetServerId(), req.GetChannelId(), req.GetMessageId(), username)
+	if err != nil {
+		return nil, err
+	}
+	if msg.GetUsername() != username || msg.GetOrigin() != "" {
+		return nil, grpc.Errorf(codes.PermissionDenied, "only the author can edit a message")
+	}
+
+	resp, err := s.commitMessageChange(req.GetChannelId(), &pb.Command{Payload: &pb.Command_EditMessage{EditMessage: &pb.EditMessageCommand{
+		ServerId:  req.GetServerId(),
+		ChannelId: req.GetChannelId(),
+		MessageId: req.GetMessageId(),
+		Text:      req.GetText(),
+		EditedAt:  timestamppb.Now(),
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.EditMessageResponse{Message: resp.GetMessage()}, nil
+}
+
+// DeleteMessage deletes a message. Authors may delete their own messages and
+// moderators any message.
+func (s *server) DeleteMessage(ctx context.Context, req *pb.DeleteMessageRequest) (*pb.DeleteMessageResponse, error) {
+	owner, ctx, err := s.sharding.forward(ctx, req.GetChannelId())
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil {
+		return owner.DeleteMessage(ctx, req)
+	}
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, err := s.channelMessage(req.GetServerId(), req.GetChannelId(), req.GetMessageId(), username)
+	if err != nil {
+		return nil, err
+	}
+	if msg.GetUsername() != username && !s.hasRole(req.GetServerId(), username, roleModerator) {
+		return nil, grpc.Errorf(codes.PermissionDenied, "only moderators can delete the messages of others")
+	}
+
+	_, err = s.commitMessageChange(req.GetChannelId(), &pb.Command{Payload: &pb.Command_DeleteMessage{DeleteMessage: &pb.DeleteMessageCommand{
+		ServerId:  req.GetServerId(),
+		ChannelId: req.GetChannelId(),
+		MessageId: req.GetMessageId(),
+		DeletedBy: username,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DeleteMessageResponse{}, nil
+}
+
+// channelMessage returns a message of a channel the user can read, from the
+// owner of the channel if another node owns it. The caller must hold s.mu,
+// which is released while the owner is asked.
+func (s *server) channelMessage(serverID, channelID, messageID, username string) (*pb.Message, error) {
+	if err := s.checkChannelAccess(serverID, channelID, username); err != nil {
+		return nil, err
+	}
+	if owner := s.sharding.remoteOwner(channelID); owner != "" {
+		return s.sharding.fetchMessage(owner, channelID, messageID)
+	}
+	msg := s.findMessage(channelID, messageID)
+	if msg == nil {
+		return nil, grpc.Errorf(codes.NotFound, "message not found")
+	}
+	return msg, nil
+}
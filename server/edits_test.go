@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/codes"
+)
+
+func TestEditAndDeleteMessages(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, bob := login(t, client, "alice"), login(t, client, "bob")
+	serverID, channelID := testChannel(t, client, alice)
+	if _, err := client.JoinChatServer(bob, &pb.JoinChatServerRequest{ServerId: serverID, Username: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	next := subscribe(t, client, bob, serverID)
+
+	err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Username: "alice", Text: "helo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := nextEvent[*pb.Event_MessageCreated](t, next).MessageCreated.GetMessage()
+
+	_, err = client.EditMessage(bob, &pb.EditMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId(), Text: "hijacked"})
+	wantCode(t, err, codes.PermissionDenied)
+
+	edited, err := client.EditMessage(alice, &pb.EditMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId(), Text: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.GetMessage().GetText() != "hello" || edited.GetMessage().GetEditedAt() == nil {
+		t.Fatalf("edited message = %v", edited.GetMessage())
+	}
+	event := nextEvent[*pb.Event_MessageEdited](t, next)
+	if event.MessageEdited.GetMessage().GetText() != "hello" {
+		t.Fatalf("MessageEdited carries %q", event.MessageEdited.GetMessage().GetText())
+	}
+
+	_, err = client.DeleteMessage(bob, &pb.DeleteMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId()})
+	wantCode(t, err, codes.PermissionDenied)
+	if _, err := client.DeleteMessage(alice, &pb.DeleteMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	deleted := nextEvent[*pb.Event_MessageDeleted](t, next)
+	if deleted.MessageDeleted.GetMessageId() != msg.GetId() || deleted.MessageDeleted.GetDeletedBy() != "alice" {
+		t.Fatalf("MessageDeleted = %v", deleted.MessageDeleted)
+	}
+	if messages := listMessages(t, client, alice, serverID, channelID); len(messages) != 0 {
+		t.Fatalf("channel still has %d messages", len(messages))
+	}
+}
+
+func TestDeleteChannel(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, bob := login(t, client, "alice"), login(t, client, "bob")
+	serverID, channelID := testChannel(t, client, alice)
+	if _, err := client.JoinChatServer(bob, &pb.JoinChatServerRequest{ServerId: serverID, Username: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	next := subscribe(t, client, bob, serverID)
+
+	_, err := client.DeleteChannel(bob, &pb.DeleteChannelRequest{ServerId: serverID, ChannelId: channelID})
+	wantCode(t, err, codes.PermissionDenied)
+
+	if _, err := client.DeleteChannel(alice, &pb.DeleteChannelRequest{ServerId: serverID, ChannelId: channelID}); err != nil {
+		t.Fatal(err)
+	}
+	if deleted := nextEvent[*pb.Event_ChannelDeleted](t, next); deleted.ChannelDeleted.GetChannelId() != channelID {
+		t.Fatalf("ChannelDeleted for %s", deleted.ChannelDeleted.GetChannelId())
+	}
+
+	_, err = client.GetChannel(alice, &pb.GetChannelRequest{ServerId: serverID, ChannelId: channelID})
+	wantCode(t, err, codes.NotFound)
+	err = send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Username: "alice", Text: "anyone?"})
+	wantCode(t, err, codes.NotFound)
+}
+
+func TestEditWhilePinsAreRead(t *testing.T) {
+	_, client := startTestServer(t)
+	alice := login(t, client, "alice")
+	serverID, channelID := testChannel(t, client, alice)
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "draft"}); err != nil {
+		t.Fatal(err)
+	}
+	msg := listMessages(t, client, alice, serverID, channelID)[0]
+	if _, err := client.PinMessage(alice, &pb.PinMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SaveMessage(alice, &pb.SaveMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Under -race, editing the stored message in place races with the
+	// responses being marshaled
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			client.ListPins(alice, &pb.ListPinsRequest{ServerId: serverID, ChannelId: channelID})
+			client.ListSaved(alice, &pb.ListSavedRequest{})
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		_, err := client.EditMessage(alice, &pb.EditMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId(), Text: fmt.Sprintf("edit %d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	pins, err := client.ListPins(alice, &pb.ListPinsRequest{ServerId: serverID, ChannelId: channelID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := pins.GetPins()[0].GetMessage().GetText(); text != "edit 19" {
+		t.Fatalf("the pin shows %q", text)
+	}
+	saved, err := client.ListSaved(alice, &pb.ListSavedRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := saved.GetMessages()[0].GetMessage().GetText(); text != "edit 19" {
+		t.Fatalf("the saved message shows %q", text)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/google/uuid"
+)
+
+// publishEphemeral delivers a message to its sender and the user it is
+// visible to without storing it. The caller must hold s.mu.
+func (s *server) publishEphemeral(serverID, channelID string, msg *pb.Message) {
+	msg.Id = uuid.New().String()
+	msg.IsBot = s.isBot(msg.GetUsername())
+
+	s.hub.publish(&pb.Event{
+		ServerId:  serverID,
+		Timestamp: msg.GetTimestamp(),
+		Payload: &pb.Event_MessageCreated{MessageCreated: &pb.MessageCreated{
+			ChannelId: channelID,
+			Message:   msg,
+		}},
+	})
+}
+
+// visibleTo reports whether an event may be shown to the user. Everything but
+// ephemeral messages meant for someone else is.
+func visibleTo(event *pb.Event, username string) bool {
+	created := event.GetMessageCreated()
+	if created == nil || created.GetMessage().GetVisibleTo() == "" {
+		return true
+	}
+	msg := created.GetMessage()
+	return username == msg.GetVisibleTo() || username == msg.GetUsername()
+}
+
+// expireMessage removes a self-destructing message from its channel and tells
+// subscribers it is gone.
+func (s *server) expireMessage(serverID, channelID, messageID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.removeMessage(channelID, messageID) {
+		return
+	}
+	s.hub.publish(&pb.Event{
+		ServerId: serverID,
+		Payload: &pb.Event_MessageExpired{MessageExpired: &pb.MessageExpired{
+			ChannelId: channelID,
+			MessageId: messageID,
+		}},
+	})
+}
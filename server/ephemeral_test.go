@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+)
+
+func TestSelfDestructingMessagesExpire(t *testing.T) {
+	_, client := startTestServer(t)
+	alice := login(t, client, "alice")
+	serverID, channelID := testChannel(t, client, alice)
+	next := subscribe(t, client, alice, serverID)
+
+	sent := time.Now()
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "gone soon", TtlSeconds: 1}); err != nil {
+		t.Fatal(err)
+	}
+	msg := nextEvent[*pb.Event_MessageCreated](t, next).MessageCreated.GetMessage()
+	if msg.GetExpiresAt() == nil {
+		t.Fatal("the message has no expiry")
+	}
+	if messages := listMessages(t, client, alice, serverID, channelID); len(messages) != 1 {
+		t.Fatalf("got %d messages before the TTL, want 1", len(messages))
+	}
+
+	expired := nextEvent[*pb.Event_MessageExpired](t, next).MessageExpired
+	if expired.GetMessageId() != msg.GetId() {
+		t.Fatalf("got MessageExpired for %s, want %s", expired.GetMessageId(), msg.GetId())
+	}
+	if elapsed := time.Since(sent); elapsed < time.Second {
+		t.Fatalf("the message expired after %v, before its TTL", elapsed)
+	}
+	if messages := listMessages(t, client, alice, serverID, channelID); len(messages) != 0 {
+		t.Fatalf("got %d messages after the TTL, want none", len(messages))
+	}
+}
@@ -0,0 +1,713 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	instanceName    = flag.String("instance", "", "The name of this instance among federated instances, empty disables federation")
+	federationPeers = flag.String("federation-peers", "", `JSON file listing the federated instances as [{"name": "...", "address": "host:port", "secret": "..."}]`)
+	federationState = flag.String("federation-state", "", "File the channel links and the events waiting for peers are persisted in so they survive restarts, disabled when empty")
+)
+
+const (
+	// maxFederationOutbox limits how many events wait for an unreachable
+	// peer. The oldest are dropped beyond it.
+	maxFederationOutbox = 10000
+	// federationBatch is how many events a single Relay call carries at most.
+	federationBatch = 100
+	// federationSkew is how far the timestamp of a Relay request may be off.
+	federationSkew = 5 * time.Minute
+	// federationSeen is how many applied event ids are remembered per peer to
+	// drop replays.
+	federationSeen = 10000
+	// federationTimeout limits a single Relay call.
+	federationTimeout = 10 * time.Second
+
+	federationMinBackoff = time.Second
+	federationMaxBackoff = time.Minute
+
+	// federationSaveInterval is how often the state file is written at most
+	// while events come and go.
+	federationSaveInterval = time.Second
+)
+
+// federationPeerConfig is an entry of the -federation-peers file. Both
+// instances of a pair list each other with the same secret.
+type federationPeerConfig struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Secret  string `json:"secret"`
+}
+
+// federationPeer is a federated instance and the events waiting to be
+// relayed to it.
+type federationPeer struct {
+	name   string
+	secret string
+	client pb.FederationClient
+
+	// outbox holds the events not acknowledged yet, oldest first
+	outbox []*pb.FederatedEvent
+	// ready is signalled when events are added to the outbox
+	ready chan struct{}
+	// seen holds the ids of events applied from the peer, in the order of
+	// seenOrder
+	seen      map[string]bool
+	seenOrder []string
+}
+
+// linkKey identifies a channel link by peer and link name.
+type linkKey struct {
+	peer string
+	link string
+}
+
+// federation relays the events of linked channels to other instances and
+// applies the events they relay. Every instance only relays what happened on
+// it, so messages never travel in circles. It has its own lock so events can
+// be queued while s.mu is held.
+type federation struct {
+	pb.UnimplementedFederationServer
+	s        *server
+	instance string
+	// peers never changes once federation started
+	peers map[string]*federationPeer
+
+	mu    sync.Mutex
+	links map[linkKey]*pb.ChannelLink
+
+	// stateFile is where the links and outboxes are persisted, if anywhere
+	stateFile string
+	// dirty is signalled when the state changed and has to be saved
+	dirty chan struct{}
+}
+
+// startFederation links this instance with the peers listed in peersFile and
+// starts relaying events to them. The links and outboxes are restored from
+// stateFile and saved there, unless it is empty.
+func (s *server) startFederation(instance, peersFile, stateFile string) error {
+	if instance == "" {
+		return nil
+	}
+	if strings.ContainsAny(instance, "@ ") {
+		return fmt.Errorf("instance name %q cannot contain @ or spaces", instance)
+	}
+	if peersFile == "" {
+		return fmt.Errorf("-federation-peers is required with -instance")
+	}
+	data, err := os.ReadFile(peersFile)
+	if err != nil {
+		return err
+	}
+	var configs []federationPeerConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", peersFile, err)
+	}
+
+	f := &federation{
+		s:         s,
+		instance:  instance,
+		peers:     make(map[string]*federationPeer),
+		links:     make(map[linkKey]*pb.ChannelLink),
+		stateFile: stateFile,
+		dirty:     make(chan struct{}, 1),
+	}
+	for _, config := range configs {
+		if config.Name == "" || config.Address == "" || config.Secret == "" {
+			return fmt.Errorf("every peer needs a name, an address and a secret")
+		}
+		if config.Name == instance || f.peers[config.Name] != nil {
+			return fmt.Errorf("peer %s is listed twice", config.Name)
+		}
+		conn, err := grpc.Dial(config.Address, s.certs.dialOption())
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %v", config.Name, err)
+		}
+		f.peers[config.Name] = &federationPeer{
+			name:   config.Name,
+			secret: config.Secret,
+			client: pb.NewFederationClient(conn),
+			ready:  make(chan struct{}, 1),
+			seen:   make(map[string]bool),
+		}
+	}
+
+	if err := f.load(); err != nil {
+		return fmt.Errorf("failed to load the federation state: %v", err)
+	}
+
+	s.federation = f
+	s.hub.observe(f.enqueue)
+	for _, peer := range f.peers {
+		go f.relay(peer)
+	}
+	if stateFile != "" {
+		go f.persist()
+	}
+	log.Printf("Federating as %s with %d peers", instance, len(f.peers))
+	return nil
+}
+
+// load restores the links and outboxes from the state file. Links and events
+// of peers that are no longer listed are dropped.
+func (f *federation) load() error {
+	if f.stateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(f.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state pb.FederationState
+	if err := proto.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	for _, link := range state.GetLinks() {
+		if f.peers[link.GetPeer()] == nil {
+			log.Printf("Dropping link %s with %s, which is no longer a peer", link.GetLink(), link.GetPeer())
+			continue
+		}
+		f.links[linkKey{peer: link.GetPeer(), link: link.GetLink()}] = link
+	}
+	queued := 0
+	for _, saved := range state.GetPeers() {
+		peer := f.peers[saved.GetName()]
+		if peer == nil {
+			continue
+		}
+		peer.outbox = saved.GetOutbox()
+		queued += len(peer.outbox)
+		for _, id := range saved.GetSeen() {
+			peer.seen[id] = true
+		}
+		peer.seenOrder = saved.GetSeen()
+	}
+	log.Printf("Loaded %d channel links and %d events waiting for peers", len(f.links), queued)
+	return nil
+}
+
+// changed marks the state to be saved, if persistence is enabled. It does not
+// block.
+func (f *federation) changed() {
+	if f.stateFile == "" {
+		return
+	}
+	select {
+	case f.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// persist saves the state whenever it changed, at most once per
+// federationSaveInterval, so a busy link does not rewrite the file for every
+// event.
+func (f *federation) persist() {
+	for range f.dirty {
+		f.save()
+		time.Sleep(federationSaveInterval)
+	}
+}
+
+// save writes the links and outboxes to the state file.
+func (f *federation) save() {
+	f.mu.Lock()
+	state := &pb.FederationState{}
+	for _, link := range f.links {
+		state.Links = append(state.Links, link)
+	}
+	for _, peer := range f.peers {
+		saved := &pb.FederationPeerState{Name: peer.name, Outbox: peer.outbox}
+		// Events that failed to apply are let through again
+		for _, id := range peer.seenOrder {
+			if peer.seen[id] {
+				saved.Seen = append(saved.Seen, id)
+			}
+		}
+		state.Peers = append(state.Peers, saved)
+	}
+	data, err := proto.Marshal(state)
+	f.mu.Unlock()
+
+	if err == nil {
+		err = writeFileAtomic(f.stateFile, data)
+	}
+	if err != nil {
+		log.Printf("Failed to save the federation state: %v", err)
+	}
+}
+
+// isRemoteUser reports whether a username has the form user@instance of a
+// federated instance. Such names cannot log in locally.
+func (f *federation) isRemoteUser(username string) bool {
+	if f == nil {
+		return false
+	}
+	i := strings.LastIndex(username, "@")
+	return i >= 0 && f.peers[username[i+1:]] != nil
+}
+
+// unlinkChannel removes the links of a deleted channel.
+func (f *federation) unlinkChannel(channelID string) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key, link := range f.links {
+		if link.GetChannelId() == channelID {
+			delete(f.links, key)
+			f.changed()
+		}
+	}
+}
+
+// enqueue queues the events of linked channels for their peers. It is called
+// for every event the hub publishes and does not block.
+func (f *federation) enqueue(event *pb.Event) {
+	var channelID string
+	federated := &pb.FederatedEvent{
+		Id:        uuid.New().String(),
+		Timestamp: event.GetTimestamp(),
+	}
+
+	switch p := event.GetPayload().(type) {
+	case *pb.Event_MessageCreated:
+		msg := p.MessageCreated.GetMessage()
+		// Ephemeral and self-destructing messages stay on this instance
+		if msg.GetOrigin() != "" || msg.GetVisibleTo() != "" || msg.GetExpiresAt() != nil {
+			return
+		}
+		channelID = p.MessageCreated.GetChannelId()
+		federated.Id = msg.GetId()
+		federated.Payload = &pb.FederatedEvent_MessageCreated{MessageCreated: federatedMessage(msg)}
+	case *pb.Event_MessageEdited:
+		msg := p.MessageEdited.GetMessage()
+		if msg.GetOrigin() != "" || msg.GetExpiresAt() != nil {
+			return
+		}
+		channelID = p.MessageEdited.GetChannelId()
+		federated.Payload = &pb.FederatedEvent_MessageEdited{MessageEdited: federatedMessage(msg)}
+	case *pb.Event_MemberJoined:
+		if f.isRemoteUser(p.MemberJoined.GetUsername()) {
+			return
+		}
+		federated.Payload = &pb.FederatedEvent_MemberJoined{MemberJoined: p.MemberJoined.GetUsername()}
+	case *pb.Event_MemberLeft:
+		if f.isRemoteUser(p.MemberLeft.GetUsername()) {
+			return
+		}
+		federated.Payload = &pb.FederatedEvent_MemberLeft{MemberLeft: p.MemberLeft.GetUsername()}
+	default:
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key, link := range f.links {
+		if link.GetServerId() != event.GetServerId() {
+			continue
+		}
+		// Membership changes concern every linked channel of the server
+		if channelID != "" && link.GetChannelId() != channelID {
+			continue
+		}
+		relayed := proto.Clone(federated).(*pb.FederatedEvent)
+		relayed.Link = key.link
+		f.peers[key.peer].push(relayed)
+		f.changed()
+	}
+}
+
+// federatedMessage returns the parts of a message that are relayed.
+// Attachments stay on this instance.
+func federatedMessage(msg *pb.Message) *pb.Message {
+	return &pb.Message{
+		Username:  msg.GetUsername(),
+		Text:      msg.GetText(),
+		Timestamp: msg.GetTimestamp(),
+		Id:        msg.GetId(),
+		IsBot:     msg.GetIsBot(),
+	}
+}
+
+// push adds an event to the outbox. The caller must hold f.mu.
+func (p *federationPeer) push(event *pb.FederatedEvent) {
+	p.outbox = append(p.outbox, event)
+	if len(p.outbox) > maxFederationOutbox {
+		log.Printf("Federation outbox of %s is full, dropping the oldest event", p.name)
+		p.outbox = p.outbox[1:]
+	}
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+// relay sends the outbox of a peer in batches. A batch stays in the outbox
+// until the peer acknowledged it, so everything queued during an outage is
+// replayed once the peer is back.
+func (f *federation) relay(peer *federationPeer) {
+	backoff := federationMinBackoff
+	for {
+		f.mu.Lock()
+		batch := append([]*pb.FederatedEvent(nil), peer.outbox[:min(len(peer.outbox), federationBatch)]...)
+		f.mu.Unlock()
+		if len(batch) == 0 {
+			<-peer.ready
+			continue
+		}
+
+		if err := f.send(peer, batch); err != nil {
+			log.Printf("Failed to relay %d events to %s, retrying in %s: %v", len(batch), peer.name, backoff, err)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, federationMaxBackoff)
+			continue
+		}
+		backoff = federationMinBackoff
+
+		// Events may have been dropped from the front of the outbox or
+		// unlinked meanwhile, so only remove what was sent
+		sent := make(map[*pb.FederatedEvent]bool, len(batch))
+		for _, event := range batch {
+			sent[event] = true
+		}
+		f.mu.Lock()
+		var rest []*pb.FederatedEvent
+		for _, event := range peer.outbox {
+			if !sent[event] {
+				rest = append(rest, event)
+			}
+		}
+		peer.outbox = rest
+		f.changed()
+		f.mu.Unlock()
+	}
+}
+
+// send relays a batch of events to a peer and checks that the answer comes
+// from an instance that knows the shared secret.
+func (f *federation) send(peer *federationPeer, events []*pb.FederatedEvent) error {
+	req := &pb.RelayRequest{
+		Instance:  f.instance,
+		Timestamp: timestamppb.Now(),
+		Events:    events,
+	}
+	req.Signature = signRelay(peer.secret, req)
+
+	ctx, cancel := context.WithTimeout(context.Background(), federationTimeout)
+	defer cancel()
+	resp, err := peer.client.Relay(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.GetInstance() != peer.name || !hmac.Equal([]byte(resp.GetSignature()), []byte(signRelayAck(peer.secret, req.GetSignature()))) {
+		return fmt.Errorf("the answer is not signed by %s", peer.name)
+	}
+	return nil
+}
+
+// signRelay returns the hex HMAC-SHA256 of a request without its signature.
+func signRelay(secret string, req *pb.RelayRequest) string {
+	unsigned := proto.Clone(req).(*pb.RelayRequest)
+	unsigned.Signature = ""
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(unsigned)
+	if err != nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func signRelayAck(secret, signature string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("ack."))
+	mac.Write([]byte(signature))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Relay applies the events a peer relays. Events for links this instance does
+// not know are dropped.
+func (f *federation) Relay(ctx context.Context, req *pb.RelayRequest) (*pb.RelayResponse, error) {
+	peer, ok := f.peers[req.GetInstance()]
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "unknown instance")
+	}
+	if !hmac.Equal([]byte(req.GetSignature()), []byte(signRelay(peer.secret, req))) {
+		return nil, grpc.Errorf(codes.Unauthenticated, "invalid signature")
+	}
+	if skew := time.Since(req.GetTimestamp().AsTime()); skew > federationSkew || skew < -federationSkew {
+		return nil, grpc.Errorf(codes.Unauthenticated, "request timestamp is too far off")
+	}
+
+	for _, event := range req.GetEvents() {
+		if err := f.apply(peer, event); err != nil {
+			// The peer sends the batch again, and the events applied so
+			// far are dropped as duplicates
+			return nil, grpc.Errorf(codes.Unavailable, "failed to apply event %s: %v", event.GetId(), err)
+		}
+	}
+
+	return &pb.RelayResponse{
+		Instance:  f.instance,
+		Signature: signRelayAck(peer.secret, req.GetSignature()),
+	}, nil
+}
+
+// apply applies a single event relayed by a peer to the linked channel.
+// Remote users appear as user@instance.
+func (f *federation) apply(peer *federationPeer, event *pb.FederatedEvent) error {
+	s := f.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// f.mu must not be held while publishing, which calls enqueue
+	f.mu.Lock()
+	link, linked := f.links[linkKey{peer: peer.name, link: event.GetLink()}]
+	duplicate := peer.seen[event.GetId()]
+	if linked && !duplicate {
+		peer.seen[event.GetId()] = true
+		peer.seenOrder = append(peer.seenOrder, event.GetId())
+		if len(peer.seenOrder) > federationSeen {
+			delete(peer.seen, peer.seenOrder[0])
+			peer.seenOrder = peer.seenOrder[1:]
+		}
+		f.changed()
+	}
+	f.mu.Unlock()
+
+	if !linked {
+		log.Printf("Dropping event for unknown link %s from %s", event.GetLink(), peer.name)
+		return nil
+	}
+	if duplicate {
+		return nil
+	}
+	serverID, channelID := link.GetServerId(), link.GetChannelId()
+	if _, exists := s.channels[serverID][channelID]; !exists {
+		return nil
+	}
+
+	switch p := event.GetPayload().(type) {
+	case *pb.FederatedEvent_MessageCreated:
+		remote := p.MessageCreated
+		_, err := s.storeMessage(serverID, channelID, &pb.Message{
+			Username:  remote.GetUsername() + "@" + peer.name,
+			Text:      remote.GetText(),
+			Timestamp: remote.GetTimestamp(),
+			Id:        event.GetId(),
+			IsBot:     remote.GetIsBot(),
+			Origin:    peer.name,
+		})
+		if err != nil {
+			f.unsee(peer, event.GetId())
+			return err
+		}
+	case *pb.FederatedEvent_MessageEdited:
+		remote := p.MessageEdited
+		var msg *pb.Message
+		var err error
+		if owner := s.sharding.remoteOwner(channelID); owner != "" {
+			msg, err = s.sharding.fetchMessage(owner, channelID, remote.GetId())
+		} else if msg = s.findMessage(channelID, remote.GetId()); msg == nil {
+			err = grpc.Errorf(codes.NotFound, "message not found")
+		}
+		if status.Code(err) == codes.NotFound {
+			// The message was deleted here
+			return nil
+		}
+		if err != nil {
+			f.unsee(peer, event.GetId())
+			return err
+		}
+		if msg.GetOrigin() != peer.name {
+			return nil
+		}
+
+		editedAt := event.GetTimestamp()
+		if editedAt == nil {
+			editedAt = timestamppb.Now()
+		}
+		_, err = s.commitMessageChange(channelID, &pb.Command{Payload: &pb.Command_EditMessage{EditMessage: &pb.EditMessageCommand{
+			ServerId:  serverID,
+			ChannelId: channelID,
+			MessageId: remote.GetId(),
+			Text:      remote.GetText(),
+			EditedAt:  editedAt,
+		}}})
+		if err != nil && status.Code(err) != codes.NotFound {
+			f.unsee(peer, event.GetId())
+			return err
+		}
+	case *pb.FederatedEvent_MemberJoined:
+		s.hub.publish(&pb.Event{
+			ServerId:  serverID,
+			Timestamp: event.GetTimestamp(),
+			Payload:   &pb.Event_MemberJoined{MemberJoined: &pb.MemberJoined{Username: p.MemberJoined + "@" + peer.name}},
+		})
+	case *pb.FederatedEvent_MemberLeft:
+		s.hub.publish(&pb.Event{
+			ServerId:  serverID,
+			Timestamp: event.GetTimestamp(),
+			Payload:   &pb.Event_MemberLeft{MemberLeft: &pb.MemberLeft{Username: p.MemberLeft + "@" + peer.name}},
+		})
+	}
+	return nil
+}
+
+// unsee forgets that an event of a peer was seen, so it is applied when the
+// peer sends it again.
+func (f *federation) unsee(peer *federationPeer, id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(peer.seen, id)
+	f.changed()
+}
+
+// LinkChannel links a channel with the channel of a peer that uses the same
+// link name. Only admins may manage links.
+func (s *server) LinkChannel(ctx context.Context, req *pb.LinkChannelRequest) (*pb.LinkChannelResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	f := s.federation
+	if f == nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "federation is not enabled on this instance")
+	}
+	if req.GetLink() == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "link name is required")
+	}
+	if f.peers[req.GetPeer()] == nil {
+		return nil, grpc.Errorf(codes.NotFound, "unknown instance %s", req.GetPeer())
+	}
+
+	if err := s.checkAdmin(req.GetServerId(), username, "channel links"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	_, channelExists := s.channels[req.GetServerId()][req.GetChannelId()]
+	s.mu.Unlock()
+	if !channelExists {
+		return nil, grpc.Errorf(codes.NotFound, "channel not found")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := linkKey{peer: req.GetPeer(), link: req.GetLink()}
+	if _, exists := f.links[key]; exists {
+		return nil, grpc.Errorf(codes.AlreadyExists, "link %s with %s already exists", req.GetLink(), req.GetPeer())
+	}
+	link := &pb.ChannelLink{
+		ServerId:  req.GetServerId(),
+		ChannelId: req.GetChannelId(),
+		Peer:      req.GetPeer(),
+		Link:      req.GetLink(),
+		CreatedBy: username,
+		CreatedAt: timestamppb.Now(),
+	}
+	f.links[key] = link
+	f.changed()
+
+	return &pb.LinkChannelResponse{Link: link}, nil
+}
+
+func (s *server) ListChannelLinks(ctx context.Context, req *pb.ListChannelLinksRequest) (*pb.ListChannelLinksResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if err := s.checkAdmin(req.GetServerId(), username, "channel links"); err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListChannelLinksResponse{}
+	f := s.federation
+	if f == nil {
+		return resp, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, link := range f.links {
+		if link.GetServerId() == req.GetServerId() {
+			resp.Links = append(resp.Links, link)
+		}
+	}
+	sort.Slice(resp.Links, func(i, j int) bool {
+		if resp.Links[i].GetPeer() != resp.Links[j].GetPeer() {
+			return resp.Links[i].GetPeer() < resp.Links[j].GetPeer()
+		}
+		return resp.Links[i].GetLink() < resp.Links[j].GetLink()
+	})
+	return resp, nil
+}
+
+// UnlinkChannel removes a channel link along with the events still waiting to
+// be relayed for it.
+func (s *server) UnlinkChannel(ctx context.Context, req *pb.UnlinkChannelRequest) (*pb.UnlinkChannelResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if err := s.checkAdmin(req.GetServerId(), username, "channel links"); err != nil {
+		return nil, err
+	}
+	f := s.federation
+	if f == nil {
+		return nil, grpc.Errorf(codes.NotFound, "link not found")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := linkKey{peer: req.GetPeer(), link: req.GetLink()}
+	link, exists := f.links[key]
+	if !exists || link.GetServerId() != req.GetServerId() {
+		return nil, grpc.Errorf(codes.NotFound, "link not found")
+	}
+	delete(f.links, key)
+
+	peer := f.peers[key.peer]
+	var rest []*pb.FederatedEvent
+	for _, event := range peer.outbox {
+		if event.GetLink() != key.link {
+			rest = append(rest, event)
+		}
+	}
+	peer.outbox = rest
+	f.changed()
+
+	return &pb.UnlinkChannelResponse{}, nil
+}
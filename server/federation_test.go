@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+// startFederatedInstance starts an instance federating with the given peers
+// on lis, and returns it with a client.
+func startFederatedInstance(t *testing.T, name string, lis net.Listener, peers []federationPeerConfig, stateFile string) (*server, pb.ChatServerClient) {
+	t.Helper()
+
+	data, err := json.Marshal(peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peersFile := filepath.Join(t.TempDir(), "peers.json")
+	if err := os.WriteFile(peersFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := newLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(blobs, &localBroker{})
+	if err := s.startFederation(name, peersFile, stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	grpcServer := grpc.NewServer()
+	s.registerServices(grpcServer)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, pb.NewChatServerClient(conn)
+}
+
+func TestFederationRelaysLinkedChannels(t *testing.T) {
+	hqLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	branchLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hq := startFederatedInstance(t, "hq", hqLis, []federationPeerConfig{
+		{Name: "branch", Address: branchLis.Addr().String(), Secret: "shared"},
+	}, "")
+	_, branch := startFederatedInstance(t, "branch", branchLis, []federationPeerConfig{
+		{Name: "hq", Address: hqLis.Addr().String(), Secret: "shared"},
+	}, "")
+
+	alice := login(t, hq, "alice")
+	hqServer, hqChannel := testChannel(t, hq, alice)
+	bob := login(t, branch, "bob")
+	branchServer, branchChannel := testChannel(t, branch, bob)
+
+	_, err = hq.LinkChannel(alice, &pb.LinkChannelRequest{ServerId: hqServer, ChannelId: hqChannel, Peer: "branch", Link: "offices"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = branch.LinkChannel(bob, &pb.LinkChannelRequest{ServerId: branchServer, ChannelId: branchChannel, Peer: "hq", Link: "offices"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := send(alice, hq, &pb.SendMessageRequest{ServerId: hqServer, ChannelId: hqChannel, Text: "hello branch"}); err != nil {
+		t.Fatal(err)
+	}
+	var relayed *pb.Message
+	eventually(t, 5*time.Second, func() bool {
+		messages := listMessages(t, branch, bob, branchServer, branchChannel)
+		if len(messages) != 1 {
+			return false
+		}
+		relayed = messages[0]
+		return true
+	})
+	if relayed.GetUsername() != "alice@hq" || relayed.GetOrigin() != "hq" {
+		t.Fatalf("got %v, want a message from alice@hq", relayed)
+	}
+
+	sent := listMessages(t, hq, alice, hqServer, hqChannel)[0]
+	_, err = hq.EditMessage(alice, &pb.EditMessageRequest{ServerId: hqServer, ChannelId: hqChannel, MessageId: sent.GetId(), Text: "hello branch office"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, 5*time.Second, func() bool {
+		messages := listMessages(t, branch, bob, branchServer, branchChannel)
+		return len(messages) == 1 && messages[0].GetText() == "hello branch office" && messages[0].GetEditedAt() != nil
+	})
+}
+
+func TestFederatedEditsReachTheChannelOwner(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a Raft cluster")
+	}
+	servers, clients := startTestCluster(t, 3, true)
+	alice := login(t, clients[0], "alice")
+	serverID, channelID := testChannel(t, clients[0], alice)
+
+	// Relay to a node that does not own the channel, so the edit has to
+	// reach the owner
+	node := -1
+	eventually(t, 5*time.Second, func() bool {
+		for i, s := range servers {
+			s.mu.Lock()
+			owner := s.owners[channelID]
+			s.mu.Unlock()
+			if owner != "" && owner != string(s.replication.id) {
+				node = i
+				return true
+			}
+		}
+		return false
+	})
+	peer := &federationPeer{name: "branch", seen: make(map[string]bool)}
+	f := &federation{
+		s:     servers[node],
+		peers: map[string]*federationPeer{"branch": peer},
+		links: map[linkKey]*pb.ChannelLink{
+			{peer: "branch", link: "offices"}: {ServerId: serverID, ChannelId: channelID, Peer: "branch", Link: "offices"},
+		},
+	}
+
+	created := &pb.FederatedEvent{Id: "remote-1", Link: "offices", Payload: &pb.FederatedEvent_MessageCreated{MessageCreated: &pb.Message{Username: "bob", Text: "helo"}}}
+	if err := f.apply(peer, created); err != nil {
+		t.Fatal(err)
+	}
+	edited := &pb.FederatedEvent{Id: "remote-2", Link: "offices", Payload: &pb.FederatedEvent_MessageEdited{MessageEdited: &pb.Message{Id: "remote-1", Text: "hello"}}}
+	if err := f.apply(peer, edited); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := listMessages(t, clients[node], alice, serverID, channelID)
+	if len(messages) != 1 || messages[0].GetText() != "hello" || messages[0].GetEditedAt() == nil {
+		t.Fatalf("got %v, want the edited message", messages)
+	}
+}
+
+func TestFederationStateSurvivesRestarts(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "federation.state")
+	// Nothing listens on the peer, so relayed events stay in the outbox
+	peers := []federationPeerConfig{{Name: "branch", Address: freeAddress(t), Secret: "shared"}}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, client := startFederatedInstance(t, "hq", lis, peers, stateFile)
+	alice := login(t, client, "alice")
+	serverID, channelID := testChannel(t, client, alice)
+	_, err = client.LinkChannel(alice, &pb.LinkChannelRequest{ServerId: serverID, ChannelId: channelID, Peer: "branch", Link: "offices"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "queued"}); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, 5*time.Second, func() bool {
+		data, err := os.ReadFile(stateFile)
+		if err != nil {
+			return false
+		}
+		var state pb.FederationState
+		if err := proto.Unmarshal(data, &state); err != nil {
+			t.Fatal(err)
+		}
+		return len(state.GetLinks()) == 1 && len(state.GetPeers()) == 1 && len(state.GetPeers()[0].GetOutbox()) == 1
+	})
+
+	lis, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted, _ := startFederatedInstance(t, "hq", lis, peers, stateFile)
+	f := restarted.federation
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	link := f.links[linkKey{peer: "branch", link: "offices"}]
+	if link.GetChannelId() != channelID {
+		t.Fatalf("got link %v after the restart, want the link of channel %s", link, channelID)
+	}
+	outbox := f.peers["branch"].outbox
+	if len(outbox) != 1 || outbox[0].GetMessageCreated().GetText() != "queued" {
+		t.Fatalf("got outbox %v after the restart, want the queued message", outbox)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// openAPIDocument describes the REST gateway.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// maxGatewayBody limits the size of a JSON request to the gateway.
+const maxGatewayBody = 1 << 20
+
+var (
+	gatewayMarshal   = protojson.MarshalOptions{UseProtoNames: true}
+	gatewayUnmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// gateway translates REST/JSON requests into calls to the ChatServer service,
+// in the style of grpc-gateway. It talks to the gRPC server like any other
+// client so every request goes through the same checks.
+type gateway struct {
+	client pb.ChatServerClient
+	// authenticate resolves the user the credentials of a request belong to
+	authenticate func(ctx context.Context) (string, bool)
+}
+
+func (g *gateway) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPIDocument)
+	})
+	mux.HandleFunc("POST /v1/login", g.login)
+	mux.HandleFunc("POST /v1/servers", g.createChatServer)
+	mux.HandleFunc("GET /v1/servers/{server_id}/channels", g.listChannels)
+	mux.HandleFunc("POST /v1/servers/{server_id}/channels", g.createChannel)
+	mux.HandleFunc("GET /v1/servers/{server_id}/channels/{channel_id}/messages", g.listMessages)
+	mux.HandleFunc("POST /v1/servers/{server_id}/channels/{channel_id}/messages", g.sendMessage)
+}
+
+// requestCredentials returns the credentials of an HTTP request as gRPC
+// metadata. The Authorization header carries the token returned by Login,
+// with or without a Bearer prefix, and bots send X-Api-Key.
+func requestCredentials(r *http.Request) metadata.MD {
+	md := metadata.MD{}
+	if token := r.Header.Get("Authorization"); token != "" {
+		md.Set("authorization", strings.TrimSpace(strings.TrimPrefix(token, "Bearer ")))
+	}
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		md.Set(apiKeyHeader, key)
+	}
+	return md
+}
+
+// outgoingContext forwards the credentials of an HTTP request to the gRPC
+// server.
+func outgoingContext(r *http.Request) context.Context {
+	return metadata.NewOutgoingContext(r.Context(), requestCredentials(r))
+}
+
+// readRequest decodes the JSON body of r into req. An empty body leaves req
+// unchanged.
+func readRequest(w http.ResponseWriter, r *http.Request, req proto.Message) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGatewayBody))
+	if err != nil {
+		writeGRPCError(w, status.Error(codes.InvalidArgument, "body is too large"))
+		return false
+	}
+	if len(body) == 0 {
+		return true
+	}
+	if err := gatewayUnmarshal.Unmarshal(body, req); err != nil {
+		writeGRPCError(w, status.Errorf(codes.InvalidArgument, "invalid JSON body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeResponse(w http.ResponseWriter, resp proto.Message, err error) {
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	body, err := marshalJSON(resp)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+	w.Write([]byte("\n"))
+}
+
+// marshalJSON encodes a protobuf message as compact JSON. protojson adds
+// random whitespace on purpose to keep clients from depending on its output
+// byte for byte.
+func marshalJSON(m proto.Message) ([]byte, error) {
+	body, err := gatewayMarshal.Marshal(m)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode response: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, body); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode response: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeGRPCError answers with the HTTP status matching a gRPC error and a
+// body like {"code": 5, "message": "..."}.
+func writeGRPCError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	writeJSON(w, httpStatusFromCode(st.Code()), map[string]interface{}{
+		"code":    st.Code(),
+		"message": st.Message(),
+	})
+}
+
+// httpStatusFromCode maps gRPC codes to HTTP statuses like grpc-gateway does.
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func (g *gateway) login(w http.ResponseWriter, r *http.Request) {
+	req := &pb.LoginRequest{}
+	if !readRequest(w, r, req) {
+		return
+	}
+	resp, err := g.client.Login(outgoingContext(r), req)
+	writeResponse(w, resp, err)
+}
+
+func (g *gateway) createChatServer(w http.ResponseWriter, r *http.Request) {
+	req := &pb.CreateChatServerRequest{}
+	if !readRequest(w, r, req) {
+		return
+	}
+	resp, err := g.client.CreateChatServer(outgoingContext(r), req)
+	writeResponse(w, resp, err)
+}
+
+func (g *gateway) listChannels(w http.ResponseWriter, r *http.Request) {
+	req := &pb.ListChannelsRequest{ServerId: r.PathValue("server_id")}
+	resp, err := g.client.ListChannels(outgoingContext(r), req)
+	writeResponse(w, resp, err)
+}
+
+func (g *gateway) createChannel(w http.ResponseWriter, r *http.Request) {
+	req := &pb.CreateChannelRequest{}
+	if !readRequest(w, r, req) {
+		return
+	}
+	req.ServerId = r.PathValue("server_id")
+	resp, err := g.client.CreateChannel(outgoingContext(r), req)
+	writeResponse(w, resp, err)
+}
+
+// listMessages collects the ListMessages stream into {"messages": [...]}.
+func (g *gateway) listMessages(w http.ResponseWriter, r *http.Request) {
+	stream, err := g.client.ListMessages(outgoingContext(r), &pb.ListMessagesRequest{
+		ServerId:  r.PathValue("server_id"),
+		ChannelId: r.PathValue("channel_id"),
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	messages := []json.RawMessage{}
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		body, err := marshalJSON(msg)
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+		messages = append(messages, body)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"messages": messages})
+}
+
+// sendMessage posts a single message through a SendMessages stream. The
+// message is always sent as the authenticated user, whatever username the
+// body names.
+func (g *gateway) sendMessage(w http.ResponseWriter, r *http.Request) {
+	username, ok := g.authenticate(metadata.NewIncomingContext(r.Context(), requestCredentials(r)))
+	if !ok {
+		writeGRPCError(w, status.Error(codes.Unauthenticated, "missing or invalid bearer token"))
+		return
+	}
+	req := &pb.SendMessageRequest{}
+	if !readRequest(w, r, req) {
+		return
+	}
+	req.ServerId = r.PathValue("server_id")
+	req.ChannelId = r.PathValue("channel_id")
+	req.Username = username
+
+	stream, err := g.client.SendMessages(outgoingContext(r))
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	// A failed send means the stream broke, CloseAndRecv returns why
+	stream.Send(req)
+	resp, err := stream.CloseAndRecv()
+	writeResponse(w, resp, err)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// startTestHTTPServer serves the HTTP endpoints of a new chat server.
+func startTestHTTPServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	s, _ := startTestServer(t)
+	srv := httptest.NewServer(s.httpHandler(dialTestServer(t, s)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// gatewayRequest calls the REST gateway and decodes its JSON answer into v.
+func gatewayRequest(t *testing.T, url, method, path, token, body string, v interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		json.NewDecoder(resp.Body).Decode(v)
+	}
+	return resp.StatusCode
+}
+
+func TestGatewaySendsAsTheAuthenticatedUser(t *testing.T) {
+	srv := startTestHTTPServer(t)
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if code := gatewayRequest(t, srv.URL, "POST", "/v1/login", "", `{"username": "alice", "password": "secret"}`, &login); code != http.StatusOK {
+		t.Fatalf("login answered %d", code)
+	}
+	var created struct {
+		ServerID string `json:"server_id"`
+	}
+	gatewayRequest(t, srv.URL, "POST", "/v1/servers", login.Token, `{"server_name": "test"}`, &created)
+	var channel struct {
+		ChannelID string `json:"channel_id"`
+	}
+	gatewayRequest(t, srv.URL, "POST", "/v1/servers/"+created.ServerID+"/channels", login.Token, `{"channel_name": "general"}`, &channel)
+	messages := "/v1/servers/" + created.ServerID + "/channels/" + channel.ChannelID + "/messages"
+
+	if code := gatewayRequest(t, srv.URL, "POST", messages, "", `{"username": "alice", "text": "spoofed"}`, nil); code != http.StatusUnauthorized {
+		t.Fatalf("message without a token answered %d, want 401", code)
+	}
+	if code := gatewayRequest(t, srv.URL, "POST", messages, "wrong", `{"username": "alice", "text": "spoofed"}`, nil); code != http.StatusUnauthorized {
+		t.Fatalf("message with an invalid token answered %d, want 401", code)
+	}
+	if code := gatewayRequest(t, srv.URL, "POST", messages, login.Token, `{"username": "bob", "text": "hello"}`, nil); code != http.StatusOK {
+		t.Fatalf("message answered %d", code)
+	}
+
+	var list struct {
+		Messages []struct {
+			Username string `json:"username"`
+			Text     string `json:"text"`
+		} `json:"messages"`
+	}
+	if code := gatewayRequest(t, srv.URL, "GET", messages, login.Token, "", &list); code != http.StatusOK {
+		t.Fatalf("listing messages answered %d", code)
+	}
+	if len(list.Messages) != 1 || list.Messages[0].Username != "alice" || list.Messages[0].Text != "hello" {
+		t.Fatalf("messages = %+v", list.Messages)
+	}
+}
+
+func TestConnectOnTheHTTPPort(t *testing.T) {
+	srv := startTestHTTPServer(t)
+
+	req, err := http.NewRequest("POST", srv.URL+"/pb.ChatServer/Login", strings.NewReader(`{"username": "alice", "password": "secret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var login struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&login)
+	if resp.StatusCode != http.StatusOK || login.Token == "" {
+		t.Fatalf("Connect login answered %d with token %q", resp.StatusCode, login.Token)
+	}
+
+	req, err = http.NewRequest("POST", srv.URL+"/pb.ChatServer/CreateChatServer", strings.NewReader(`{"server_name": "test"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated Connect call answered %d, want 401", resp.StatusCode)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+var httpPort = flag.Int("http-port", 8080, "The port of the HTTP listener for the REST gateway, gRPC-Web and Connect, WebSocket bridge, channel event streams and incoming webhooks, 0 disables it")
+
+// httpHandler serves the HTTP endpoints of the chat server, over HTTP/1.1 as
+// well as HTTP/2 with or without TLS. The REST gateway, gRPC-Web and Connect
+// call the gRPC service through conn.
+func (s *server) httpHandler(conn grpc.ClientConnInterface) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hooks/{token}", s.handleIncomingWebhook)
+	mux.HandleFunc("GET /channels/{id}/events", s.handleChannelEvents)
+	(&gateway{client: pb.NewChatServerClient(conn), authenticate: s.userFromContext}).register(mux)
+	mux.Handle("/pb.ChatServer/", &webProxy{conn: conn})
+	mux.Handle("GET /ws", s.webSocketHandler())
+	mux.HandleFunc("GET /ws/schema.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(webSocketSchema)
+	})
+	return h2c.NewHandler(mux, &http2.Server{})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// new events are dropped for it.
+const subscriberBuffer = 64
+
+// hub fans events out to the subscribers of each chat server. Events go
+// through the broker, so subscribers also get the events published on other
+// replicas.
+type hub struct {
+	broker Broker
+
+	// publishMu keeps observers and the broker seeing events in the same
+	// order
+	publishMu sync.Mutex
+	observers []func(*pb.Event)
+
+	mu   sync.Mutex
+	subs map[string]map[chan *pb.Event]struct{}
+}
+
+func newHub(broker Broker) *hub {
+	h := &hub{
+		broker: broker,
+		subs:   make(map[string]map[chan *pb.Event]struct{}),
+	}
+	broker.Subscribe(h.deliver)
+	return h
+}
+
+// subscribe registers a new subscriber for the given chat server. The
+// returned channel must be released with unsubscribe.
+func (h *hub) subscribe(serverID string) chan *pb.Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan *pb.Event, subscriberBuffer)
+	if h.subs[serverID] == nil {
+		h.subs[serverID] = make(map[chan *pb.Event]struct{})
+	}
+	h.subs[serverID][ch] = struct{}{}
+	return ch
+}
+
+func (h *hub) unsubscribe(serverID string, ch chan *pb.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs[serverID], ch)
+	if len(h.subs[serverID]) == 0 {
+		delete(h.subs, serverID)
+	}
+}
+
+// observe registers fn to be called with every event published on this
+// replica. fn is called while publishing and must not block.
+func (h *hub) observe(fn func(*pb.Event)) {
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+
+	h.observers = append(h.observers, fn)
+}
+
+// publish hands an event to the observers and sends it through the broker to
+// the subscribers of its chat server on every replica. If the broker fails,
+// the event only reaches the subscribers of this replica.
+func (h *hub) publish(event *pb.Event) {
+	if event.Timestamp == nil {
+		event.Timestamp = timestamppb.Now()
+	}
+
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+
+	for _, fn := range h.observers {
+		fn(event)
+	}
+	if err := h.broker.Publish(event); err != nil {
+		log.Printf("Failed to publish event for server %s: %v", event.GetServerId(), err)
+		h.deliver(event)
+	}
+}
+
+// deliver hands an event from the broker to every subscriber of its chat
+// server. It never blocks: a subscriber whose buffer is full misses the
+// event.
+func (h *hub) deliver(event *pb.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[event.GetServerId()] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Dropping event for slow subscriber of server %s", event.GetServerId())
+		}
+	}
+}
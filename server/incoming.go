@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	incomingWebhookRate  = flag.Float64("incoming-webhook-rate", 1, "How many messages per second each incoming webhook may post")
+	incomingWebhookBurst = flag.Int("incoming-webhook-burst", 10, "How many messages an incoming webhook may post at once")
+)
+
+// maxIncomingWebhookBody limits the size of a request to an incoming webhook.
+const maxIncomingWebhookBody = 64 << 10
+
+type storedIncomingWebhook struct {
+	info      *pb.IncomingWebhook
+	tokenHash string
+	limiter   *rateLimiter
+}
+
+// incomingWebhookBody is the JSON body accepted by POST /hooks/{token}.
+type incomingWebhookBody struct {
+	Text string `json:"text"`
+}
+
+// CreateIncomingWebhook creates a webhook posting into a channel. Only admins
+// may manage webhooks.
+func (s *server) CreateIncomingWebhook(ctx context.Context, req *pb.CreateIncomingWebhookRequest) (*pb.CreateIncomingWebhookResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	name := req.GetName()
+	if name == "" || strings.ContainsAny(name, " \t@") || name == commandBot {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid webhook name")
+	}
+
+	token, err := newSecret("hook_")
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "failed to generate token: %v", err)
+	}
+
+	if err := s.checkAdmin(req.GetServerId(), username, "webhooks"); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.channels[req.GetServerId()][req.GetChannelId()]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "channel not found")
+	}
+	// Webhook messages must not pass for someone else's
+	if _, exists := s.users[name]; exists || s.isBot(name) {
+		return nil, grpc.Errorf(codes.AlreadyExists, "name %s is taken", name)
+	}
+
+	hook := &storedIncomingWebhook{
+		info: &pb.IncomingWebhook{
+			Id:        uuid.New().String(),
+			ServerId:  req.GetServerId(),
+			ChannelId: req.GetChannelId(),
+			Name:      name,
+			CreatedBy: username,
+			CreatedAt: timestamppb.Now(),
+		},
+		tokenHash: hashSecret(token),
+		limiter:   newRateLimiter(*incomingWebhookRate, *incomingWebhookBurst),
+	}
+	s.incomingHooks[hook.info.Id] = hook
+	s.incomingTokens[hook.tokenHash] = hook.info.Id
+
+	return &pb.CreateIncomingWebhookResponse{
+		Webhook: hook.info,
+		Token:   token,
+		Path:    "/hooks/" + token,
+	}, nil
+}
+
+func (s *server) ListIncomingWebhooks(ctx context.Context, req *pb.ListIncomingWebhooksRequest) (*pb.ListIncomingWebhooksResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if err := s.checkAdmin(req.GetServerId(), username, "webhooks"); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var webhooks []*pb.IncomingWebhook
+	for _, hook := range s.incomingHooks {
+		if hook.info.GetServerId() == req.GetServerId() {
+			webhooks = append(webhooks, hook.info)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].GetCreatedAt().AsTime().Before(webhooks[j].GetCreatedAt().AsTime())
+	})
+
+	return &pb.ListIncomingWebhooksResponse{Webhooks: webhooks}, nil
+}
+
+// DeleteIncomingWebhook revokes an incoming webhook. Its token stops working
+// immediately.
+func (s *server) DeleteIncomingWebhook(ctx context.Context, req *pb.DeleteIncomingWebhookRequest) (*pb.DeleteIncomingWebhookResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if err := s.checkAdmin(req.GetServerId(), username, "webhooks"); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook, exists := s.incomingHooks[req.GetWebhookId()]
+	if !exists || hook.info.GetServerId() != req.GetServerId() {
+		return nil, grpc.Errorf(codes.NotFound, "webhook not found")
+	}
+	delete(s.incomingHooks, req.GetWebhookId())
+	delete(s.incomingTokens, hook.tokenHash)
+
+	return &pb.DeleteIncomingWebhookResponse{}, nil
+}
+
+// handleIncomingWebhook posts the text of a JSON body like {"text": "..."}
+// into the channel of the webhook.
+func (s *server) handleIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	var body incomingWebhookBody
+	r.Body = http.MaxBytesReader(w, r.Body, maxIncomingWebhookBody)
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "body is too large")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "body must be a JSON object")
+		return
+	}
+	if strings.TrimSpace(body.Text) == "" {
+		writeJSONError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.incomingTokens[hashSecret(r.PathValue("token"))]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown webhook")
+		return
+	}
+	hook := s.incomingHooks[id]
+
+	if ok, wait := hook.limiter.allow(time.Now()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+	if _, exists := s.channels[hook.info.GetServerId()][hook.info.GetChannelId()]; !exists {
+		writeJSONError(w, http.StatusGone, "channel no longer exists")
+		return
+	}
+
+	msg, err := s.postMessage(newMessage{
+		serverID:  hook.info.GetServerId(),
+		channelID: hook.info.GetChannelId(),
+		username:  hook.info.GetName(),
+		text:      body.Text,
+		webhook:   true,
+	})
+	if err != nil {
+		code := http.StatusInternalServerError
+		if status.Code(err) == codes.InvalidArgument {
+			code = http.StatusBadRequest
+		}
+		writeJSONError(w, code, status.Convert(err).Message())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": msg.GetId(), "seq": msg.GetSeq()})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+)
+
+func TestIncomingWebhookRateLimit(t *testing.T) {
+	s, client := startTestServer(t)
+	srv := httptest.NewServer(s.httpHandler(dialTestServer(t, s)))
+	t.Cleanup(srv.Close)
+
+	alice := login(t, client, "alice")
+	serverID, channelID := testChannel(t, client, alice)
+	hook, err := client.CreateIncomingWebhook(alice, &pb.CreateIncomingWebhookRequest{ServerId: serverID, ChannelId: channelID, Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func() *http.Response {
+		t.Helper()
+		resp, err := http.Post(srv.URL+hook.GetPath(), "application/json", strings.NewReader(`{"text": "build passed"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for i := 0; i < *incomingWebhookBurst; i++ {
+		if resp := post(); resp.StatusCode != http.StatusOK {
+			t.Fatalf("message %d answered %d within the burst", i+1, resp.StatusCode)
+		}
+	}
+	resp := post()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("answered %d with Retry-After %q past the burst, want 429 with Retry-After", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	messages := listMessages(t, client, alice, serverID, channelID)
+	if len(messages) != *incomingWebhookBurst {
+		t.Fatalf("got %d messages, want %d", len(messages), *incomingWebhookBurst)
+	}
+	if messages[0].GetUsername() != "ci" || !messages[0].GetIsBot() {
+		t.Fatalf("got %v, want a bot message from ci", messages[0])
+	}
+
+	// The limit refills at -incoming-webhook-rate
+	time.Sleep(time.Duration(float64(time.Second) / *incomingWebhookRate))
+	if resp := post(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("answered %d once the limit refilled, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,784 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var ircPort = flag.Int("irc-port", 0, "The port of the IRC gateway, 0 disables it")
+
+// ircServerName is the name the IRC gateway uses as the source of its own
+// replies.
+const ircServerName = "grpc-chat"
+
+const (
+	// maxIRCLine limits lines read from clients, leaving room for IRCv3
+	// message tags in front of the 512 bytes of RFC 1459.
+	maxIRCLine = 8192 + 512
+	// maxIRCMessage is how many bytes of a line, without the trailing CRLF,
+	// the gateway writes at most.
+	maxIRCMessage = 510
+)
+
+// serveIRC accepts IRC clients on lis. IRC channels are named
+// #server/channel, by name or by id, and joining one makes the user a member
+// of the chat server if they are not already.
+func (s *server) serveIRC(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleIRC(conn)
+	}
+}
+
+// ircChannel is a channel an IRC client joined, under the name it used.
+type ircChannel struct {
+	name      string
+	serverID  string
+	channelID string
+}
+
+// ircSession is a single IRC connection.
+type ircSession struct {
+	s    *server
+	conn net.Conn
+
+	// writeMu serializes lines written to conn
+	writeMu sync.Mutex
+
+	// Registration state. username is set once Login succeeded.
+	pass, nick, user string
+	negotiating      bool
+	username         string
+	ctx              context.Context
+	// untrack ends the presence of the registered user
+	untrack func()
+
+	mu sync.Mutex
+	// channels holds the joined channels by lower case name
+	channels map[string]*ircChannel
+	subs     map[string]*ircSubscription
+	// joinedServers holds the chat servers the session made the user a
+	// member of, which parting their last channel leaves again
+	joinedServers map[string]bool
+}
+
+// ircSubscription follows the events of a chat server for the joined
+// channels in it.
+type ircSubscription struct {
+	events chan *pb.Event
+	done   chan struct{}
+}
+
+// ircMessage is a parsed IRC line.
+type ircMessage struct {
+	command string
+	params  []string
+}
+
+// parseIRCMessage splits a line into its command and parameters, dropping
+// message tags and the prefix.
+func parseIRCMessage(line string) ircMessage {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "@") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+	line = strings.TrimLeft(line, " ")
+	if strings.HasPrefix(line, ":") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+
+	var msg ircMessage
+	for {
+		line = strings.TrimLeft(line, " ")
+		if line == "" {
+			break
+		}
+		if msg.command != "" && strings.HasPrefix(line, ":") {
+			msg.params = append(msg.params, line[1:])
+			break
+		}
+		var word string
+		word, line, _ = strings.Cut(line, " ")
+		if msg.command == "" {
+			msg.command = strings.ToUpper(word)
+		} else {
+			msg.params = append(msg.params, word)
+		}
+	}
+	return msg
+}
+
+func (s *server) handleIRC(conn net.Conn) {
+	defer conn.Close()
+
+	sess := &ircSession{
+		s:             s,
+		conn:          conn,
+		ctx:           context.Background(),
+		channels:      make(map[string]*ircChannel),
+		subs:          make(map[string]*ircSubscription),
+		joinedServers: make(map[string]bool),
+	}
+	defer func() {
+		sess.partAll()
+		if sess.untrack != nil {
+			sess.untrack()
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxIRCLine)
+	for scanner.Scan() {
+		msg := parseIRCMessage(scanner.Text())
+		if msg.command == "" {
+			continue
+		}
+		if !sess.handle(msg) {
+			return
+		}
+	}
+}
+
+// send writes a line from prefix to the client. The last parameter may
+// contain spaces.
+func (sess *ircSession) send(prefix, command string, params ...string) error {
+	var line strings.Builder
+	line.WriteString(":" + prefix + " " + command)
+	for i, param := range params {
+		param = strings.NewReplacer("\r", "", "\n", " ", "\x00", "").Replace(param)
+		if i == len(params)-1 && (param == "" || strings.Contains(param, " ") || strings.HasPrefix(param, ":")) {
+			param = ":" + param
+		}
+		line.WriteString(" " + param)
+	}
+	line.WriteString("\r\n")
+
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+	_, err := sess.conn.Write([]byte(line.String()))
+	return err
+}
+
+// reply sends a numeric reply from the gateway.
+func (sess *ircSession) reply(numeric string, params ...string) error {
+	target := sess.nick
+	if target == "" {
+		target = "*"
+	}
+	return sess.send(ircServerName, numeric, append([]string{target}, params...)...)
+}
+
+// ircPrefix returns the IRC source of a chat user.
+func ircPrefix(username string) string {
+	return username + "!" + username + "@" + ircServerName
+}
+
+// handle applies a command of the client and reports whether the connection
+// stays open.
+func (sess *ircSession) handle(msg ircMessage) bool {
+	param := func(i int) string {
+		if i < len(msg.params) {
+			return msg.params[i]
+		}
+		return ""
+	}
+
+	switch msg.command {
+	case "CAP":
+		switch strings.ToUpper(param(0)) {
+		case "LS":
+			sess.negotiating = sess.username == ""
+			sess.send(ircServerName, "CAP", "*", "LS", "")
+		case "LIST":
+			sess.send(ircServerName, "CAP", "*", "LIST", "")
+		case "REQ":
+			sess.send(ircServerName, "CAP", "*", "NAK", param(1))
+		case "END":
+			sess.negotiating = false
+			return sess.register()
+		}
+		return true
+	case "PASS":
+		if sess.username != "" {
+			sess.reply("462", "You may not reregister")
+			return true
+		}
+		sess.pass = param(0)
+		return true
+	case "NICK":
+		if sess.username != "" {
+			if param(0) != sess.username {
+				sess.reply("484", "Nick changes are not supported")
+			}
+			return true
+		}
+		if !validIRCNick(param(0)) {
+			sess.reply("432", param(0), "Erroneous nickname")
+			return true
+		}
+		sess.nick = param(0)
+		return sess.register()
+	case "USER":
+		if sess.username != "" {
+			sess.reply("462", "You may not reregister")
+			return true
+		}
+		if len(msg.params) < 4 {
+			sess.reply("461", "USER", "Not enough parameters")
+			return true
+		}
+		sess.user = param(0)
+		return sess.register()
+	case "PING":
+		sess.send(ircServerName, "PONG", ircServerName, param(0))
+		return true
+	case "PONG":
+		return true
+	case "QUIT":
+		sess.send(ircServerName, "ERROR", "Closing link: "+param(0))
+		return false
+	}
+
+	if sess.username == "" {
+		sess.reply("451", "You have not registered")
+		return true
+	}
+
+	switch msg.command {
+	case "JOIN":
+		if len(msg.params) == 0 {
+			sess.reply("461", "JOIN", "Not enough parameters")
+			break
+		}
+		if param(0) == "0" {
+			sess.mu.Lock()
+			var names []string
+			for _, ch := range sess.channels {
+				names = append(names, ch.name)
+			}
+			sess.mu.Unlock()
+			for _, name := range names {
+				sess.part(name, "")
+			}
+			break
+		}
+		for _, name := range strings.Split(param(0), ",") {
+			sess.join(name)
+		}
+	case "PART":
+		if len(msg.params) == 0 {
+			sess.reply("461", "PART", "Not enough parameters")
+			break
+		}
+		for _, name := range strings.Split(param(0), ",") {
+			sess.part(name, param(1))
+		}
+	case "PRIVMSG", "NOTICE":
+		if len(msg.params) < 2 {
+			if msg.command == "PRIVMSG" {
+				sess.reply("412", "No text to send")
+			}
+			break
+		}
+		sess.privmsg(param(0), param(1), msg.command == "NOTICE")
+	case "TOPIC":
+		sess.topic(param(0), msg.params)
+	case "NAMES":
+		for _, name := range strings.Split(param(0), ",") {
+			if ch := sess.channel(name); ch != nil {
+				sess.names(ch)
+			}
+		}
+	case "LIST":
+		sess.list()
+	case "MODE":
+		if strings.HasPrefix(param(0), "#") {
+			sess.reply("324", param(0), "+nt")
+		} else if param(0) == sess.nick {
+			sess.reply("221", "+")
+		}
+	case "WHO":
+		sess.reply("315", param(0), "End of WHO list")
+	default:
+		sess.reply("421", msg.command, "Unknown command")
+	}
+	return true
+}
+
+func validIRCNick(nick string) bool {
+	if nick == "" || strings.ContainsAny(nick, " ,*?!@.") || strings.ContainsAny(nick[:1], "#&:$+%~0123456789-") {
+		return false
+	}
+	return nick != commandBot
+}
+
+// register logs the client in once it sent both NICK and USER.
+func (sess *ircSession) register() bool {
+	if sess.username != "" || sess.nick == "" || sess.user == "" || sess.negotiating {
+		return true
+	}
+
+	s := sess.s
+	res, err := s.Login(context.Background(), &pb.LoginRequest{Username: sess.nick, Password: sess.pass})
+	if err != nil {
+		sess.reply("464", status.Convert(err).Message())
+		sess.send(ircServerName, "ERROR", "Closing link: "+status.Convert(err).Message())
+		return false
+	}
+	sess.username = sess.nick
+	sess.ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", res.GetToken()))
+	sess.untrack = s.trackStream(sess.ctx)
+	log.Printf("IRC client %s logged in as %s", sess.conn.RemoteAddr(), sess.username)
+
+	sess.reply("001", "Welcome to the gRPC chat, "+sess.nick)
+	sess.reply("002", "Your host is "+ircServerName)
+	sess.reply("004", ircServerName, "1.0", "i", "nt")
+	sess.reply("005", "CHANTYPES=#", "CASEMAPPING=ascii", "PREFIX=(oh)@%", "are supported by this server")
+	sess.reply("422", "MOTD File is missing")
+	return true
+}
+
+// resolveIRCChannel finds the chat server and channel an IRC channel name of
+// the form #server/channel refers to. Both parts may be a name or an id. The
+// caller must hold s.mu.
+func (s *server) resolveIRCChannel(name string) (serverID, channelID string, err error) {
+	rest, ok := strings.CutPrefix(name, "#")
+	serverPart, channelPart, found := strings.Cut(rest, "/")
+	if !ok || !found || serverPart == "" || channelPart == "" {
+		return "", "", fmt.Errorf("channels are named #server/channel")
+	}
+
+	var servers []string
+	for id, chatServer := range s.servers {
+		if id == serverPart {
+			servers = []string{id}
+			break
+		}
+		if strings.EqualFold(chatServer.Name, serverPart) {
+			servers = append(servers, id)
+		}
+	}
+	switch len(servers) {
+	case 0:
+		return "", "", fmt.Errorf("chat server not found")
+	case 1:
+		serverID = servers[0]
+	default:
+		return "", "", fmt.Errorf("several chat servers are named %s, use the id", serverPart)
+	}
+
+	var channels []string
+	for id, channelName := range s.channels[serverID] {
+		if id == channelPart {
+			channels = []string{id}
+			break
+		}
+		if strings.EqualFold(channelName, channelPart) {
+			channels = append(channels, id)
+		}
+	}
+	switch len(channels) {
+	case 0:
+		return "", "", fmt.Errorf("channel not found")
+	case 1:
+		return serverID, channels[0], nil
+	default:
+		return "", "", fmt.Errorf("several channels are named %s, use the id", channelPart)
+	}
+}
+
+// ircChannelName names a channel for IRC, by name where the names are valid
+// and unambiguous and by id otherwise. The caller must hold s.mu.
+func (s *server) ircChannelName(serverID, channelID string) string {
+	name := "#" + s.servers[serverID].Name + "/" + s.channels[serverID][channelID]
+	if !strings.ContainsAny(name, " ,\x07") {
+		if sid, cid, err := s.resolveIRCChannel(name); err == nil && sid == serverID && cid == channelID {
+			return name
+		}
+	}
+	return "#" + serverID + "/" + channelID
+}
+
+// channel returns the joined channel of the given name, or nil.
+func (sess *ircSession) channel(name string) *ircChannel {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	return sess.channels[strings.ToLower(name)]
+}
+
+func (sess *ircSession) join(name string) {
+	if sess.channel(name) != nil {
+		return
+	}
+
+	s := sess.s
+	s.mu.Lock()
+	serverID, channelID, err := s.resolveIRCChannel(name)
+	member := err == nil && s.isMember(serverID, sess.username)
+	s.mu.Unlock()
+	if err != nil {
+		sess.reply("403", name, err.Error())
+		return
+	}
+
+	if !member {
+		if _, err := s.JoinChatServer(sess.ctx, &pb.JoinChatServerRequest{ServerId: serverID, Username: sess.username}); err != nil {
+			sess.reply("403", name, status.Convert(err).Message())
+			return
+		}
+	}
+
+	sess.mu.Lock()
+	if !member {
+		sess.joinedServers[serverID] = true
+	}
+	sess.channels[strings.ToLower(name)] = &ircChannel{name: name, serverID: serverID, channelID: channelID}
+	if _, ok := sess.subs[serverID]; !ok {
+		sub := &ircSubscription{
+			events: s.hub.subscribe(serverID),
+			done:   make(chan struct{}),
+		}
+		sess.subs[serverID] = sub
+		go sess.forward(serverID, sub)
+	}
+	ch := sess.channels[strings.ToLower(name)]
+	sess.mu.Unlock()
+
+	sess.send(ircPrefix(sess.username), "JOIN", name)
+	s.mu.Lock()
+	topic := s.topics[channelID]
+	s.mu.Unlock()
+	if topic != "" {
+		sess.reply("332", name, topic)
+	} else {
+		sess.reply("331", name, "No topic is set")
+	}
+	sess.names(ch)
+}
+
+func (sess *ircSession) part(name, reason string) {
+	sess.mu.Lock()
+	ch, ok := sess.channels[strings.ToLower(name)]
+	if !ok {
+		sess.mu.Unlock()
+		sess.reply("442", name, "You're not on that channel")
+		return
+	}
+	leave := sess.forget(ch)
+	sess.mu.Unlock()
+
+	params := []string{ch.name}
+	if reason != "" {
+		params = append(params, reason)
+	}
+	sess.send(ircPrefix(sess.username), "PART", params...)
+	if leave {
+		sess.s.LeaveChatServer(sess.ctx, &pb.LeaveChatServerRequest{ServerId: ch.serverID, Username: sess.username})
+	}
+}
+
+// partAll parts every joined channel without telling the client, once the
+// connection closes.
+func (sess *ircSession) partAll() {
+	sess.mu.Lock()
+	var leave []string
+	for _, ch := range sess.channels {
+		if sess.forget(ch) {
+			leave = append(leave, ch.serverID)
+		}
+	}
+	sess.mu.Unlock()
+
+	for _, serverID := range leave {
+		sess.s.LeaveChatServer(sess.ctx, &pb.LeaveChatServerRequest{ServerId: serverID, Username: sess.username})
+	}
+}
+
+// forget removes a joined channel and stops following its chat server once no
+// channel of it is left. It reports whether the user should leave the chat
+// server because the session made them a member. The caller must hold
+// sess.mu.
+func (sess *ircSession) forget(ch *ircChannel) bool {
+	delete(sess.channels, strings.ToLower(ch.name))
+	for _, other := range sess.channels {
+		if other.serverID == ch.serverID {
+			return false
+		}
+	}
+
+	if sub, ok := sess.subs[ch.serverID]; ok {
+		sess.s.hub.unsubscribe(ch.serverID, sub.events)
+		close(sub.done)
+		delete(sess.subs, ch.serverID)
+	}
+	leave := sess.joinedServers[ch.serverID]
+	delete(sess.joinedServers, ch.serverID)
+	return leave
+}
+
+// privmsg posts a message to a joined channel. NOTICE never gets error
+// replies.
+func (sess *ircSession) privmsg(target, text string, notice bool) {
+	ch := sess.channel(target)
+	if ch == nil {
+		if notice {
+			return
+		}
+		if strings.HasPrefix(target, "#") {
+			sess.reply("404", target, "Cannot send to channel, join it first")
+		} else {
+			sess.reply("401", target, "Direct messages are not supported")
+		}
+		return
+	}
+
+	// CTCP ACTION, sent by /me in IRC clients, maps onto the /me command
+	if action, ok := strings.CutPrefix(text, "\x01ACTION "); ok {
+		text = "/me " + strings.TrimSuffix(action, "\x01")
+	} else if strings.HasPrefix(text, "\x01") {
+		return
+	}
+
+	s := sess.s
+	s.mu.Lock()
+	var err error
+	if _, exists := s.channels[ch.serverID][ch.channelID]; !exists {
+		err = fmt.Errorf("channel not found")
+	} else {
+		_, err = s.postMessage(newMessage{
+			serverID:  ch.serverID,
+			channelID: ch.channelID,
+			username:  sess.username,
+			text:      text,
+		})
+	}
+	s.mu.Unlock()
+	if err != nil && !notice {
+		sess.reply("404", ch.name, status.Convert(err).Message())
+	}
+}
+
+// topic shows the topic of a joined channel or sets it through the /topic
+// command, which checks the user's role.
+func (sess *ircSession) topic(name string, params []string) {
+	ch := sess.channel(name)
+	if ch == nil {
+		sess.reply("442", name, "You're not on that channel")
+		return
+	}
+	if len(params) > 1 {
+		sess.privmsg(ch.name, "/topic "+params[1], false)
+		return
+	}
+
+	s := sess.s
+	s.mu.Lock()
+	topic := s.topics[ch.channelID]
+	s.mu.Unlock()
+	if topic == "" {
+		sess.reply("331", ch.name, "No topic is set")
+		return
+	}
+	sess.reply("332", ch.name, topic)
+}
+
+// names lists the members of the chat server of a channel, with @ for
+// owners and admins and % for moderators.
+func (sess *ircSession) names(ch *ircChannel) {
+	s := sess.s
+	s.mu.Lock()
+	var names []string
+	for username, role := range s.members[ch.serverID] {
+		switch role {
+		case roleOwner, roleAdmin:
+			username = "@" + username
+		case roleModerator:
+			username = "%" + username
+		}
+		names = append(names, username)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+
+	// Keep every reply within the line limit
+	var line []string
+	size := 0
+	for _, name := range names {
+		if size+len(name) > 400 {
+			sess.reply("353", "=", ch.name, strings.Join(line, " "))
+			line, size = nil, 0
+		}
+		line = append(line, name)
+		size += len(name) + 1
+	}
+	if len(line) > 0 {
+		sess.reply("353", "=", ch.name, strings.Join(line, " "))
+	}
+	sess.reply("366", ch.name, "End of /NAMES list")
+}
+
+// list shows the channels of every chat server the user is a member of.
+func (sess *ircSession) list() {
+	s := sess.s
+	s.mu.Lock()
+	type entry struct{ name, count, topic string }
+	var entries []entry
+	for serverID := range s.servers {
+		if !s.isMember(serverID, sess.username) {
+			continue
+		}
+		for channelID := range s.channels[serverID] {
+			entries = append(entries, entry{
+				name:  s.ircChannelName(serverID, channelID),
+				count: fmt.Sprint(len(s.members[serverID])),
+				topic: s.topics[channelID],
+			})
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	sess.reply("321", "Channel", "Users Name")
+	for _, e := range entries {
+		sess.reply("322", e.name, e.count, e.topic)
+	}
+	sess.reply("323", "End of /LIST")
+}
+
+// forward relays the events of a chat server to the client for every joined
+// channel they belong to.
+func (sess *ircSession) forward(serverID string, sub *ircSubscription) {
+	for {
+		select {
+		case <-sub.done:
+			return
+		case event := <-sub.events:
+			if !visibleTo(event, sess.username) {
+				continue
+			}
+
+			sess.mu.Lock()
+			var channels []*ircChannel
+			for _, ch := range sess.channels {
+				if ch.serverID == serverID {
+					channels = append(channels, ch)
+				}
+			}
+			sess.mu.Unlock()
+
+			for _, ch := range channels {
+				if err := sess.deliver(ch, event); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver relays a single event to the client as seen in a joined channel.
+func (sess *ircSession) deliver(ch *ircChannel, event *pb.Event) error {
+	switch p := event.GetPayload().(type) {
+	case *pb.Event_MessageCreated:
+		if p.MessageCreated.GetChannelId() != ch.channelID {
+			return nil
+		}
+		msg := p.MessageCreated.GetMessage()
+		// IRC clients show their own messages without an echo
+		if msg.GetUsername() == sess.username && msg.GetVisibleTo() == "" {
+			return nil
+		}
+		command := "PRIVMSG"
+		if msg.GetVisibleTo() != "" {
+			command = "NOTICE"
+		}
+		for _, text := range ircLines(msg) {
+			for _, part := range splitIRCText(text, maxIRCMessage-len(":"+ircPrefix(msg.GetUsername())+" "+command+" "+ch.name+" :")) {
+				if err := sess.send(ircPrefix(msg.GetUsername()), command, ch.name, part); err != nil {
+					return err
+				}
+			}
+		}
+	case *pb.Event_MemberJoined:
+		if p.MemberJoined.GetUsername() != sess.username {
+			return sess.send(ircPrefix(p.MemberJoined.GetUsername()), "JOIN", ch.name)
+		}
+	case *pb.Event_MemberLeft:
+		left := p.MemberLeft.GetUsername()
+		if left == sess.username {
+			sess.mu.Lock()
+			sess.forget(ch)
+			sess.mu.Unlock()
+		}
+		if kicker := p.MemberLeft.GetKickedBy(); kicker != "" {
+			return sess.send(ircPrefix(kicker), "KICK", ch.name, left, "Kicked by "+kicker)
+		}
+		if left != sess.username {
+			return sess.send(ircPrefix(left), "PART", ch.name)
+		}
+		return sess.send(ircPrefix(left), "PART", ch.name, "Left the chat server")
+	case *pb.Event_ChannelTopicChanged:
+		if p.ChannelTopicChanged.GetChannelId() == ch.channelID {
+			return sess.send(ircPrefix(p.ChannelTopicChanged.GetChangedBy()), "TOPIC", ch.name, p.ChannelTopicChanged.GetTopic())
+		}
+	case *pb.Event_ChannelDeleted:
+		if p.ChannelDeleted.GetChannelId() == ch.channelID {
+			sess.mu.Lock()
+			sess.forget(ch)
+			sess.mu.Unlock()
+			return sess.send(ircPrefix(sess.username), "PART", ch.name, "Channel deleted")
+		}
+	}
+	return nil
+}
+
+// ircLines turns a message into the lines to send over IRC. Messages posted
+// with /me become CTCP ACTIONs and attachments are listed by name.
+func ircLines(msg *pb.Message) []string {
+	var lines []string
+	if msg.GetText() != "" {
+		lines = strings.Split(strings.ReplaceAll(msg.GetText(), "\r\n", "\n"), "\n")
+	}
+	if action, ok := strings.CutPrefix(msg.GetText(), "* "+msg.GetUsername()+" "); ok && len(lines) == 1 {
+		lines[0] = "\x01ACTION " + action + "\x01"
+	}
+	for _, attachment := range msg.GetAttachments() {
+		lines = append(lines, fmt.Sprintf("[attachment %s: %s]", attachment.GetId(), attachment.GetFilename()))
+	}
+	return lines
+}
+
+// splitIRCText splits text into parts of at most max bytes without breaking
+// UTF-8 sequences.
+func splitIRCText(text string, max int) []string {
+	if max < utf8.UTFMax {
+		max = utf8.UTFMax
+	}
+	var parts []string
+	for len(text) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		parts = append(parts, text[:cut])
+		text = text[cut:]
+	}
+	return append(parts, text)
+}
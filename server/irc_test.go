@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+)
+
+// ircClient is a connection to the IRC gateway.
+type ircClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialIRC serves the IRC gateway of s and connects to it.
+func dialIRC(t *testing.T, s *server) *ircClient {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	go s.serveIRC(lis)
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &ircClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *ircClient) send(t *testing.T, format string, args ...interface{}) {
+	t.Helper()
+	if _, err := fmt.Fprintf(c.conn, format+"\r\n", args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expect reads lines until one contains want, and returns it.
+func (c *ircClient) expect(t *testing.T, want string) string {
+	t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("no line containing %q: %v", want, err)
+		}
+		if strings.Contains(line, want) {
+			return strings.TrimRight(line, "\r\n")
+		}
+	}
+}
+
+func TestIRCGatewaySendsAndReceives(t *testing.T) {
+	s, client := startTestServer(t)
+	alice := login(t, client, "alice")
+	serverID, channelID := testChannel(t, client, alice)
+
+	irc := dialIRC(t, s)
+	irc.send(t, "NICK bob")
+	irc.send(t, "USER bob 0 * :Bob")
+	irc.expect(t, " 001 bob ")
+	irc.send(t, "JOIN #test/general")
+	irc.expect(t, " 366 bob #test/general ")
+
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "hello irc"}); err != nil {
+		t.Fatal(err)
+	}
+	if line := irc.expect(t, "PRIVMSG"); line != ":alice!alice@"+ircServerName+" PRIVMSG #test/general :hello irc" {
+		t.Fatalf("got %q", line)
+	}
+
+	irc.send(t, "PRIVMSG #test/general :hello grpc")
+	eventually(t, 2*time.Second, func() bool {
+		messages := listMessages(t, client, alice, serverID, channelID)
+		return len(messages) == 2 && messages[1].GetUsername() == "bob" && messages[1].GetText() == "hello grpc"
+	})
+}
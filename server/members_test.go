@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/codes"
+)
+
+func TestJoinAndLeaveActOnCaller(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, mallory := login(t, client, "alice"), login(t, client, "mallory")
+	serverID, _ := testChannel(t, client, alice)
+
+	_, err := client.JoinChatServer(context.Background(), &pb.JoinChatServerRequest{ServerId: serverID, Username: "mallory"})
+	wantCode(t, err, codes.Unauthenticated)
+	_, err = client.LeaveChatServer(context.Background(), &pb.LeaveChatServerRequest{ServerId: serverID, Username: "alice"})
+	wantCode(t, err, codes.Unauthenticated)
+	_, err = client.JoinChatServer(mallory, &pb.JoinChatServerRequest{ServerId: serverID, Username: "bob"})
+	wantCode(t, err, codes.PermissionDenied)
+
+	if _, err := client.JoinChatServer(mallory, &pb.JoinChatServerRequest{ServerId: serverID}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.LeaveChatServer(mallory, &pb.LeaveChatServerRequest{ServerId: serverID, Username: "alice"})
+	wantCode(t, err, codes.PermissionDenied)
+
+	// alice is still the owner
+	if _, err := client.SetRole(alice, &pb.SetRoleRequest{ServerId: serverID, Username: "mallory", Role: roleModerator}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.LeaveChatServer(mallory, &pb.LeaveChatServerRequest{ServerId: serverID, Username: "mallory"}); err != nil {
+		t.Fatal(err)
+	}
+	members, err := client.ListMembers(alice, &pb.ListMembersRequest{ServerId: serverID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range members.GetMembers() {
+		if member.GetUsername() == "mallory" {
+			t.Fatalf("mallory is still a member: %v", members.GetMembers())
+		}
+	}
+}
+
+func TestSubscribeRequiresMember(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, bob, mallory := login(t, client, "alice"), login(t, client, "bob"), login(t, client, "mallory")
+	serverID, channelID := testChannel(t, client, alice)
+	if _, err := client.JoinChatServer(bob, &pb.JoinChatServerRequest{ServerId: serverID}); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.Subscribe(mallory, &pb.SubscribeRequest{ServerId: serverID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	wantCode(t, err, codes.PermissionDenied)
+
+	stream, err = client.Subscribe(bob, &pb.SubscribeRequest{ServerId: serverID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait until the server has subscribed the stream
+	time.Sleep(50 * time.Millisecond)
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "/kick bob"}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			wantCode(t, err, codes.PermissionDenied)
+			break
+		}
+		if event.GetMemberLeft() != nil {
+			t.Fatalf("the stream went on after bob was kicked")
+		}
+	}
+}
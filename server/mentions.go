@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// parseMentions finds the @mentions in text that refer to a member, a role or
+// everyone in the chat server. @everyone only counts as a mention when the
+// sender is at least a moderator. The caller must hold s.mu.
+func (s *server) parseMentions(serverID, sender, text string) []*pb.Mention {
+	var mentions []*pb.Mention
+	for i := 0; i < len(text); i++ {
+		if text[i] != '@' || (i > 0 && !isSpace(text[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(text) && isNameByte(text[end]) {
+			end++
+		}
+		// Allow mentions at the end of a sentence
+		for end > i+1 && text[end-1] == '.' {
+			end--
+		}
+		name := text[i+1 : end]
+		if name == "" {
+			continue
+		}
+
+		mention := &pb.Mention{Target: name, Offset: int32(i), Length: int32(end - i)}
+		switch {
+		case name == "everyone":
+			if !s.hasRole(serverID, sender, roleModerator) {
+				continue
+			}
+			mention.Kind = pb.Mention_EVERYONE
+		case s.isMember(serverID, name):
+			mention.Kind = pb.Mention_USER
+		case s.isRole(serverID, name):
+			mention.Kind = pb.Mention_ROLE
+		default:
+			continue
+		}
+		mentions = append(mentions, mention)
+		i = end - 1
+	}
+	return mentions
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+func isNameByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' ||
+		b == '_' || b == '-' || b == '.'
+}
+
+// isMember reports whether the user belongs to the chat server. The caller
+// must hold s.mu.
+func (s *server) isMember(serverID, username string) bool {
+	_, ok := s.members[serverID][username]
+	return ok
+}
+
+// isRole reports whether role is a built-in role or is held by a member of
+// the chat server. The caller must hold s.mu.
+func (s *server) isRole(serverID, role string) bool {
+	if _, ok := roleRanks[role]; ok {
+		return true
+	}
+	for _, memberRole := range s.members[serverID] {
+		if memberRole == role {
+			return true
+		}
+	}
+	return false
+}
+
+// mentioned reports whether a message mentions the user, directly, through
+// their role or through @everyone.
+func mentioned(msg *pb.Message, username, role string) bool {
+	for _, mention := range msg.GetMentions() {
+		switch mention.GetKind() {
+		case pb.Mention_EVERYONE:
+			return true
+		case pb.Mention_USER:
+			if mention.GetTarget() == username {
+				return true
+			}
+		case pb.Mention_ROLE:
+			if mention.GetTarget() == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// notifyMentions delivers a notification to every member mentioned by the
+// message other than its sender. The caller must hold s.mu.
+func (s *server) notifyMentions(serverID, channelID string, msg *pb.Message) {
+	if len(msg.GetMentions()) == 0 {
+		return
+	}
+
+	for username, role := range s.members[serverID] {
+		if username == msg.GetUsername() || !mentioned(msg, username, role) {
+			continue
+		}
+		s.notifier.notify(username, &pb.Notification{
+			Id:        uuid.New().String(),
+			ServerId:  serverID,
+			ChannelId: channelID,
+			Message:   msg,
+		})
+	}
+}
+
+// notifier keeps a notification inbox per user and pushes new notifications
+// to the user's open streams.
+type notifier struct {
+	mu    sync.Mutex
+	inbox map[string][]*pb.Notification
+	subs  map[string]map[chan *pb.Notification]struct{}
+}
+
+func newNotifier() *notifier {
+	return &notifier{
+		inbox: make(map[string][]*pb.Notification),
+		subs:  make(map[string]map[chan *pb.Notification]struct{}),
+	}
+}
+
+func (n *notifier) notify(username string, notification *pb.Notification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.inbox[username] = append(n.inbox[username], notification)
+	for ch := range n.subs[username] {
+		// The notification stays in the inbox if a stream falls behind
+		select {
+		case ch <- notification:
+		default:
+		}
+	}
+}
+
+func (n *notifier) list(username string) []*pb.Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]*pb.Notification(nil), n.inbox[username]...)
+}
+
+// ack removes a notification from the user's inbox and reports whether it
+// was there.
+func (n *notifier) ack(username, notificationID string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	inbox := n.inbox[username]
+	for i, notification := range inbox {
+		if notification.GetId() == notificationID {
+			n.inbox[username] = append(inbox[:i:i], inbox[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (n *notifier) subscribe(username string) chan *pb.Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ch := make(chan *pb.Notification, subscriberBuffer)
+	if n.subs[username] == nil {
+		n.subs[username] = make(map[chan *pb.Notification]struct{})
+	}
+	n.subs[username][ch] = struct{}{}
+	return ch
+}
+
+func (n *notifier) unsubscribe(username string, ch chan *pb.Notification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.subs[username], ch)
+	if len(n.subs[username]) == 0 {
+		delete(n.subs, username)
+	}
+}
+
+func (s *server) ListNotifications(ctx context.Context, req *pb.ListNotificationsRequest) (*pb.ListNotificationsResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	return &pb.ListNotificationsResponse{Notifications: s.notifier.list(username)}, nil
+}
+
+func (s *server) AckNotification(ctx context.Context, req *pb.AckNotificationRequest) (*pb.AckNotificationResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	if !s.notifier.ack(username, req.GetNotificationId()) {
+		return nil, grpc.Errorf(codes.NotFound, "notification not found")
+	}
+	return &pb.AckNotificationResponse{}, nil
+}
+
+func (s *server) StreamNotifications(req *pb.StreamNotificationsRequest, stream pb.ChatServer_StreamNotificationsServer) error {
+	username, ok := s.userFromContext(stream.Context())
+	if !ok {
+		return grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	defer s.trackStream(stream.Context())()
+
+	notifications := s.notifier.subscribe(username)
+	defer s.notifier.unsubscribe(username, notifications)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case notification := <-notifications:
+			if err := stream.Send(notification); err != nil {
+				return err
+			}
+		}
+	}
+}
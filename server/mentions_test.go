@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+)
+
+// notificationTexts returns the texts of the messages in the user's
+// notification inbox.
+func notificationTexts(t *testing.T, client pb.ChatServerClient, ctx context.Context) []string {
+	t.Helper()
+
+	res, err := client.ListNotifications(ctx, &pb.ListNotificationsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, notification := range res.GetNotifications() {
+		texts = append(texts, notification.GetMessage().GetText())
+	}
+	return texts
+}
+
+func TestRoleAndEveryoneMentions(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, bob, carol := login(t, client, "alice"), login(t, client, "bob"), login(t, client, "carol")
+	serverID, channelID := testChannel(t, client, alice)
+	for _, member := range []context.Context{bob, carol} {
+		if _, err := client.JoinChatServer(member, &pb.JoinChatServerRequest{ServerId: serverID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.SetRole(alice, &pb.SetRoleRequest{ServerId: serverID, Username: "bob", Role: "designer"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Members below moderator cannot notify everyone
+	err := send(carol, client,
+		&pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "@everyone free pizza"},
+		&pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "ping @designer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "@everyone meeting at noon"}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := listMessages(t, client, alice, serverID, channelID)
+	if len(messages[0].GetMentions()) != 0 {
+		t.Fatalf("a member mentioned everyone: %v", messages[0].GetMentions())
+	}
+	if mention := messages[1].GetMentions(); len(mention) != 1 || mention[0].GetKind() != pb.Mention_ROLE || mention[0].GetTarget() != "designer" {
+		t.Fatalf("got mentions %v, want the designer role", mention)
+	}
+
+	want := map[string][]string{
+		"alice": nil,
+		"bob":   {"ping @designer", "@everyone meeting at noon"},
+		"carol": {"@everyone meeting at noon"},
+	}
+	for name, ctx := range map[string]context.Context{"alice": alice, "bob": bob, "carol": carol} {
+		got := notificationTexts(t, client, ctx)
+		if len(got) != len(want[name]) {
+			t.Fatalf("%s got notifications %q, want %q", name, got, want[name])
+		}
+		for i := range got {
+			if got[i] != want[name][i] {
+				t.Fatalf("%s got notifications %q, want %q", name, got, want[name])
+			}
+		}
+	}
+}
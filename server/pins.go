@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxPinsPerChannel limits how many messages a channel can have pinned.
+const maxPinsPerChannel = 50
+
+// PinMessage pins a message to its channel. Only moderators and above may
+// pin.
+func (s *server) PinMessage(ctx context.Context, req *pb.PinMessageRequest) (*pb.PinMessageResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, err := s.channelMessage(req.GetServerId(), req.GetChannelId(), req.GetMessageId(), username)
+	if err != nil {
+		return nil, err
+	}
+	if !s.hasRole(req.GetServerId(), username, roleModerator) {
+		return nil, grpc.Errorf(codes.PermissionDenied, "only moderators can pin messages")
+	}
+
+	_, err = s.commit(&pb.Command{Payload: &pb.Command_PinMessage{PinMessage: &pb.PinMessageCommand{
+		ServerId: req.GetServerId(),
+		Pin: &pb.Pin{
+			ChannelId: req.GetChannelId(),
+			Message:   msg,
+			PinnedBy:  username,
+			PinnedAt:  timestamppb.Now(),
+		},
+	}}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.PinMessageResponse{}, nil
+}
+
+// UnpinMessage removes a pin. Only moderators and above may unpin.
+func (s *server) UnpinMessage(ctx context.Context, req *pb.UnpinMessageRequest) (*pb.UnpinMessageResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkChannelAccess(req.GetServerId(), req.GetChannelId(), username); err != nil {
+		return nil, err
+	}
+	if !s.hasRole(req.GetServerId(), username, roleModerator) {
+		return nil, grpc.Errorf(codes.PermissionDenied, "only moderators can unpin messages")
+	}
+
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_UnpinMessage{UnpinMessage: &pb.UnpinMessageCommand{
+		ServerId:   req.GetServerId(),
+		ChannelId:  req.GetChannelId(),
+		MessageId:  req.GetMessageId(),
+		UnpinnedBy: username,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UnpinMessageResponse{}, nil
+}
+
+func (s *server) ListPins(ctx context.Context, req *pb.ListPinsRequest) (*pb.ListPinsResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkChannelAccess(req.GetServerId(), req.GetChannelId(), username); err != nil {
+		return nil, err
+	}
+
+	pins := append([]*pb.Pin(nil), s.pins[req.GetChannelId()]...)
+	return &pb.ListPinsResponse{Pins: pins}, nil
+}
+
+// SaveMessage bookmarks a message for the caller. Saving a message twice
+// keeps a single bookmark.
+func (s *server) SaveMessage(ctx context.Context, req *pb.SaveMessageRequest) (*pb.SaveMessageResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, err := s.channelMessage(req.GetServerId(), req.GetChannelId(), req.GetMessageId(), username)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, saved := range s.saved[username] {
+		if saved.GetMessage().GetId() == msg.GetId() {
+			return &pb.SaveMessageResponse{}, nil
+		}
+	}
+	s.saved[username] = append(s.saved[username], &pb.SavedMessage{
+		ServerId:  req.GetServerId(),
+		ChannelId: req.GetChannelId(),
+		Message:   msg,
+		SavedAt:   timestamppb.Now(),
+	})
+
+	return &pb.SaveMessageResponse{}, nil
+}
+
+func (s *server) UnsaveMessage(ctx context.Context, req *pb.UnsaveMessageRequest) (*pb.UnsaveMessageResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := s.saved[username]
+	for i, msg := range saved {
+		if msg.GetMessage().GetId() == req.GetMessageId() {
+			s.saved[username] = append(saved[:i:i], saved[i+1:]...)
+			return &pb.UnsaveMessageResponse{}, nil
+		}
+	}
+
+	return nil, grpc.Errorf(codes.NotFound, "message is not saved")
+}
+
+func (s *server) ListSaved(ctx context.Context, req *pb.ListSavedRequest) (*pb.ListSavedResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := append([]*pb.SavedMessage(nil), s.saved[username]...)
+	return &pb.ListSavedResponse{Messages: saved}, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/codes"
+)
+
+func TestPinsStayInTheirChatServer(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, mallory := login(t, client, "alice"), login(t, client, "mallory")
+	serverID, channelID := testChannel(t, client, alice)
+	otherServerID, _ := testChannel(t, client, mallory)
+
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "private"}); err != nil {
+		t.Fatal(err)
+	}
+	msg := listMessages(t, client, alice, serverID, channelID)[0]
+
+	// mallory owns her chat server, but the channel is not part of it
+	_, err := client.PinMessage(mallory, &pb.PinMessageRequest{ServerId: otherServerID, ChannelId: channelID, MessageId: msg.GetId()})
+	wantCode(t, err, codes.NotFound)
+	_, err = client.SaveMessage(mallory, &pb.SaveMessageRequest{ServerId: otherServerID, ChannelId: channelID, MessageId: msg.GetId()})
+	wantCode(t, err, codes.NotFound)
+	_, err = client.ListPins(mallory, &pb.ListPinsRequest{ServerId: otherServerID, ChannelId: channelID})
+	wantCode(t, err, codes.NotFound)
+	_, err = client.SaveMessage(mallory, &pb.SaveMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId()})
+	wantCode(t, err, codes.PermissionDenied)
+
+	if _, err := client.PinMessage(alice, &pb.PinMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.UnpinMessage(mallory, &pb.UnpinMessageRequest{ServerId: otherServerID, ChannelId: channelID, MessageId: msg.GetId()})
+	wantCode(t, err, codes.NotFound)
+	pins, err := client.ListPins(alice, &pb.ListPinsRequest{ServerId: serverID, ChannelId: channelID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins.GetPins()) != 1 {
+		t.Fatalf("channel has %d pins, want 1", len(pins.GetPins()))
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+var presenceTimeout = flag.Duration("presence-timeout", 30*time.Second, "How long a user without open streams stays online after their last request")
+
+// presence is what the server knows about a single user's activity.
+type presence struct {
+	streams      int
+	status       pb.Presence
+	customStatus string
+	lastSeen     time.Time
+
+	// published is the presence subscribers were last told about.
+	published       pb.Presence
+	publishedStatus string
+}
+
+// visible returns the presence other users should see.
+func (p *presence) visible(now time.Time, timeout time.Duration) pb.Presence {
+	if p.streams == 0 && now.Sub(p.lastSeen) > timeout {
+		return pb.Presence_OFFLINE
+	}
+	if p.status == pb.Presence_INVISIBLE {
+		return pb.Presence_OFFLINE
+	}
+	return p.status
+}
+
+// presenceTracker derives user presence from open streams, explicit status
+// changes and request activity.
+type presenceTracker struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	users   map[string]*presence
+}
+
+func newPresenceTracker(timeout time.Duration) *presenceTracker {
+	return &presenceTracker{
+		timeout: timeout,
+		users:   make(map[string]*presence),
+	}
+}
+
+// update applies fn to the user's presence and reports whether the visible
+// presence changed as a result.
+func (t *presenceTracker) update(username string, fn func(p *presence)) (*pb.Member, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.users[username]
+	if !ok {
+		p = &presence{status: pb.Presence_ONLINE}
+		t.users[username] = p
+	}
+	fn(p)
+	return t.publish(username, p, time.Now())
+}
+
+// publish records the current visible presence of a user and reports whether
+// it differs from what was last published. The caller must hold t.mu.
+func (t *presenceTracker) publish(username string, p *presence, now time.Time) (*pb.Member, bool) {
+	member := &pb.Member{
+		Username:     username,
+		Presence:     p.visible(now, t.timeout),
+		CustomStatus: p.customStatus,
+	}
+	if member.Presence == pb.Presence_OFFLINE {
+		member.CustomStatus = ""
+	}
+	if member.Presence == p.published && member.CustomStatus == p.publishedStatus {
+		return member, false
+	}
+	p.published = member.Presence
+	p.publishedStatus = member.CustomStatus
+	return member, true
+}
+
+// seen marks activity from a user.
+func (t *presenceTracker) seen(username string) (*pb.Member, bool) {
+	return t.update(username, func(p *presence) {
+		p.lastSeen = time.Now()
+	})
+}
+
+func (t *presenceTracker) connect(username string) (*pb.Member, bool) {
+	return t.update(username, func(p *presence) {
+		p.streams++
+		p.lastSeen = time.Now()
+	})
+}
+
+func (t *presenceTracker) disconnect(username string) (*pb.Member, bool) {
+	return t.update(username, func(p *presence) {
+		p.streams--
+		p.lastSeen = time.Now()
+	})
+}
+
+func (t *presenceTracker) get(username string) *pb.Member {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.users[username]
+	if !ok {
+		return &pb.Member{Username: username, Presence: pb.Presence_OFFLINE}
+	}
+	return &pb.Member{
+		Username:     username,
+		Presence:     p.published,
+		CustomStatus: p.publishedStatus,
+	}
+}
+
+// expire returns the users whose visible presence changed since it was last
+// published, such as users whose heartbeat timed out.
+func (t *presenceTracker) expire() []*pb.Member {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var changed []*pb.Member
+	now := time.Now()
+	for username, p := range t.users {
+		if member, ok := t.publish(username, p, now); ok {
+			changed = append(changed, member)
+		}
+	}
+	return changed
+}
+
+func (s *server) SetStatus(ctx context.Context, req *pb.SetStatusRequest) (*pb.SetStatusResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	if req.GetPresence() == pb.Presence_OFFLINE {
+		return nil, grpc.Errorf(codes.InvalidArgument, "presence cannot be set to offline")
+	}
+
+	s.publishPresence(s.presence.update(username, func(p *presence) {
+		p.status = req.GetPresence()
+		p.customStatus = req.GetCustomStatus()
+		p.lastSeen = time.Now()
+	}))
+
+	return &pb.SetStatusResponse{}, nil
+}
+
+func (s *server) ListMembers(ctx context.Context, req *pb.ListMembersRequest) (*pb.ListMembersResponse, error) {
+	if !s.authenticate(ctx) {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.servers[req.GetServerId()]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "chat server not found")
+	}
+
+	var usernames []string
+	for username := range s.members[req.GetServerId()] {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	var members []*pb.Member
+	for _, username := range usernames {
+		member := s.presence.get(username)
+		member.Role = s.members[req.GetServerId()][username]
+		member.IsBot = s.isBot(username)
+		members = append(members, member)
+	}
+
+	return &pb.ListMembersResponse{Members: members}, nil
+}
+
+// publishPresence notifies every chat server the user belongs to when their
+// presence changed.
+func (s *server) publishPresence(member *pb.Member, changed bool) {
+	if !changed {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for serverID, members := range s.members {
+		if _, ok := members[member.GetUsername()]; !ok {
+			continue
+		}
+		s.hub.publish(&pb.Event{
+			ServerId: serverID,
+			Payload: &pb.Event_PresenceUpdated{PresenceUpdated: &pb.PresenceUpdated{
+				Username:     member.GetUsername(),
+				Presence:     member.GetPresence(),
+				CustomStatus: member.GetCustomStatus(),
+			}},
+		})
+	}
+}
+
+// watchPresence periodically marks users offline once their heartbeat times
+// out.
+func (s *server) watchPresence(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, member := range s.presence.expire() {
+			s.publishPresence(member, true)
+		}
+	}
+}
+
+// trackStream counts an open stream towards the caller's presence. The
+// returned func must be called when the stream ends.
+func (s *server) trackStream(ctx context.Context) func() {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return func() {}
+	}
+
+	s.publishPresence(s.presence.connect(username))
+	return func() {
+		s.publishPresence(s.presence.disconnect(username))
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+)
+
+func TestIdleUsersGoOffline(t *testing.T) {
+	s, client := startTestServer(t)
+	s.presence.mu.Lock()
+	s.presence.timeout = 100 * time.Millisecond
+	s.presence.mu.Unlock()
+
+	alice, bob := login(t, client, "alice"), login(t, client, "bob")
+	serverID, _ := testChannel(t, client, alice)
+	if _, err := client.JoinChatServer(bob, &pb.JoinChatServerRequest{ServerId: serverID}); err != nil {
+		t.Fatal(err)
+	}
+	// bob's open stream keeps him online however long he is idle
+	next := subscribe(t, client, bob, serverID)
+
+	time.Sleep(150 * time.Millisecond)
+	for _, member := range s.presence.expire() {
+		s.publishPresence(member, true)
+	}
+	for {
+		update := nextEvent[*pb.Event_PresenceUpdated](t, next).PresenceUpdated
+		if update.GetUsername() == "alice" {
+			if update.GetPresence() != pb.Presence_OFFLINE {
+				t.Fatalf("alice is %v, want offline", update.GetPresence())
+			}
+			break
+		}
+	}
+
+	members, err := client.ListMembers(bob, &pb.ListMembersRequest{ServerId: serverID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	presences := make(map[string]pb.Presence)
+	for _, member := range members.GetMembers() {
+		presences[member.GetUsername()] = member.GetPresence()
+	}
+	if presences["alice"] != pb.Presence_OFFLINE || presences["bob"] != pb.Presence_ONLINE {
+		t.Fatalf("got presences %v, want alice offline and bob online", presences)
+	}
+
+	// Any request brings alice back
+	if _, err := client.ListMembers(alice, &pb.ListMembersRequest{ServerId: serverID}); err != nil {
+		t.Fatal(err)
+	}
+	update := nextEvent[*pb.Event_PresenceUpdated](t, next).PresenceUpdated
+	if update.GetUsername() != "alice" || update.GetPresence() != pb.Presence_ONLINE {
+		t.Fatalf("got %v, want alice online", update)
+	}
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	raftID      = flag.String("raft-id", "", "The id of this node in the Raft cluster, empty disables replication")
+	raftCluster = flag.String("raft-cluster", "", `JSON file describing the Raft cluster as {"secret": "...", "nodes": [{"id": "...", "raft_address": "host:port", "grpc_address": "host:port"}]}`)
+	raftDir     = flag.String("raft-dir", "raft", "Directory where the Raft log and snapshots are stored")
+	raftJoin    = flag.String("raft-join", "", "The gRPC address of a node of a running cluster to join, instead of bootstrapping the nodes of the cluster file")
+	raftLeave   = flag.Bool("raft-leave", false, "Leave the cluster when interrupted or terminated, handing off the channels this node owns")
+)
+
+const (
+	// raftApplyTimeout is how long a command may take to be committed
+	raftApplyTimeout = 10 * time.Second
+	// clusterSecretHeader carries the cluster secret on forwarded commands
+	clusterSecretHeader = "x-cluster-secret"
+)
+
+type raftNode struct {
+	ID          string `json:"id"`
+	RaftAddress string `json:"raft_address"`
+	GRPCAddress string `json:"grpc_address"`
+}
+
+type raftClusterConfig struct {
+	// Secret authenticates the commands followers forward to the leader
+	Secret string     `json:"secret"`
+	Nodes  []raftNode `json:"nodes"`
+}
+
+// replication replicates the users, chat servers, channels, memberships,
+// messages, bots, topics, pins and retention policies across a cluster with
+// Raft. Every node applies the log to its own state and publishes the
+// resulting events to its own subscribers. Followers forward their commands
+// to the leader.
+//
+// Webhooks, incoming webhooks and scheduled messages are deliberately kept
+// on the node they were set up on, as every node delivering them would
+// deliver them once per node. Read positions, saved messages, notifications,
+// attachments and federation links are per node as well.
+type replication struct {
+	pb.UnimplementedClusterServer
+
+	s      *server
+	raft   *raft.Raft
+	id     raft.ServerID
+	secret string
+	nodes  map[raft.ServerID]raftNode
+
+	mu sync.Mutex
+	// conns holds connections to the other nodes by gRPC address
+	conns map[string]*grpc.ClientConn
+}
+
+// startReplication joins the Raft cluster described in clusterFile as the node
+// with the given id, keeping the log in dir. The first start of every node
+// bootstraps the cluster with all of its nodes, unless join is the address of
+// a node of a running cluster, which then adds this one. Every node registers
+// its gRPC address with the cluster once there is a leader. An empty id
+// disables replication.
+func (s *server) startReplication(id, clusterFile, dir, join string) error {
+	if id == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(clusterFile)
+	if err != nil {
+		return err
+	}
+	var cluster raftClusterConfig
+	if err := json.Unmarshal(data, &cluster); err != nil {
+		return fmt.Errorf("invalid cluster file: %w", err)
+	}
+	if cluster.Secret == "" {
+		return fmt.Errorf("the cluster file has no secret")
+	}
+
+	r := &replication{
+		s:      s,
+		id:     raft.ServerID(id),
+		secret: cluster.Secret,
+		nodes:  make(map[raft.ServerID]raftNode),
+		conns:  make(map[string]*grpc.ClientConn),
+	}
+	var configuration raft.Configuration
+	for _, node := range cluster.Nodes {
+		if node.ID == "" || node.RaftAddress == "" || node.GRPCAddress == "" {
+			return fmt.Errorf("every node needs an id, raft_address and grpc_address")
+		}
+		r.nodes[raft.ServerID(node.ID)] = node
+		configuration.Servers = append(configuration.Servers, raft.Server{
+			ID:      raft.ServerID(node.ID),
+			Address: raft.ServerAddress(node.RaftAddress),
+		})
+	}
+	self, ok := r.nodes[r.id]
+	if !ok {
+		return fmt.Errorf("node %s is not in the cluster file", id)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create Raft directory: %w", err)
+	}
+	store, err := raftboltdb.NewBoltStore(filepath.Join(dir, "raft.db"))
+	if err != nil {
+		return fmt.Errorf("failed to open Raft log: %w", err)
+	}
+	snapshots, err := raft.NewFileSnapshotStore(dir, 2, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to open Raft snapshots: %w", err)
+	}
+	advertise, err := net.ResolveTCPAddr("tcp", self.RaftAddress)
+	if err != nil {
+		return err
+	}
+	var transport *raft.NetworkTransport
+	if s.certs == nil {
+		transport, err = raft.NewTCPTransport(self.RaftAddress, advertise, 3, 10*time.Second, os.Stderr)
+	} else {
+		var lis net.Listener
+		if lis, err = net.Listen("tcp", self.RaftAddress); err == nil {
+			stream := &tlsStreamLayer{Listener: s.certs.listen(lis), advertise: advertise, certs: s.certs}
+			transport = raft.NewNetworkTransport(stream, 3, 10*time.Second, os.Stderr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to listen for Raft: %w", err)
+	}
+
+	config := raft.DefaultConfig()
+	config.LocalID = r.id
+	config.LogLevel = "INFO"
+
+	existing, err := raft.HasExistingState(store, store, snapshots)
+	if err != nil {
+		return err
+	}
+	r.raft, err = raft.NewRaft(config, raftFSM{s: s}, store, store, snapshots, transport)
+	if err != nil {
+		return err
+	}
+	switch {
+	case existing:
+	case join != "":
+		if err := r.join(join, self.RaftAddress); err != nil {
+			return fmt.Errorf("failed to join the cluster: %w", err)
+		}
+	default:
+		// Every node bootstraps with the same configuration, so it does not
+		// matter which one starts first
+		if err := r.raft.BootstrapCluster(configuration).Error(); err != nil && !errors.Is(err, raft.ErrCantBootstrap) {
+			return fmt.Errorf("failed to bootstrap the cluster: %w", err)
+		}
+	}
+
+	s.replication = r
+	go r.register(self.GRPCAddress)
+	return nil
+}
+
+// join asks the node at address to add this node to its cluster.
+func (r *replication) join(address, raftAddress string) error {
+	conn, err := r.conn(address)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(r.outgoing(context.Background()), raftApplyTimeout)
+	defer cancel()
+	_, err = pb.NewClusterClient(conn).Join(ctx, &pb.JoinClusterRequest{
+		Id:          string(r.id),
+		RaftAddress: raftAddress,
+	})
+	return err
+}
+
+// register adds the gRPC address of this node to the nodes of the cluster,
+// retrying until the cluster has a leader.
+func (r *replication) register(address string) {
+	s := r.s
+	for {
+		s.mu.Lock()
+		registered := s.nodes[string(r.id)] == address
+		var err error
+		if !registered {
+			_, err = s.commit(&pb.Command{Payload: &pb.Command_AddNode{AddNode: &pb.AddNodeCommand{
+				Id:      string(r.id),
+				Address: address,
+			}}})
+		}
+		s.mu.Unlock()
+		if registered || err == nil {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// leave hands off the channels of this node, if channels are sharded, and
+// removes it from the cluster.
+func (r *replication) leave() error {
+	s := r.s
+	s.mu.Lock()
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_RemoveNode{RemoveNode: &pb.RemoveNodeCommand{
+		Id: string(r.id),
+	}}})
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.sharding.handOff(); err != nil {
+		return err
+	}
+
+	if r.raft.State() == raft.Leader {
+		// The leader steps down once it removed itself
+		return raftError(r.raft.RemoveServer(r.id, 0, raftApplyTimeout).Error())
+	}
+	client, err := r.leader()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(r.outgoing(context.Background()), raftApplyTimeout)
+	defer cancel()
+	_, err = client.Leave(ctx, &pb.LeaveClusterRequest{Id: string(r.id)})
+	return err
+}
+
+// leaveOnExit leaves the cluster when the process is interrupted or
+// terminated, then exits.
+func (r *replication) leaveOnExit() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	log.Println("Leaving the cluster")
+	if err := r.leave(); err != nil {
+		log.Fatalf("failed to leave the cluster: %v", err)
+	}
+	os.Exit(0)
+}
+
+// commit appends a command to the Raft log, through the leader if this node
+// is a follower, and waits until this node has applied it, so the caller
+// reads its own writes.
+func (r *replication) commit(cmd *pb.Command) (*pb.ApplyResponse, error) {
+	if r.raft.State() == raft.Leader {
+		resp, err := r.apply(cmd)
+		if !errors.Is(err, raft.ErrNotLeader) {
+			return resp, raftError(err)
+		}
+	}
+
+	leader, err := r.leader()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(r.outgoing(context.Background()), raftApplyTimeout)
+	defer cancel()
+	resp, err := leader.Apply(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for r.raft.AppliedIndex() < resp.GetIndex() {
+		select {
+		case <-ctx.Done():
+			return nil, grpc.Errorf(codes.Unavailable, "timed out waiting for the command to be replicated")
+		case <-ticker.C:
+		}
+	}
+	return resp, nil
+}
+
+// apply appends a command to the log of the leader and waits until the
+// leader has applied it.
+func (r *replication) apply(cmd *pb.Command) (*pb.ApplyResponse, error) {
+	data, err := proto.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	future := r.raft.Apply(data, raftApplyTimeout)
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	result := future.Response().(raftResult)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &pb.ApplyResponse{
+		Index:   future.Index(),
+		Message: result.resp.GetMessage(),
+	}, nil
+}
+
+// Apply applies a command forwarded by a follower. Only the leader accepts
+// commands.
+func (r *replication) Apply(ctx context.Context, cmd *pb.Command) (*pb.ApplyResponse, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := r.apply(cmd)
+	return resp, raftError(err)
+}
+
+// Join adds a node to the cluster as a voter. Followers pass the request on
+// to the leader.
+func (r *replication) Join(ctx context.Context, req *pb.JoinClusterRequest) (*pb.JoinClusterResponse, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if req.GetId() == "" || req.GetRaftAddress() == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "a node needs an id and a Raft address")
+	}
+
+	if r.raft.State() != raft.Leader {
+		leader, err := r.leader()
+		if err != nil {
+			return nil, err
+		}
+		return leader.Join(r.outgoing(ctx), req)
+	}
+	err := r.raft.AddVoter(raft.ServerID(req.GetId()), raft.ServerAddress(req.GetRaftAddress()), 0, raftApplyTimeout).Error()
+	if err != nil {
+		return nil, raftError(err)
+	}
+	return &pb.JoinClusterResponse{}, nil
+}
+
+// Leave removes a node from the cluster. Only the leader accepts the request.
+func (r *replication) Leave(ctx context.Context, req *pb.LeaveClusterRequest) (*pb.LeaveClusterResponse, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	err := r.raft.RemoveServer(raft.ServerID(req.GetId()), 0, raftApplyTimeout).Error()
+	if err != nil {
+		return nil, raftError(err)
+	}
+	return &pb.LeaveClusterResponse{}, nil
+}
+
+// authorize checks that a request comes from a node of the cluster.
+func (r *replication) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	secrets := md.Get(clusterSecretHeader)
+	if len(secrets) == 0 || subtle.ConstantTimeCompare([]byte(secrets[0]), []byte(r.secret)) != 1 {
+		return grpc.Errorf(codes.Unauthenticated, "invalid cluster secret")
+	}
+	return nil
+}
+
+// outgoing adds the cluster secret to a request to another node.
+func (r *replication) outgoing(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, clusterSecretHeader, r.secret)
+}
+
+// leader returns a client for the Cluster service of the leader, unless this
+// node is the leader.
+func (r *replication) leader() (pb.ClusterClient, error) {
+	_, leaderID := r.raft.LeaderWithID()
+	if leaderID == "" || leaderID == r.id {
+		return nil, grpc.Errorf(codes.Unavailable, "the cluster has no leader")
+	}
+	return r.client(string(leaderID))
+}
+
+// client returns a client for the Cluster service of the node with the given
+// id.
+func (r *replication) client(id string) (pb.ClusterClient, error) {
+	conn, err := r.nodeConn(id)
+	if err != nil {
+		return nil, err
+	}
+	return pb.NewClusterClient(conn), nil
+}
+
+// nodeConn returns a connection to the node with the given id.
+func (r *replication) nodeConn(id string) (*grpc.ClientConn, error) {
+	address := r.nodes[raft.ServerID(id)].GRPCAddress
+	if address == "" {
+		// Nodes that joined later are only known from their registration
+		r.s.mu.Lock()
+		address = r.s.nodes[id]
+		r.s.mu.Unlock()
+	}
+	if address == "" {
+		return nil, grpc.Errorf(codes.Unavailable, "unknown node %s", id)
+	}
+	conn, err := r.conn(address)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "failed to reach node %s: %v", id, err)
+	}
+	return conn, nil
+}
+
+// conn returns a connection to the node with the given gRPC address.
+func (r *replication) conn(address string) (*grpc.ClientConn, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if conn, ok := r.conns[address]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.Dial(address, r.s.certs.dialOption())
+	if err != nil {
+		return nil, err
+	}
+	r.conns[address] = conn
+	return conn, nil
+}
+
+// raftError turns the errors of the Raft library, like losing the
+// leadership, into Unavailable so clients try again. Errors from applying a
+// command already are gRPC errors.
+func raftError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return grpc.Errorf(codes.Unavailable, "replication failed: %v", err)
+}
+
+// raftFSM applies the Raft log to the state of the server.
+type raftFSM struct {
+	s *server
+}
+
+// raftResult is what applying a log entry returns to the node that appended
+// it.
+type raftResult struct {
+	resp *pb.ApplyResponse
+	err  error
+}
+
+func (f raftFSM) Apply(entry *raft.Log) interface{} {
+	cmd := &pb.Command{}
+	if err := proto.Unmarshal(entry.Data, cmd); err != nil {
+		return raftResult{err: grpc.Errorf(codes.Internal, "malformed command: %v", err)}
+	}
+
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	resp, err := f.s.applyCommand(cmd)
+	return raftResult{resp: resp, err: err}
+}
+
+func (f raftFSM) Snapshot() (raft.FSMSnapshot, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	data, err := proto.Marshal(f.s.replicatedState())
+	if err != nil {
+		return nil, err
+	}
+	return raftSnapshot(data), nil
+}
+
+func (f raftFSM) Restore(snapshot io.ReadCloser) error {
+	defer snapshot.Close()
+
+	data, err := io.ReadAll(snapshot)
+	if err != nil {
+		return err
+	}
+	state := &pb.ReplicatedState{}
+	if err := proto.Unmarshal(data, state); err != nil {
+		return err
+	}
+
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+
+	f.s.restoreState(state)
+	return nil
+}
+
+// raftSnapshot is the marshalled pb.ReplicatedState of a snapshot.
+type raftSnapshot []byte
+
+func (snap raftSnapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(snap); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (snap raftSnapshot) Release() {}
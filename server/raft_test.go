@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// startTestCluster starts a Raft cluster of n nodes on localhost, sharding
+// the channels if sharded is set, waits until it has a leader and every node
+// registered its address, and returns the nodes with a client for each.
+func startTestCluster(t *testing.T, n int, sharded bool) ([]*server, []pb.ChatServerClient) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cluster := raftClusterConfig{Secret: "cluster-secret"}
+	listeners := make([]net.Listener, n)
+	for i := range listeners {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[i] = lis
+		cluster.Nodes = append(cluster.Nodes, raftNode{
+			ID:          fmt.Sprintf("node%d", i+1),
+			RaftAddress: freeAddress(t),
+			GRPCAddress: lis.Addr().String(),
+		})
+	}
+	data, err := json.Marshal(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusterFile := filepath.Join(dir, "cluster.json")
+	if err := os.WriteFile(clusterFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var servers []*server
+	var clients []pb.ChatServerClient
+	for i, node := range cluster.Nodes {
+		blobs, err := newLocalBlobStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewServer(blobs, &localBroker{})
+		if err := s.startReplication(node.ID, clusterFile, filepath.Join(dir, node.ID), ""); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.replication.raft.Shutdown().Error() })
+		if err := s.startSharding(sharded); err != nil {
+			t.Fatal(err)
+		}
+
+		grpcServer := grpc.NewServer()
+		s.registerServices(grpcServer)
+		go grpcServer.Serve(listeners[i])
+		t.Cleanup(grpcServer.Stop)
+
+		conn, err := grpc.NewClient(node.GRPCAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		servers = append(servers, s)
+		clients = append(clients, pb.NewChatServerClient(conn))
+	}
+
+	eventually(t, 30*time.Second, func() bool {
+		for _, s := range servers {
+			if _, leaderID := s.replication.raft.LeaderWithID(); leaderID == "" {
+				return false
+			}
+			s.mu.Lock()
+			registered := len(s.nodes)
+			s.mu.Unlock()
+			if registered < n {
+				return false
+			}
+		}
+		return true
+	})
+	return servers, clients
+}
+
+// freeAddress returns a localhost address with a port nothing listens on.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+// eventually fails the test unless condition returns true within timeout.
+func eventually(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestClusterReplicatesWritesFromFollowers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a Raft cluster")
+	}
+	servers, clients := startTestCluster(t, 3, false)
+
+	// Write through a follower, which forwards every command to the leader
+	follower := 0
+	for i, s := range servers {
+		if s.replication.raft.State() == raft.Follower {
+			follower = i
+			break
+		}
+	}
+	client := clients[follower]
+
+	alice := login(t, client, "alice")
+	serverID, channelID := testChannel(t, client, alice)
+	err := send(alice, client,
+		&pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "hello"},
+		&pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "/topic Releases"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.UpdateChannel(alice, &pb.UpdateChannelRequest{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Retention: &pb.RetentionPolicy{MaxCount: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := listMessages(t, client, alice, serverID, channelID)
+	if len(messages) == 0 {
+		t.Fatal("the follower does not read its own writes")
+	}
+	_, err = client.PinMessage(alice, &pb.PinMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: messages[0].GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot, err := client.CreateBot(alice, &pb.CreateBotRequest{Name: "helper"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, s := range servers {
+		client := clients[i]
+		eventually(t, 10*time.Second, func() bool {
+			messages := listMessages(t, client, alice, serverID, channelID)
+			if len(messages) == 0 || messages[0].GetText() != "hello" {
+				return false
+			}
+			channel, err := client.GetChannel(alice, &pb.GetChannelRequest{ServerId: serverID, ChannelId: channelID})
+			if err != nil || channel.GetChannel().GetTopic() != "Releases" || channel.GetChannel().GetRetention().GetMaxCount() != 10 {
+				return false
+			}
+			pins, err := client.ListPins(alice, &pb.ListPinsRequest{ServerId: serverID, ChannelId: channelID})
+			if err != nil || len(pins.GetPins()) != 1 {
+				return false
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(apiKeyHeader, bot.GetApiKey()))
+			username, ok := s.userFromContext(ctx)
+			return ok && username == "helper"
+		})
+	}
+}
+
+func TestSnapshotRestoresState(t *testing.T) {
+	s, client := startTestServer(t)
+	alice := login(t, client, "alice")
+	serverID, channelID := testChannel(t, client, alice)
+	err := send(alice, client,
+		&pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "hello"},
+		&pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "/topic Releases"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := listMessages(t, client, alice, serverID, channelID)
+	_, err = client.PinMessage(alice, &pb.PinMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: messages[0].GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.UpdateChannel(alice, &pb.UpdateChannelRequest{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Retention: &pb.RetentionPolicy{MaxCount: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot, err := client.CreateBot(alice, &pb.CreateBotRequest{Name: "helper"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	state := s.replicatedState()
+	s.mu.Unlock()
+
+	restored, client := startTestServer(t)
+	restored.mu.Lock()
+	restored.restoreState(state)
+	restored.mu.Unlock()
+
+	if got := listMessages(t, client, alice, serverID, channelID); len(got) != len(messages) {
+		t.Fatalf("got %d messages, want %d", len(got), len(messages))
+	}
+	channel, err := client.GetChannel(alice, &pb.GetChannelRequest{ServerId: serverID, ChannelId: channelID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel.GetChannel().GetTopic() != "Releases" || channel.GetChannel().GetRetention().GetMaxCount() != 10 {
+		t.Fatalf("got channel %v, want the topic and retention policy restored", channel.GetChannel())
+	}
+	pins, err := client.ListPins(alice, &pb.ListPinsRequest{ServerId: serverID, ChannelId: channelID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins.GetPins()) != 1 {
+		t.Fatalf("got %d pins, want 1", len(pins.GetPins()))
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(apiKeyHeader, bot.GetApiKey()))
+	if username, ok := restored.userFromContext(ctx); !ok || username != "helper" {
+		t.Fatal("the bot API key does not authenticate after a restore")
+	}
+}
+
+func TestShardedChannelServedByEveryNode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a Raft cluster")
+	}
+	servers, clients := startTestCluster(t, 3, true)
+
+	alice := login(t, clients[0], "alice")
+	serverID, channelID := testChannel(t, clients[0], alice)
+
+	// Use a node that does not own the channel, so every request has to
+	// reach the owner
+	node := -1
+	eventually(t, 5*time.Second, func() bool {
+		for i, s := range servers {
+			s.mu.Lock()
+			owner := s.owners[channelID]
+			s.mu.Unlock()
+			if owner != "" && owner != string(s.replication.id) {
+				node = i
+				return true
+			}
+		}
+		return false
+	})
+	client := clients[node]
+	bob := login(t, client, "bob")
+	if _, err := client.JoinChatServer(bob, &pb.JoinChatServerRequest{ServerId: serverID, Username: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := send(bob, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "hello @alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := listMessages(t, client, alice, serverID, channelID)
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	msg := messages[0]
+
+	channel, err := client.GetChannel(alice, &pb.GetChannelRequest{ServerId: serverID, ChannelId: channelID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel.GetChannel().GetUnreadCount() != 1 || channel.GetChannel().GetMentionCount() != 1 {
+		t.Fatalf("got %d unread and %d mentions, want 1 and 1", channel.GetChannel().GetUnreadCount(), channel.GetChannel().GetMentionCount())
+	}
+	if _, err := client.MarkRead(alice, &pb.MarkReadRequest{ServerId: serverID, ChannelId: channelID, UpToMessageId: msg.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := client.GetUnreadSummary(alice, &pb.GetUnreadSummaryRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.GetUnreadCount() != 0 {
+		t.Fatalf("got %d unread after marking them read, want 0", summary.GetUnreadCount())
+	}
+
+	edited, err := client.EditMessage(bob, &pb.EditMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId(), Text: "hello everyone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.GetMessage().GetText() != "hello everyone" {
+		t.Fatalf("got edited text %q", edited.GetMessage().GetText())
+	}
+
+	search, err := client.SearchMessages(alice, &pb.SearchMessagesRequest{Query: "everyone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if search.GetTotalCount() != 1 || len(search.GetResults()) != 1 || search.GetResults()[0].GetSnippet() == "" {
+		t.Fatalf("got search results %v, want the edited message", search.GetResults())
+	}
+
+	if _, err := client.PinMessage(alice, &pb.PinMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SaveMessage(alice, &pb.SaveMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.DeleteMessage(bob, &pb.DeleteMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: msg.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	if messages := listMessages(t, client, alice, serverID, channelID); len(messages) != 0 {
+		t.Fatalf("got %d messages after the deletion, want 0", len(messages))
+	}
+	eventually(t, 5*time.Second, func() bool {
+		pins, err := client.ListPins(alice, &pb.ListPinsRequest{ServerId: serverID, ChannelId: channelID})
+		if err != nil || len(pins.GetPins()) != 0 {
+			return false
+		}
+		saved, err := client.ListSaved(alice, &pb.ListSavedRequest{})
+		return err == nil && len(saved.GetMessages()) == 0
+	})
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/hashicorp/raft"
+	"google.golang.org/protobuf/proto"
+)
+
+var retentionInterval = flag.Duration("retention-interval", time.Minute, "How often channel retention policies are enforced")
+
+// enforceRetention periodically prunes the messages that fell out of their
+// channel's retention policy.
+func (s *server) enforceRetention(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+		// commit may release s.mu, so the channels are collected first
+		type channelKey struct{ serverID, channelID string }
+		var channels []channelKey
+		for serverID, ids := range s.channels {
+			for channelID := range ids {
+				if s.enforcesRetention(channelID) {
+					channels = append(channels, channelKey{serverID, channelID})
+				}
+			}
+		}
+		for _, channel := range channels {
+			s.applyRetention(channel.serverID, channel.channelID, now)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// enforcesRetention reports whether this node prunes the messages of a
+// channel: the owner of the channel when channels are sharded, the Raft
+// leader when they are replicated, and otherwise this node. The caller must
+// hold s.mu.
+func (s *server) enforcesRetention(channelID string) bool {
+	switch {
+	case s.sharding != nil:
+		return s.owners[channelID] == string(s.replication.id)
+	case s.replication != nil:
+		return s.replication.raft.State() == raft.Leader
+	}
+	return true
+}
+
+// applyRetention deletes the oldest messages of a channel that are beyond its
+// maximum count or age, unless the channel is on legal hold. The messages are
+// picked here and removed through commitMessageChange, so every node removes
+// the same ones. The caller must hold s.mu, which may be released.
+func (s *server) applyRetention(serverID, channelID string, now time.Time) {
+	policy, ok := s.retention[channelID]
+	if !ok || policy.GetLegalHold() {
+		return
+	}
+
+	// Messages are stored oldest first, so everything expired is a prefix
+	messages := s.messages[channelID]
+	expired := 0
+	if max := int(policy.GetMaxCount()); max > 0 && len(messages) > max {
+		expired = len(messages) - max
+	}
+	if maxAge := policy.GetMaxAgeSeconds(); maxAge > 0 {
+		cutoff := now.Add(-time.Duration(maxAge) * time.Second)
+		for expired < len(messages) && messages[expired].GetTimestamp().AsTime().Before(cutoff) {
+			expired++
+		}
+	}
+	if expired == 0 {
+		return
+	}
+
+	ids := make([]string, expired)
+	for i, msg := range messages[:expired] {
+		ids[i] = msg.GetId()
+	}
+	_, err := s.commitMessageChange(channelID, &pb.Command{Payload: &pb.Command_PruneMessages{PruneMessages: &pb.PruneMessagesCommand{
+		ServerId:   serverID,
+		ChannelId:  channelID,
+		MessageIds: ids,
+	}}})
+	if err != nil {
+		log.Printf("Failed to prune %d messages from channel %s: %v", expired, channelID, err)
+	}
+}
+
+// applyPruneMessages removes the given messages of a channel, skipping those
+// that are gone already, and tells subscribers. The caller must hold s.mu.
+func (s *server) applyPruneMessages(serverID, channelID string, messageIDs []string) {
+	prune := make(map[string]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		prune[id] = true
+	}
+	var kept, removed []*pb.Message
+	for _, msg := range s.messages[channelID] {
+		if prune[msg.GetId()] {
+			removed = append(removed, msg)
+		} else {
+			kept = append(kept, msg)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+
+	s.messages[channelID] = kept
+	s.forgetMessages(channelID, removed)
+	for _, msg := range removed {
+		s.hub.publish(&pb.Event{
+			ServerId: serverID,
+			Payload: &pb.Event_MessageDeleted{MessageDeleted: &pb.MessageDeleted{
+				ChannelId: channelID,
+				MessageId: msg.GetId(),
+			}},
+		})
+	}
+	log.Printf("Retention removed %d messages from channel %s", len(removed), channelID)
+}
+
+// removeMessage removes a message from its channel and reports whether it
+// was there. The caller must hold s.mu.
+func (s *server) removeMessage(channelID, messageID string) bool {
+	messages := s.messages[channelID]
+	for i, msg := range messages {
+		if msg.GetId() != messageID {
+			continue
+		}
+		s.messages[channelID] = append(messages[:i:i], messages[i+1:]...)
+		s.forgetMessages(channelID, []*pb.Message{msg})
+		return true
+	}
+	return false
+}
+
+// replaceMessage swaps a stored message for a changed copy, in the channel
+// as well as in the search index, pins and saved messages. The caller must
+// hold s.mu.
+func (s *server) replaceMessage(serverID, channelID string, msg *pb.Message) {
+	for i, stored := range s.messages[channelID] {
+		if stored.GetId() == msg.GetId() {
+			s.messages[channelID][i] = msg
+		}
+	}
+	s.index.remove(msg.GetId())
+	s.index.add(serverID, channelID, msg)
+
+	for i, pin := range s.pins[channelID] {
+		if pin.GetMessage().GetId() == msg.GetId() {
+			pin = proto.Clone(pin).(*pb.Pin)
+			pin.Message = msg
+			s.pins[channelID][i] = pin
+		}
+	}
+	for _, saved := range s.saved {
+		for i, bookmark := range saved {
+			if bookmark.GetMessage().GetId() == msg.GetId() {
+				bookmark = proto.Clone(bookmark).(*pb.SavedMessage)
+				bookmark.Message = msg
+				saved[i] = bookmark
+			}
+		}
+	}
+}
+
+// forgetMessages drops every reference to messages that were removed from a
+// channel. The caller must hold s.mu.
+func (s *server) forgetMessages(channelID string, messages []*pb.Message) {
+	removed := make(map[string]bool, len(messages))
+	for _, msg := range messages {
+		removed[msg.GetId()] = true
+		s.index.remove(msg.GetId())
+	}
+
+	var pins []*pb.Pin
+	for _, pin := range s.pins[channelID] {
+		if !removed[pin.GetMessage().GetId()] {
+			pins = append(pins, pin)
+		}
+	}
+	s.pins[channelID] = pins
+
+	for username, saved := range s.saved {
+		var kept []*pb.SavedMessage
+		for _, msg := range saved {
+			if !removed[msg.GetMessage().GetId()] {
+				kept = append(kept, msg)
+			}
+		}
+		s.saved[username] = kept
+	}
+}
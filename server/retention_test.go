@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+)
+
+// messageTexts returns the texts of messages.
+func messageTexts(messages []*pb.Message) []string {
+	var texts []string
+	for _, msg := range messages {
+		texts = append(texts, msg.GetText())
+	}
+	return texts
+}
+
+func TestRetentionPrunesUnlessOnLegalHold(t *testing.T) {
+	s, client := startTestServer(t)
+	alice := login(t, client, "alice")
+	serverID, channelID := testChannel(t, client, alice)
+	for i := 1; i <= 5; i++ {
+		if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: fmt.Sprintf("message %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldest := listMessages(t, client, alice, serverID, channelID)[0]
+	if _, err := client.PinMessage(alice, &pb.PinMessageRequest{ServerId: serverID, ChannelId: channelID, MessageId: oldest.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	next := subscribe(t, client, alice, serverID)
+
+	// A legal hold keeps every message, whatever the limits
+	_, err := client.UpdateChannel(alice, &pb.UpdateChannelRequest{ServerId: serverID, ChannelId: channelID, Retention: &pb.RetentionPolicy{MaxCount: 2, MaxAgeSeconds: 60, LegalHold: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.applyRetention(serverID, channelID, time.Now().Add(time.Hour))
+	s.mu.Unlock()
+	if messages := listMessages(t, client, alice, serverID, channelID); len(messages) != 5 {
+		t.Fatalf("got %q on legal hold, want all 5 messages", messageTexts(messages))
+	}
+
+	// Lifting the hold prunes down to max_count right away
+	_, err = client.UpdateChannel(alice, &pb.UpdateChannelRequest{ServerId: serverID, ChannelId: channelID, Retention: &pb.RetentionPolicy{MaxCount: 2, MaxAgeSeconds: 60}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts := messageTexts(listMessages(t, client, alice, serverID, channelID)); len(texts) != 2 || texts[0] != "message 4" || texts[1] != "message 5" {
+		t.Fatalf("got %q, want the 2 newest messages", texts)
+	}
+	if deleted := nextEvent[*pb.Event_MessageDeleted](t, next).MessageDeleted; deleted.GetMessageId() != oldest.GetId() {
+		t.Fatalf("got MessageDeleted for %s, want the oldest message first", deleted.GetMessageId())
+	}
+	pins, err := client.ListPins(alice, &pb.ListPinsRequest{ServerId: serverID, ChannelId: channelID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins.GetPins()) != 0 {
+		t.Fatalf("the pruned message is still pinned")
+	}
+
+	// The sweep removes the messages older than max_age
+	s.mu.Lock()
+	s.applyRetention(serverID, channelID, time.Now().Add(time.Hour))
+	s.mu.Unlock()
+	if messages := listMessages(t, client, alice, serverID, channelID); len(messages) != 0 {
+		t.Fatalf("got %q, want every message past its age pruned", messageTexts(messages))
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Built-in roles. Any other role name is a custom role with the permissions
+// of a plain member, which is still useful for @role mentions.
+const (
+	roleOwner     = "owner"
+	roleAdmin     = "admin"
+	roleModerator = "moderator"
+	roleMember    = "member"
+)
+
+var roleRanks = map[string]int{
+	roleMember:    0,
+	roleModerator: 1,
+	roleAdmin:     2,
+	roleOwner:     3,
+}
+
+func roleRank(role string) int {
+	return roleRanks[role]
+}
+
+// hasRole reports whether the user is a member of the chat server with at
+// least the given role. The caller must hold s.mu.
+func (s *server) hasRole(serverID, username, role string) bool {
+	current, ok := s.members[serverID][username]
+	if !ok {
+		return false
+	}
+	return roleRank(current) >= roleRank(role)
+}
+
+// checkAdmin makes sure the chat server exists and the user is an admin of
+// it, who may manage what.
+func (s *server) checkAdmin(serverID, username, what string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.servers[serverID]; !exists {
+		return grpc.Errorf(codes.NotFound, "chat server not found")
+	}
+	if !s.hasRole(serverID, username, roleAdmin) {
+		return grpc.Errorf(codes.PermissionDenied, "only admins can manage %s", what)
+	}
+	return nil
+}
+
+// SetRole changes the role of a member. Admins may grant any role below
+// their own, only the owner may grant or revoke admin, and the owner role
+// cannot be changed.
+func (s *server) SetRole(ctx context.Context, req *pb.SetRoleRequest) (*pb.SetRoleResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	role := req.GetRole()
+	if role == "" || strings.ContainsAny(role, " \t@") {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid role name")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	serverID := req.GetServerId()
+	if _, exists := s.servers[serverID]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "chat server not found")
+	}
+
+	current, ok := s.members[serverID][req.GetUsername()]
+	if !ok {
+		return nil, grpc.Errorf(codes.NotFound, "user is not a member of the chat server")
+	}
+
+	callerRank := roleRank(s.members[serverID][username])
+	if !s.hasRole(serverID, username, roleAdmin) ||
+		role == roleOwner || current == roleOwner ||
+		roleRank(role) >= callerRank || roleRank(current) >= callerRank {
+		return nil, grpc.Errorf(codes.PermissionDenied, "not allowed to change this role")
+	}
+
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_SetRole{SetRole: &pb.SetRoleCommand{
+		ServerId: serverID,
+		Username: req.GetUsername(),
+		Role:     role,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SetRoleResponse{}, nil
+}
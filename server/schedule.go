@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+var scheduleFile = flag.String("schedule-file", "", "File scheduled messages are persisted in so they survive restarts, disabled when empty")
+
+// maxScheduledPerUser limits how many messages a user can have waiting.
+const maxScheduledPerUser = 100
+
+func (s *server) ScheduleMessage(ctx context.Context, req *pb.ScheduleMessageRequest) (*pb.ScheduleMessageResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if req.GetText() == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "scheduled messages need text")
+	}
+	if req.GetSendAt() == nil || !req.GetSendAt().AsTime().After(time.Now()) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "send_at must be in the future")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.servers[req.GetServerId()]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "chat server not found")
+	}
+	if _, exists := s.channels[req.GetServerId()][req.GetChannelId()]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "channel not found")
+	}
+	if !s.isMember(req.GetServerId(), username) {
+		return nil, grpc.Errorf(codes.PermissionDenied, "not a member of the chat server")
+	}
+
+	pending := 0
+	for _, scheduled := range s.scheduled {
+		if scheduled.GetUsername() == username {
+			pending++
+		}
+	}
+	if pending >= maxScheduledPerUser {
+		return nil, grpc.Errorf(codes.ResourceExhausted, "at most %d messages can be scheduled at once", maxScheduledPerUser)
+	}
+
+	scheduled := &pb.ScheduledMessage{
+		Id:        uuid.New().String(),
+		ServerId:  req.GetServerId(),
+		ChannelId: req.GetChannelId(),
+		Username:  username,
+		Text:      req.GetText(),
+		SendAt:    req.GetSendAt(),
+	}
+	s.scheduled[scheduled.Id] = scheduled
+	s.saveScheduled()
+
+	return &pb.ScheduleMessageResponse{Scheduled: scheduled}, nil
+}
+
+// ListScheduled lists the caller's scheduled messages, soonest first.
+func (s *server) ListScheduled(ctx context.Context, req *pb.ListScheduledRequest) (*pb.ListScheduledResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []*pb.ScheduledMessage
+	for _, scheduled := range s.scheduled {
+		if scheduled.GetUsername() != username {
+			continue
+		}
+		if req.GetServerId() != "" && scheduled.GetServerId() != req.GetServerId() {
+			continue
+		}
+		list = append(list, scheduled)
+	}
+	sortScheduled(list)
+
+	return &pb.ListScheduledResponse{Scheduled: list}, nil
+}
+
+func (s *server) CancelScheduled(ctx context.Context, req *pb.CancelScheduledRequest) (*pb.CancelScheduledResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scheduled, exists := s.scheduled[req.GetId()]
+	if !exists || scheduled.GetUsername() != username {
+		return nil, grpc.Errorf(codes.NotFound, "scheduled message not found")
+	}
+	delete(s.scheduled, req.GetId())
+	s.saveScheduled()
+
+	return &pb.CancelScheduledResponse{}, nil
+}
+
+// deliverScheduled periodically posts the scheduled messages that are due.
+func (s *server) deliverScheduled(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+		var due []*pb.ScheduledMessage
+		for _, scheduled := range s.scheduled {
+			if !scheduled.GetSendAt().AsTime().After(now) {
+				due = append(due, scheduled)
+			}
+		}
+		sortScheduled(due)
+
+		for _, scheduled := range due {
+			delete(s.scheduled, scheduled.GetId())
+			s.postScheduled(scheduled)
+		}
+		if len(due) > 0 {
+			s.saveScheduled()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// postScheduled posts a due message as if its author had sent it. Messages
+// whose channel is gone or whose author left the chat server are dropped.
+// The caller must hold s.mu.
+func (s *server) postScheduled(scheduled *pb.ScheduledMessage) {
+	if _, exists := s.channels[scheduled.GetServerId()][scheduled.GetChannelId()]; !exists {
+		log.Printf("Dropping scheduled message %s: channel not found", scheduled.GetId())
+		return
+	}
+	if !s.isMember(scheduled.GetServerId(), scheduled.GetUsername()) {
+		log.Printf("Dropping scheduled message %s: %s left the chat server", scheduled.GetId(), scheduled.GetUsername())
+		return
+	}
+
+	_, err := s.postMessage(newMessage{
+		serverID:  scheduled.GetServerId(),
+		channelID: scheduled.GetChannelId(),
+		username:  scheduled.GetUsername(),
+		text:      scheduled.GetText(),
+	})
+	if err != nil {
+		log.Printf("Failed to post scheduled message %s: %v", scheduled.GetId(), err)
+	}
+}
+
+func sortScheduled(list []*pb.ScheduledMessage) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].GetSendAt().AsTime().Before(list[j].GetSendAt().AsTime())
+	})
+}
+
+// loadScheduled reads the scheduled messages persisted in path and keeps
+// persisting them there from now on. An empty path disables persistence.
+func (s *server) loadScheduled(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scheduleFile = path
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var saved pb.ListScheduledResponse
+	if err := proto.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	for _, scheduled := range saved.GetScheduled() {
+		s.scheduled[scheduled.GetId()] = scheduled
+	}
+	log.Printf("Loaded %d scheduled messages", len(saved.GetScheduled()))
+	return nil
+}
+
+// saveScheduled writes every scheduled message to the schedule file, if
+// persistence is enabled. The caller must hold s.mu.
+func (s *server) saveScheduled() {
+	if s.scheduleFile == "" {
+		return
+	}
+
+	saved := &pb.ListScheduledResponse{}
+	for _, scheduled := range s.scheduled {
+		saved.Scheduled = append(saved.Scheduled, scheduled)
+	}
+	sortScheduled(saved.Scheduled)
+
+	data, err := proto.Marshal(saved)
+	if err == nil {
+		err = writeFileAtomic(s.scheduleFile, data)
+	}
+	if err != nil {
+		log.Printf("Failed to save scheduled messages: %v", err)
+	}
+}
+
+// writeFileAtomic replaces a file with data. A temporary file is written
+// first so a crash never leaves a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
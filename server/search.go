@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+
+	// snippetContext is roughly how many bytes of text are kept around the
+	// first match in a snippet.
+	snippetContext = 60
+)
+
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into lower-cased runs of letters and digits, keeping
+// their byte offsets.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			tokens = append(tokens, token{term: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{term: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+func terms(text string) []string {
+	var terms []string
+	for _, t := range tokenize(text) {
+		terms = append(terms, t.term)
+	}
+	return terms
+}
+
+type indexedMessage struct {
+	serverID  string
+	channelID string
+	msg       *pb.Message
+	terms     []string
+}
+
+// searchIndex is an inverted index over stored messages. It is guarded by
+// s.mu like the messages themselves.
+type searchIndex struct {
+	docs     map[string]*indexedMessage
+	postings map[string]map[string]struct{}
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		docs:     make(map[string]*indexedMessage),
+		postings: make(map[string]map[string]struct{}),
+	}
+}
+
+func (idx *searchIndex) add(serverID, channelID string, msg *pb.Message) {
+	doc := &indexedMessage{
+		serverID:  serverID,
+		channelID: channelID,
+		msg:       msg,
+		terms:     terms(msg.GetText()),
+	}
+	idx.docs[msg.GetId()] = doc
+
+	for _, term := range doc.terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]struct{})
+		}
+		idx.postings[term][msg.GetId()] = struct{}{}
+	}
+}
+
+func (idx *searchIndex) remove(messageID string) {
+	doc, ok := idx.docs[messageID]
+	if !ok {
+		return
+	}
+	delete(idx.docs, messageID)
+
+	for _, term := range doc.terms {
+		delete(idx.postings[term], messageID)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+}
+
+// candidates returns the messages containing every term of the query. A
+// query without terms matches every message.
+func (idx *searchIndex) candidates(q *searchQuery) []*indexedMessage {
+	required := q.allTerms()
+	if len(required) == 0 {
+		docs := make([]*indexedMessage, 0, len(idx.docs))
+		for _, doc := range idx.docs {
+			docs = append(docs, doc)
+		}
+		return docs
+	}
+
+	// Walk the smallest posting list and check the others against it
+	sort.Slice(required, func(i, j int) bool {
+		return len(idx.postings[required[i]]) < len(idx.postings[required[j]])
+	})
+
+	var docs []*indexedMessage
+	for id := range idx.postings[required[0]] {
+		found := true
+		for _, term := range required[1:] {
+			if _, ok := idx.postings[term][id]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			docs = append(docs, idx.docs[id])
+		}
+	}
+	return docs
+}
+
+type searchQuery struct {
+	terms   []string
+	phrases [][]string
+	from    string
+	in      string
+	before  time.Time
+	after   time.Time
+	has     []string
+}
+
+// parseSearchQuery parses terms, "quoted phrases" and key:value filters.
+func parseSearchQuery(query string) (*searchQuery, error) {
+	q := &searchQuery{}
+	for i := 0; i < len(query); {
+		if query[i] == ' ' {
+			i++
+			continue
+		}
+
+		if query[i] == '"' {
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				end = len(query) - i - 1
+			}
+			q.addText(query[i+1 : i+1+end])
+			i += end + 2
+			continue
+		}
+
+		end := strings.IndexByte(query[i:], ' ')
+		if end < 0 {
+			end = len(query) - i
+		}
+		word := query[i : i+end]
+		i += end
+
+		key, value, ok := strings.Cut(word, ":")
+		if !ok || value == "" {
+			q.addText(word)
+			continue
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "from":
+			q.from = strings.TrimPrefix(value, "@")
+		case "in":
+			q.in = strings.TrimPrefix(value, "#")
+		case "before":
+			q.before, err = parseSearchDate(value, false)
+		case "after":
+			q.after, err = parseSearchDate(value, true)
+		case "has":
+			value = strings.ToLower(value)
+			if value != "mention" && value != "link" && value != "attachment" {
+				return nil, fmt.Errorf("unknown filter has:%s", value)
+			}
+			q.has = append(q.has, value)
+		default:
+			q.addText(word)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// parseSearchDate parses a YYYY-MM-DD date or an RFC 3339 timestamp. A bare
+// date used by after: refers to the end of that day.
+func parseSearchDate(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// addText adds free text as a term, or as a phrase when it has several words.
+func (q *searchQuery) addText(text string) {
+	words := terms(text)
+	switch len(words) {
+	case 0:
+	case 1:
+		q.terms = append(q.terms, words[0])
+	default:
+		q.phrases = append(q.phrases, words)
+	}
+}
+
+func (q *searchQuery) allTerms() []string {
+	all := append([]string(nil), q.terms...)
+	for _, phrase := range q.phrases {
+		all = append(all, phrase...)
+	}
+	return all
+}
+
+func (q *searchQuery) empty() bool {
+	return len(q.terms) == 0 && len(q.phrases) == 0 && q.from == "" && q.in == "" &&
+		q.before.IsZero() && q.after.IsZero() && len(q.has) == 0
+}
+
+// matches applies the phrase and filter parts of the query that the index
+// cannot answer on its own. in: is checked by the server, which knows the
+// channel names.
+func (q *searchQuery) matches(doc *indexedMessage) bool {
+	for _, phrase := range q.phrases {
+		if !containsPhrase(doc.terms, phrase) {
+			return false
+		}
+	}
+
+	msg := doc.msg
+	if q.from != "" && !strings.EqualFold(msg.GetUsername(), q.from) {
+		return false
+	}
+	if !q.before.IsZero() && !msg.GetTimestamp().AsTime().Before(q.before) {
+		return false
+	}
+	if !q.after.IsZero() && !msg.GetTimestamp().AsTime().After(q.after) {
+		return false
+	}
+	for _, has := range q.has {
+		switch has {
+		case "mention":
+			if len(msg.GetMentions()) == 0 {
+				return false
+			}
+		case "link":
+			if !strings.Contains(msg.GetText(), "http://") && !strings.Contains(msg.GetText(), "https://") {
+				return false
+			}
+		case "attachment":
+			if len(msg.GetAttachments()) == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsPhrase(terms, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(terms); i++ {
+		found := true
+		for j, term := range phrase {
+			if terms[i+j] != term {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// snippet returns an excerpt of text around the first match with every
+// matching word wrapped in **.
+func snippet(text string, highlight map[string]bool) string {
+	tokens := tokenize(text)
+
+	start, end := 0, len(text)
+	for _, t := range tokens {
+		if highlight[t.term] {
+			start = t.start - snippetContext/2
+			break
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start+snippetContext*2 < end {
+		end = start + snippetContext*2
+	}
+	// Do not cut words in half
+	for _, t := range tokens {
+		if t.start < start && t.end > start {
+			start = t.start
+		}
+		if t.start < end && t.end > end {
+			end = t.end
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	pos := start
+	for _, t := range tokens {
+		if t.start < start || t.end > end || !highlight[t.term] {
+			continue
+		}
+		b.WriteString(text[pos:t.start])
+		b.WriteString("**")
+		b.WriteString(text[t.start:t.end])
+		b.WriteString("**")
+		pos = t.end
+	}
+	b.WriteString(text[pos:end])
+	if end < len(text) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
+
+func (s *server) SearchMessages(ctx context.Context, req *pb.SearchMessagesRequest) (*pb.SearchMessagesResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	q, err := parseSearchQuery(req.GetQuery())
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if q.empty() {
+		return nil, grpc.Errorf(codes.InvalidArgument, "empty search query")
+	}
+
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultSearchPageSize
+	}
+	if pageSize > maxSearchPageSize {
+		pageSize = maxSearchPageSize
+	}
+	offset := 0
+	if req.GetPageToken() != "" {
+		offset, err = strconv.Atoi(req.GetPageToken())
+		if err != nil || offset < 0 {
+			return nil, grpc.Errorf(codes.InvalidArgument, "invalid page token")
+		}
+	}
+
+	// With sharded channels every other node searches the channels it owns
+	remote, remoteTotal := s.sharding.search(username, req, offset+pageSize)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := s.searchResults(q, req.GetServerId(), username)
+	total := len(results) + remoteTotal
+	if len(remote) > 0 {
+		results = append(results, remote...)
+		sortSearchResults(results)
+	}
+
+	highlight := make(map[string]bool)
+	for _, term := range q.allTerms() {
+		highlight[term] = true
+	}
+
+	resp := &pb.SearchMessagesResponse{TotalCount: int32(total)}
+	for i := offset; i < len(results) && i < offset+pageSize; i++ {
+		results[i].Snippet = snippet(results[i].GetMessage().GetText(), highlight)
+		resp.Results = append(resp.Results, results[i])
+	}
+	if offset+pageSize < total {
+		resp.NextPageToken = strconv.Itoa(offset + pageSize)
+	}
+
+	return resp, nil
+}
+
+// searchResults returns the messages this node has that match a query,
+// newest first and without snippets. Only the chat servers the user joined
+// are searched, or only serverID if set. The caller must hold s.mu.
+func (s *server) searchResults(q *searchQuery, serverID, username string) []*pb.SearchResult {
+	var results []*pb.SearchResult
+	for _, doc := range s.index.candidates(q) {
+		if serverID != "" && doc.serverID != serverID {
+			continue
+		}
+		// Only search chat servers the caller has joined
+		if !s.isMember(doc.serverID, username) {
+			continue
+		}
+		if q.in != "" && doc.channelID != q.in && s.channels[doc.serverID][doc.channelID] != q.in {
+			continue
+		}
+		if q.matches(doc) {
+			results = append(results, &pb.SearchResult{
+				ServerId:  doc.serverID,
+				ChannelId: doc.channelID,
+				Message:   doc.msg,
+			})
+		}
+	}
+	sortSearchResults(results)
+	return results
+}
+
+// sortSearchResults sorts search results newest first.
+func sortSearchResults(results []*pb.SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i].GetMessage(), results[j].GetMessage()
+		if !a.GetTimestamp().AsTime().Equal(b.GetTimestamp().AsTime()) {
+			return a.GetTimestamp().AsTime().After(b.GetTimestamp().AsTime())
+		}
+		return a.GetSeq() > b.GetSeq()
+	})
+}
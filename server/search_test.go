@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/codes"
+)
+
+// searchTexts returns the texts of the messages found by a query, sorted.
+func searchTexts(t *testing.T, client pb.ChatServerClient, ctx context.Context, query string) []string {
+	t.Helper()
+
+	res, err := client.SearchMessages(ctx, &pb.SearchMessagesRequest{Query: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, result := range res.GetResults() {
+		texts = append(texts, result.GetMessage().GetText())
+	}
+	sort.Strings(texts)
+	return texts
+}
+
+func TestSearchFiltersAndPages(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, bob, mallory := login(t, client, "alice"), login(t, client, "bob"), login(t, client, "mallory")
+	serverID, general := testChannel(t, client, alice)
+	random, err := client.CreateChannel(alice, &pb.CreateChannelRequest{ServerId: serverID, ChannelName: "random"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.JoinChatServer(bob, &pb.JoinChatServerRequest{ServerId: serverID}); err != nil {
+		t.Fatal(err)
+	}
+	otherServerID, otherChannelID := testChannel(t, client, mallory)
+
+	err = send(alice, client,
+		&pb.SendMessageRequest{ServerId: serverID, ChannelId: general, Text: "deploy the release today"},
+		&pb.SendMessageRequest{ServerId: serverID, ChannelId: general, Text: "lunch menu at https://example.com"},
+		&pb.SendMessageRequest{ServerId: serverID, ChannelId: general, Text: "deploy needs a rollback plan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := send(bob, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: random.GetChannelId(), Text: "deploy failed @alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := send(mallory, client, &pb.SendMessageRequest{ServerId: otherServerID, ChannelId: otherChannelID, Text: "deploy elsewhere"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tomorrow := time.Now().Add(24 * time.Hour).Format("2006-01-02")
+	for query, want := range map[string][]string{
+		"deploy":                    {"deploy failed @alice", "deploy needs a rollback plan", "deploy the release today"},
+		"deploy from:bob":           {"deploy failed @alice"},
+		"deploy in:general":         {"deploy needs a rollback plan", "deploy the release today"},
+		`"rollback plan"`:           {"deploy needs a rollback plan"},
+		"has:link":                  {"lunch menu at https://example.com"},
+		"has:mention":               {"deploy failed @alice"},
+		"deploy before:" + tomorrow: {"deploy failed @alice", "deploy needs a rollback plan", "deploy the release today"},
+		"deploy after:" + tomorrow:  nil,
+	} {
+		if got := searchTexts(t, client, alice, query); strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("%s found %q, want %q", query, got, want)
+		}
+	}
+
+	// Pages follow each other without repeating or skipping results
+	var pages [][]string
+	token := ""
+	for {
+		res, err := client.SearchMessages(alice, &pb.SearchMessagesRequest{Query: "deploy", PageSize: 2, PageToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.GetTotalCount() != 3 {
+			t.Fatalf("got a total of %d, want 3", res.GetTotalCount())
+		}
+		var page []string
+		for _, result := range res.GetResults() {
+			page = append(page, result.GetMessage().GetText())
+		}
+		pages = append(pages, page)
+		if token = res.GetNextPageToken(); token == "" {
+			break
+		}
+	}
+	if len(pages) != 2 || len(pages[0]) != 2 || len(pages[1]) != 1 {
+		t.Fatalf("got pages %q, want 2 and 1 results", pages)
+	}
+	if pages[0][0] != "deploy failed @alice" || pages[1][0] != "deploy the release today" {
+		t.Fatalf("got pages %q, want the newest results first", pages)
+	}
+
+	_, err = client.SearchMessages(alice, &pb.SearchMessagesRequest{Query: "deploy", PageToken: "garbage"})
+	wantCode(t, err, codes.InvalidArgument)
+}
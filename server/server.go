@@ -3,21 +3,29 @@ package main
 import (
 	"context"
 	"flag"
-	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	pb "github.com/Melo04/grpc-chat/pb"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-var port = flag.Int("port", 50051, "The server port")
+var (
+	port       = flag.Int("port", 50051, "The server port")
+	listenHost = flag.String("listen", "localhost", "The host or IP address the gRPC, HTTP and IRC ports listen on, such as 0.0.0.0 for every interface. Cluster nodes and federation peers on other hosts need it")
+)
 
 type server struct {
 	pb.UnimplementedChatServerServer
@@ -26,6 +34,56 @@ type server struct {
 	servers  map[string]*ChatServer
 	messages map[string][]*pb.Message
 	channels map[string]map[string]string
+	// members holds the role of each member per chat server
+	members map[string]map[string]string
+	// sequences holds the seq of the latest message in each channel
+	sequences map[string]int64
+	// readState holds the last read seq of each user per channel
+	readState map[string]map[string]int64
+	hub       *hub
+	presence  *presenceTracker
+	typing    *typingTracker
+	notifier  *notifier
+	index     *searchIndex
+
+	attachments map[string]*storedAttachment
+	blobs       BlobStore
+
+	// pins holds the pinned messages of each channel in pin order
+	pins map[string][]*pb.Pin
+	// saved holds the bookmarked messages of each user
+	saved map[string][]*pb.SavedMessage
+	// retention holds the retention policy of each channel that has one
+	retention map[string]*pb.RetentionPolicy
+	// topics holds the topic of each channel that has one
+	topics map[string]string
+	// bots holds the bot accounts by name and botKeys their names by API
+	// key hash
+	bots    map[string]*storedBot
+	botKeys map[string]string
+	// webhooks delivers events to outgoing webhooks
+	webhooks *webhookDispatcher
+	// incomingHooks holds the incoming webhooks by id and incomingTokens
+	// their ids by token hash
+	incomingHooks  map[string]*storedIncomingWebhook
+	incomingTokens map[string]string
+	// scheduled holds the messages waiting to be posted by id
+	scheduled map[string]*pb.ScheduledMessage
+	// scheduleFile is where scheduled messages are persisted, if anywhere
+	scheduleFile string
+	// federation links channels with other instances, if enabled
+	federation *federation
+	// replication replicates the state across a Raft cluster, if enabled
+	replication *replication
+	// nodes maps the ids of the nodes of a Raft cluster to their gRPC
+	// address
+	nodes map[string]string
+	// sharding spreads the messages of channels across the nodes, if
+	// enabled, and owners holds the node owning each channel
+	sharding *sharding
+	owners   map[string]string
+	// certs holds the TLS certificates, or nil to serve plaintext
+	certs *certificates
 }
 
 type ChatServer struct {
@@ -33,24 +91,73 @@ type ChatServer struct {
 	Name string
 }
 
-func NewServer() *server {
+func NewServer(blobs BlobStore, broker Broker) *server {
+	h := newHub(broker)
+	webhooks := newWebhookDispatcher()
+	h.observe(webhooks.enqueue)
 	return &server{
-		servers:  make(map[string]*ChatServer),
-		messages: make(map[string][]*pb.Message),
-		users:    make(map[string]string),
-		channels: make(map[string]map[string]string),
+		servers:   make(map[string]*ChatServer),
+		messages:  make(map[string][]*pb.Message),
+		users:     make(map[string]string),
+		channels:  make(map[string]map[string]string),
+		members:   make(map[string]map[string]string),
+		sequences: make(map[string]int64),
+		readState: make(map[string]map[string]int64),
+		hub:       h,
+		presence:  newPresenceTracker(*presenceTimeout),
+		typing:    newTypingTracker(h),
+		notifier:  newNotifier(),
+		index:     newSearchIndex(),
+
+		attachments: make(map[string]*storedAttachment),
+		blobs:       blobs,
+
+		pins:  make(map[string][]*pb.Pin),
+		saved: make(map[string][]*pb.SavedMessage),
+
+		retention: make(map[string]*pb.RetentionPolicy),
+		topics:    make(map[string]string),
+		bots:      make(map[string]*storedBot),
+		botKeys:   make(map[string]string),
+		webhooks:  webhooks,
+
+		incomingHooks:  make(map[string]*storedIncomingWebhook),
+		incomingTokens: make(map[string]string),
+
+		scheduled: make(map[string]*pb.ScheduledMessage),
+
+		nodes:  make(map[string]string),
+		owners: make(map[string]string),
 	}
 }
 
 func (s *server) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	if req.GetUsername() == commandBot {
+		return nil, grpc.Errorf(codes.PermissionDenied, "%s is reserved for command replies", commandBot)
+	}
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
+	if s.isBot(req.GetUsername()) {
+		s.mu.Unlock()
+		return nil, grpc.Errorf(codes.PermissionDenied, "bots authenticate with an API key")
+	}
+	if s.federation.isRemoteUser(req.GetUsername()) {
+		s.mu.Unlock()
+		return nil, grpc.Errorf(codes.PermissionDenied, "%s belongs to a federated instance", req.GetUsername())
+	}
 	token := uuid.New().String()
-	s.users[req.GetUsername()] = token
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_Login{Login: &pb.LoginCommand{
+		Username: req.GetUsername(),
+		Token:    token,
+	}}})
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishPresence(s.presence.seen(req.GetUsername()))
 
 	return &pb.LoginResponse{
-		Token: token,
+		Token:   token,
 		Message: "Login successful",
 	}, nil
 }
@@ -60,19 +167,21 @@ func (s *server) CreateChatServer(ctx context.Context, req *pb.CreateChatServerR
 	if !s.authenticate(ctx) {
 		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
 	}
+	username, _ := s.userFromContext(ctx)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	serverID := uuid.New().String()
-
-	chatServer := &ChatServer{
-		ID:   serverID,
-		Name: req.GetServerName(),
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_CreateChatServer{CreateChatServer: &pb.CreateChatServerCommand{
+		ServerId: serverID,
+		Name:     req.GetServerName(),
+		Owner:    username,
+	}}})
+	if err != nil {
+		return nil, err
 	}
 
-	s.servers[serverID] = chatServer
-
 	return &pb.CreateChatServerResponse{ServerId: serverID}, nil
 }
 
@@ -87,16 +196,156 @@ func (s *server) CreateChannel(ctx context.Context, req *pb.CreateChannelRequest
 
 	//generate channel id dynamically
 	channelID := uuid.New().String()
-	if s.channels[serverID] == nil {
-		s.channels[serverID] = make(map[string]string)
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_CreateChannel{CreateChannel: &pb.CreateChannelCommand{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Name:      req.GetChannelName(),
+		Owner:     s.sharding.ownerFor(channelID),
+	}}})
+	if err != nil {
+		return nil, err
 	}
 
-	s.channels[serverID][channelID] = req.GetChannelName()
-
 	return &pb.CreateChannelResponse{ChannelId: channelID}, nil
 }
 
+func (s *server) ListChannels(ctx context.Context, req *pb.ListChannelsRequest) (*pb.ListChannelsResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	remote := s.sharding.unreadCounts(username, req.GetServerId())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.servers[req.GetServerId()]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "chat server not found")
+	}
+
+	return &pb.ListChannelsResponse{Channels: s.channelList(req.GetServerId(), username, remote)}, nil
+}
+
+func (s *server) GetChannel(ctx context.Context, req *pb.GetChannelRequest) (*pb.GetChannelResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	remote := s.sharding.unreadCounts(username, req.GetServerId())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.servers[req.GetServerId()]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "chat server not found")
+	}
+	if _, exists := s.channels[req.GetServerId()][req.GetChannelId()]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "channel not found")
+	}
+
+	return &pb.GetChannelResponse{Channel: s.channelInfo(req.GetServerId(), req.GetChannelId(), username, remote)}, nil
+}
+
+// UpdateChannel renames a channel or replaces its retention policy. Only
+// admins and the owner may update channels.
+func (s *server) UpdateChannel(ctx context.Context, req *pb.UpdateChannelRequest) (*pb.UpdateChannelResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	retention := req.GetRetention()
+	if retention.GetMaxAgeSeconds() < 0 || retention.GetMaxCount() < 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "retention limits cannot be negative")
+	}
+	remote := s.sharding.unreadCounts(username, req.GetServerId())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	serverID, channelID := req.GetServerId(), req.GetChannelId()
+	if _, exists := s.servers[serverID]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "chat server not found")
+	}
+	if _, exists := s.channels[serverID][channelID]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "channel not found")
+	}
+	if !s.hasRole(serverID, username, roleAdmin) {
+		return nil, grpc.Errorf(codes.PermissionDenied, "only admins can update channels")
+	}
+
+	if req.GetName() != "" && req.GetName() != s.channels[serverID][channelID] {
+		_, err := s.commit(&pb.Command{Payload: &pb.Command_RenameChannel{RenameChannel: &pb.RenameChannelCommand{
+			ServerId:  serverID,
+			ChannelId: channelID,
+			Name:      req.GetName(),
+		}}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if retention != nil {
+		_, err := s.commit(&pb.Command{Payload: &pb.Command_SetRetention{SetRetention: &pb.SetRetentionCommand{
+			ServerId:  serverID,
+			ChannelId: channelID,
+			Retention: retention,
+		}}})
+		if err != nil {
+			return nil, err
+		}
+		// Apply a stricter policy right away rather than on the next sweep
+		if s.enforcesRetention(channelID) {
+			s.applyRetention(serverID, channelID, time.Now())
+		}
+	}
+
+	return &pb.UpdateChannelResponse{Channel: s.channelInfo(serverID, channelID, username, remote)}, nil
+}
+
+// DeleteChannel deletes a channel with its messages, pins and settings. Only
+// admins and the owner may delete channels.
+func (s *server) DeleteChannel(ctx context.Context, req *pb.DeleteChannelRequest) (*pb.DeleteChannelResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	serverID, channelID := req.GetServerId(), req.GetChannelId()
+	if _, exists := s.servers[serverID]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "chat server not found")
+	}
+	if _, exists := s.channels[serverID][channelID]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "channel not found")
+	}
+	if !s.hasRole(serverID, username, roleAdmin) {
+		return nil, grpc.Errorf(codes.PermissionDenied, "only admins can delete channels")
+	}
+
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_DeleteChannel{DeleteChannel: &pb.DeleteChannelCommand{
+		ServerId:  serverID,
+		ChannelId: channelID,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DeleteChannelResponse{}, nil
+}
+
+// JoinChatServer adds the caller to a chat server. Users only join
+// themselves; the username of the request may be empty or name the caller.
 func (s *server) JoinChatServer(ctx context.Context, req *pb.JoinChatServerRequest) (*pb.JoinChatServerResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if req.GetUsername() != "" && req.GetUsername() != username {
+		return nil, grpc.Errorf(codes.PermissionDenied, "cannot add %s to a chat server", req.GetUsername())
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -104,11 +353,29 @@ func (s *server) JoinChatServer(ctx context.Context, req *pb.JoinChatServerReque
 		return nil, grpc.Errorf(codes.NotFound, "chat server not found")
 	}
 
-	welcomeMessage := req.GetUsername() + " just slid into the server " + s.servers[req.GetServerId()].Name
+	welcomeMessage := username + " just slid into the server " + s.servers[req.GetServerId()].Name
+
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_Join{Join: &pb.JoinCommand{
+		ServerId: req.GetServerId(),
+		Username: username,
+	}}})
+	if err != nil {
+		return nil, err
+	}
 	return &pb.JoinChatServerResponse{WelcomeMessage: welcomeMessage}, nil
 }
 
+// LeaveChatServer removes the caller from a chat server. Removing other
+// members is left to /kick, which checks the role of the caller.
 func (s *server) LeaveChatServer(ctx context.Context, req *pb.LeaveChatServerRequest) (*pb.LeaveChatServerResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if req.GetUsername() != "" && req.GetUsername() != username {
+		return nil, grpc.Errorf(codes.PermissionDenied, "cannot remove %s from a chat server, use /kick", req.GetUsername())
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -116,25 +383,44 @@ func (s *server) LeaveChatServer(ctx context.Context, req *pb.LeaveChatServerReq
 		return nil, grpc.Errorf(codes.NotFound, "chat server not found")
 	}
 
-	goodbyeMessage := req.GetUsername() + " just left the server"
+	_, err := s.commit(&pb.Command{Payload: &pb.Command_Leave{Leave: &pb.LeaveCommand{
+		ServerId: req.GetServerId(),
+		Username: username,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+
+	goodbyeMessage := username + " just left the server"
 	return &pb.LeaveChatServerResponse{GoodbyeMessage: goodbyeMessage}, nil
 }
 
 func (s *server) ListMessages(req *pb.ListMessagesRequest, stream pb.ChatServer_ListMessagesServer) error {
+	if s.sharding != nil {
+		if routed, err := s.sharding.routeListMessages(req, stream); routed {
+			return err
+		}
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	serverID := req.GetServerId()
 	if _, ok := s.servers[serverID]; !ok {
-		return fmt.Errorf("chat server not found")
+		return grpc.Errorf(codes.NotFound, "chat server not found")
 	}
 
 	messages, ok := s.messages[req.GetChannelId()]
 	if !ok {
-		return fmt.Errorf("channel not found")
+		return grpc.Errorf(codes.NotFound, "channel not found")
 	}
 
+	now := time.Now()
 	for _, message := range messages {
+		// Self-destructing messages may outlive their expiry by a moment
+		if message.GetExpiresAt() != nil && !message.GetExpiresAt().AsTime().After(now) {
+			continue
+		}
 		if err := stream.Send(message); err != nil {
 			return err
 		}
@@ -143,6 +429,11 @@ func (s *server) ListMessages(req *pb.ListMessagesRequest, stream pb.ChatServer_
 }
 
 func (s *server) SendMessages(stream pb.ChatServer_SendMessagesServer) error {
+	// Messages are posted, and slash commands run, as the authenticated user
+	username, ok := s.userFromContext(stream.Context())
+	if !ok {
+		return grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
 	var messageCount int32
 
 	for {
@@ -156,86 +447,482 @@ func (s *server) SendMessages(stream pb.ChatServer_SendMessagesServer) error {
 		if err != nil {
 			return err
 		}
+		if err := checkSender(username, req.GetUsername()); err != nil {
+			return err
+		}
 
 		s.mu.Lock()
-		s.messages[req.GetChannelId()] = append(s.messages[req.GetChannelId()], &pb.Message{
-			Username:  req.GetUsername(),
-			Text:      req.GetText(),
-			Timestamp: timestamppb.Now(),
+		if err := s.checkChannelAccess(req.GetServerId(), req.GetChannelId(), username); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		_, err = s.postMessage(newMessage{
+			serverID:      req.GetServerId(),
+			channelID:     req.GetChannelId(),
+			username:      username,
+			text:          req.GetText(),
+			attachmentIDs: req.GetAttachmentIds(),
+			ttl:           time.Duration(req.GetTtlSeconds()) * time.Second,
+			visibleTo:     req.GetVisibleTo(),
 		})
 		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
 
-		log.Printf("Message received from %s: %s", req.GetUsername(), req.GetText())
+		log.Printf("Message received from %s: %s", username, req.GetText())
 		messageCount++
 	}
 }
 
+// Chat streams the messages and typing indicators of a channel to an
+// authenticated member, and posts the messages they send. Frames may switch
+// to another channel, which the caller must be able to read as well.
 func (s *server) Chat(stream pb.ChatServer_ChatServer) error {
+	username, ok := s.userFromContext(stream.Context())
+	if !ok {
+		return grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	defer s.trackStream(stream.Context())()
+
+	// Receive on a separate goroutine so that events from other users can be
+	// sent while waiting for the next frame.
+	frames := make(chan *pb.ChatMessage)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			in, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case frames <- in:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	var serverID, channelID string
+	var events chan *pb.Event
+	defer func() {
+		if events != nil {
+			s.hub.unsubscribe(serverID, events)
+		}
+	}()
+
 	for {
-		in, err := stream.Recv()
-		if err == io.EOF {
+		select {
+		case <-stream.Context().Done():
 			return nil
-		}
-		if err != nil {
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
 			return err
+		case in := <-frames:
+			if events == nil || in.GetServerId() != serverID || in.GetChannelId() != channelID {
+				s.mu.Lock()
+				err := s.checkChannelAccess(in.GetServerId(), in.GetChannelId(), username)
+				s.mu.Unlock()
+				if err != nil {
+					return err
+				}
+			}
+			if events == nil || in.GetServerId() != serverID {
+				if events != nil {
+					s.hub.unsubscribe(serverID, events)
+				}
+				serverID = in.GetServerId()
+				events = s.hub.subscribe(serverID)
+			}
+			channelID = in.GetChannelId()
+
+			if in.GetTyping() {
+				s.typing.start(serverID, channelID, username)
+				continue
+			}
+			if in.GetText() == "" && len(in.GetAttachmentIds()) == 0 {
+				continue
+			}
+
+			log.Printf("\nMessage received from %s: %s", username, in.GetText())
+			if err := checkSender(username, in.GetUsername()); err != nil {
+				return err
+			}
+
+			s.mu.Lock()
+			_, err := s.postMessage(newMessage{
+				serverID:      serverID,
+				channelID:     channelID,
+				username:      username,
+				text:          in.GetText(),
+				attachmentIDs: in.GetAttachmentIds(),
+				ttl:           time.Duration(in.GetTtlSeconds()) * time.Second,
+				visibleTo:     in.GetVisibleTo(),
+			})
+			s.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		case event := <-events:
+			// Messages, including the sender's own, reach the stream through
+			// the hub.
+			if !visibleTo(event, username) {
+				continue
+			}
+			if left := event.GetMemberLeft(); left != nil && left.GetUsername() == username {
+				return grpc.Errorf(codes.PermissionDenied, "no longer a member of the chat server")
+			}
+			if deleted := event.GetChannelDeleted(); deleted != nil && deleted.GetChannelId() == channelID {
+				return grpc.Errorf(codes.NotFound, "channel deleted")
+			}
+			frame := chatFrame(event, channelID)
+			if frame == nil {
+				continue
+			}
+			if err := stream.Send(frame); err != nil {
+				return err
+			}
 		}
+	}
+}
 
-		log.Printf("\nMessage received from %s: %s", in.GetUsername(), in.GetText())
+// chatFrame converts a server event into a Chat stream frame, or returns nil
+// if the event does not belong on a stream listening to the given channel.
+func chatFrame(event *pb.Event, channelID string) *pb.ChatMessage {
+	switch p := event.Payload.(type) {
+	case *pb.Event_MessageCreated:
+		if p.MessageCreated.GetChannelId() != channelID {
+			return nil
+		}
+		msg := p.MessageCreated.GetMessage()
+		frame := &pb.ChatMessage{
+			ServerId:  event.GetServerId(),
+			ChannelId: channelID,
+			Username:  msg.GetUsername(),
+			Text:      msg.GetText(),
+			Timestamp: msg.GetTimestamp(),
+			VisibleTo: msg.GetVisibleTo(),
+			IsBot:     msg.GetIsBot(),
+		}
+		if msg.GetExpiresAt() != nil {
+			frame.TtlSeconds = int64(msg.GetExpiresAt().AsTime().Sub(msg.GetTimestamp().AsTime()).Seconds())
+		}
+		for _, attachment := range msg.GetAttachments() {
+			frame.AttachmentIds = append(frame.AttachmentIds, attachment.GetId())
+		}
+		return frame
+	case *pb.Event_Typing:
+		if p.Typing.GetChannelId() != channelID {
+			return nil
+		}
+		return &pb.ChatMessage{
+			ServerId:  event.GetServerId(),
+			ChannelId: channelID,
+			Username:  p.Typing.GetUsername(),
+			Timestamp: event.GetTimestamp(),
+			Typing:    p.Typing.GetTyping(),
+		}
+	}
+	return nil
+}
 
-		s.mu.Lock()
-		// ChatMessage doesnt have a channel id, so we use the username as the channel id
-		s.messages[in.GetChannelId()] = append(s.messages[in.GetChannelId()], &pb.Message{
-			Username:  in.GetUsername(),
-			Text:      in.GetText(),
-			Timestamp: timestamppb.Now(),
-		})
-		s.mu.Unlock()
+// Subscribe streams the events of a chat server to an authenticated member,
+// until they leave or are kicked.
+func (s *server) Subscribe(req *pb.SubscribeRequest, stream pb.ChatServer_SubscribeServer) error {
+	username, ok := s.userFromContext(stream.Context())
+	if !ok {
+		return grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
 
-		// Echo the message back to the client
-		if err := stream.Send(&pb.ChatMessage{
-			ServerId:  in.GetServerId(),
-			ChannelId: in.GetChannelId(),
-			Username:  in.GetUsername(),
-			Text:      in.GetText(),
-			Timestamp: timestamppb.Now(),
-		}); err != nil {
-			return err
+	serverID := req.GetServerId()
+	s.mu.Lock()
+	_, exists := s.servers[serverID]
+	member := s.isMember(serverID, username)
+	s.mu.Unlock()
+	if !exists {
+		return grpc.Errorf(codes.NotFound, "chat server not found")
+	}
+	if !member {
+		return grpc.Errorf(codes.PermissionDenied, "not a member of the chat server")
+	}
+
+	defer s.trackStream(stream.Context())()
+
+	events := s.hub.subscribe(serverID)
+	defer s.hub.unsubscribe(serverID, events)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-events:
+			if !visibleTo(event, username) {
+				continue
+			}
+			if left := event.GetMemberLeft(); left != nil && left.GetUsername() == username {
+				if s.botDeleted(username) {
+					return grpc.Errorf(codes.Unauthenticated, "API key revoked")
+				}
+				return grpc.Errorf(codes.PermissionDenied, "no longer a member of the chat server")
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
 		}
 	}
 }
 
+// checkChannelAccess makes sure the channel exists and the user is a member
+// of its chat server. The caller must hold s.mu.
+func (s *server) checkChannelAccess(serverID, channelID, username string) error {
+	if _, exists := s.servers[serverID]; !exists {
+		return grpc.Errorf(codes.NotFound, "chat server not found")
+	}
+	if _, exists := s.channels[serverID][channelID]; !exists {
+		return grpc.Errorf(codes.NotFound, "channel not found")
+	}
+	if !s.isMember(serverID, username) {
+		return grpc.Errorf(codes.PermissionDenied, "not a member of the chat server")
+	}
+	return nil
+}
+
+// newMessage is a message as sent by a client.
+type newMessage struct {
+	serverID  string
+	channelID string
+	// username is the authenticated sender, never a name taken from the
+	// request, since commands and attachments are checked against it
+	username      string
+	text          string
+	attachmentIDs []string
+	ttl           time.Duration
+	visibleTo     string
+	// webhook is set for messages from incoming webhooks, which are bot
+	// messages and never run slash commands
+	webhook bool
+}
+
+// postMessage validates a message sent by a client and stores it, or only
+// delivers it if it is ephemeral. Every way of posting a message goes
+// through here. The caller must hold s.mu.
+func (s *server) postMessage(m newMessage) (*pb.Message, error) {
+	if m.ttl < 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "ttl cannot be negative")
+	}
+	if _, exists := s.channels[m.serverID][m.channelID]; !exists {
+		return nil, grpc.Errorf(codes.NotFound, "channel not found")
+	}
+	if m.visibleTo != "" && !s.isMember(m.serverID, m.visibleTo) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "ephemeral messages must be visible to a member of the chat server")
+	}
+
+	if isCommand(m.text) && !m.webhook {
+		s.runCommand(m)
+		return nil, nil
+	}
+	if strings.HasPrefix(m.text, "//") {
+		m.text = m.text[1:]
+	}
+
+	attachments, err := s.attachmentsFor(m.serverID, m.username, m.attachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	msg := &pb.Message{
+		Username:    m.username,
+		Text:        m.text,
+		Timestamp:   timestamppb.New(now),
+		Attachments: attachments,
+		VisibleTo:   m.visibleTo,
+		IsBot:       m.webhook,
+	}
+
+	if m.visibleTo != "" {
+		s.publishEphemeral(m.serverID, m.channelID, msg)
+		return msg, nil
+	}
+
+	if m.ttl > 0 {
+		msg.ExpiresAt = timestamppb.New(now.Add(m.ttl))
+	}
+	return s.storeMessage(m.serverID, m.channelID, msg)
+}
+
+// storeMessage assigns the message an id unless it is federated and already
+// has one, resolves its mentions and commits it to the channel history, see
+// applyStoreMessage. It returns the stored message. The caller must hold
+// s.mu, which commit may release.
+func (s *server) storeMessage(serverID, channelID string, msg *pb.Message) (*pb.Message, error) {
+	if msg.GetId() == "" {
+		msg.Id = uuid.New().String()
+	}
+	msg.Mentions = s.parseMentions(serverID, msg.GetUsername(), msg.GetText())
+	msg.IsBot = msg.GetIsBot() || s.isBot(msg.GetUsername())
+	if s.sharding != nil {
+		return s.sharding.store(serverID, channelID, msg)
+	}
+
+	resp, err := s.commit(&pb.Command{Payload: &pb.Command_StoreMessage{StoreMessage: &pb.StoreMessageCommand{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Message:   msg,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetMessage(), nil
+}
+
 func (s *server) authenticate(ctx context.Context) bool {
+	username, ok := s.userFromContext(ctx)
+	if ok {
+		s.publishPresence(s.presence.seen(username))
+	}
+	return ok
+}
+
+// userFromContext returns the user owning the token in the request metadata,
+// or the bot owning the API key.
+func (s *server) userFromContext(ctx context.Context) (string, bool) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return false
+		return "", false
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	tokens := md["authorization"]
 	if len(tokens) == 0 {
-		return false
+		return s.botFromContext(ctx)
 	}
 
 	token := tokens[0]
-	s.mu.Lock()
-	defer s.mu.Unlock()
 
-	for _, storeToken := range s.users {
+	for username, storeToken := range s.users {
 		if token == storeToken {
-			return true
+			return username, true
 		}
 	}
 
-	return false
+	return "", false
+}
+
+// loopback serves the chat service on an in-process listener and returns a
+// connection to it. The gateways call the service through it, so they need
+// neither a TLS client certificate of their own nor a port other processes
+// could reach without one.
+func (s *server) loopback() (*grpc.ClientConn, error) {
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	pb.RegisterChatServerServer(grpcServer, s)
+	go grpcServer.Serve(lis)
+
+	return grpc.NewClient("passthrough:///loopback",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
+// registerServices registers the chat service, and the federation and
+// cluster services if enabled, with a gRPC server.
+func (s *server) registerServices(grpcServer *grpc.Server) {
+	pb.RegisterChatServerServer(grpcServer, s)
+	if s.federation != nil {
+		pb.RegisterFederationServer(grpcServer, s.federation)
+	}
+	if s.replication != nil {
+		pb.RegisterClusterServer(grpcServer, s.replication)
+	}
 }
 
 func main() {
-	lis, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", *port))
+	flag.Parse()
+
+	lis, err := net.Listen("tcp", net.JoinHostPort(*listenHost, strconv.Itoa(*port)))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
-	pb.RegisterChatServerServer(grpcServer, NewServer())
+	blobs, err := newLocalBlobStore(*attachmentsDir)
+	if err != nil {
+		log.Fatalf("failed to open attachment store: %v", err)
+	}
+
+	if *raftID != "" && *brokerURL != "" {
+		log.Fatalf("-broker cannot be combined with -raft-id: every node of a Raft cluster publishes the events of the replicated log itself")
+	}
+	broker, err := newBroker(*brokerURL)
+	if err != nil {
+		log.Fatalf("failed to connect to the message broker: %v", err)
+	}
+
+	certs, err := loadCertificates(*tlsCert, *tlsKey, *tlsClientCA, *tlsCA)
+	if err != nil {
+		log.Fatalf("failed to load TLS certificates: %v", err)
+	}
+
+	chatServer := NewServer(blobs, broker)
+	chatServer.certs = certs
+	if err := chatServer.loadScheduled(*scheduleFile); err != nil {
+		log.Fatalf("failed to load scheduled messages: %v", err)
+	}
+	go chatServer.watchPresence(time.Second)
+	go chatServer.enforceRetention(*retentionInterval)
+	go chatServer.deliverScheduled(time.Second)
+	if err := chatServer.startReplication(*raftID, *raftCluster, *raftDir, *raftJoin); err != nil {
+		log.Fatalf("failed to start replication: %v", err)
+	}
+	if err := chatServer.startSharding(*shardChannels); err != nil {
+		log.Fatalf("failed to shard channels: %v", err)
+	}
+	if *raftLeave && chatServer.replication != nil {
+		go chatServer.replication.leaveOnExit()
+	}
+	if err := chatServer.startFederation(*instanceName, *federationPeers, *federationState); err != nil {
+		log.Fatalf("failed to start federation: %v", err)
+	}
+
+	// The REST gateway, gRPC-Web and Connect call the gRPC server through conn
+	conn, err := chatServer.loopback()
+	if err != nil {
+		log.Fatalf("failed to connect to the gRPC server: %v", err)
+	}
+
+	if *httpPort != 0 {
+		handler := chatServer.httpHandler(conn)
+		httpLis, err := net.Listen("tcp", net.JoinHostPort(*listenHost, strconv.Itoa(*httpPort)))
+		if err != nil {
+			log.Fatalf("failed to listen for HTTP: %v", err)
+		}
+		go func() {
+			log.Println("Starting HTTP server on port", *httpPort)
+			if err := http.Serve(certs.listen(httpLis), handler); err != nil {
+				log.Fatalf("failed to serve HTTP: %v", err)
+			}
+		}()
+	}
+
+	if *ircPort != 0 {
+		ircLis, err := net.Listen("tcp", net.JoinHostPort(*listenHost, strconv.Itoa(*ircPort)))
+		if err != nil {
+			log.Fatalf("failed to listen for IRC: %v", err)
+		}
+		go func() {
+			log.Println("Starting IRC gateway on port", *ircPort)
+			if err := chatServer.serveIRC(certs.listen(ircLis)); err != nil {
+				log.Fatalf("failed to serve IRC: %v", err)
+			}
+		}()
+	}
+
+	grpcServer := grpc.NewServer(certs.serverOption())
+	chatServer.registerServices(grpcServer)
 
 	log.Println("Starting server on port", *port)
 	if err := grpcServer.Serve(lis); err != nil {
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startTestServer serves a new chat server over an in-memory connection and
+// returns it with a client.
+func startTestServer(t *testing.T) (*server, pb.ChatServerClient) {
+	t.Helper()
+
+	blobs, err := newLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(blobs, &localBroker{})
+	return s, serveTestServer(t, s)
+}
+
+// serveTestServer serves an existing chat server over an in-memory
+// connection and returns a client.
+func serveTestServer(t *testing.T, s *server) pb.ChatServerClient {
+	t.Helper()
+	return pb.NewChatServerClient(dialTestServer(t, s))
+}
+
+// dialTestServer serves an existing chat server over an in-memory connection
+// and returns a connection to it.
+func dialTestServer(t *testing.T, s *server) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	s.registerServices(grpcServer)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// login logs a user in and returns a context carrying their token.
+func login(t *testing.T, client pb.ChatServerClient, username string) context.Context {
+	t.Helper()
+
+	res, err := client.Login(context.Background(), &pb.LoginRequest{Username: username, Password: "secret"})
+	if err != nil {
+		t.Fatalf("login %s: %v", username, err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", res.GetToken())
+}
+
+// testChannel creates a chat server owned by the user with a channel, and
+// returns their ids.
+func testChannel(t *testing.T, client pb.ChatServerClient, owner context.Context) (string, string) {
+	t.Helper()
+
+	srv, err := client.CreateChatServer(owner, &pb.CreateChatServerRequest{ServerName: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := client.CreateChannel(owner, &pb.CreateChannelRequest{ServerId: srv.GetServerId(), ChannelName: "general"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv.GetServerId(), ch.GetChannelId()
+}
+
+// send posts messages through SendMessages.
+func send(ctx context.Context, client pb.ChatServerClient, reqs ...*pb.SendMessageRequest) error {
+	stream, err := client.SendMessages(ctx)
+	if err != nil {
+		return err
+	}
+	for _, req := range reqs {
+		if err := stream.Send(req); err != nil {
+			break
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// listMessages returns the messages of a channel.
+func listMessages(t *testing.T, client pb.ChatServerClient, ctx context.Context, serverID, channelID string) []*pb.Message {
+	t.Helper()
+
+	stream, err := client.ListMessages(ctx, &pb.ListMessagesRequest{ServerId: serverID, ChannelId: channelID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []*pb.Message
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			break
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// subscribe opens a Subscribe stream and returns a function receiving its
+// next event.
+func subscribe(t *testing.T, client pb.ChatServerClient, ctx context.Context, serverID string) func() *pb.Event {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	stream, err := client.Subscribe(ctx, &pb.SubscribeRequest{ServerId: serverID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan *pb.Event, 100)
+	go func() {
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				close(events)
+				return
+			}
+			events <- event
+		}
+	}()
+	// Wait until the server has subscribed the stream
+	time.Sleep(50 * time.Millisecond)
+
+	return func() *pb.Event {
+		t.Helper()
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("subscription ended")
+			}
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatal("no event received")
+			return nil
+		}
+	}
+}
+
+// nextEvent returns the next event with a payload of the given kind,
+// skipping others such as presence updates.
+func nextEvent[T any](t *testing.T, next func() *pb.Event) T {
+	t.Helper()
+	for {
+		if payload, ok := next().GetPayload().(T); ok {
+			return payload
+		}
+	}
+}
+
+func wantCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Fatalf("got error %v, want %v", err, code)
+	}
+}
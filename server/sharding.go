@@ -0,0 +1,870 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+var shardChannels = flag.Bool("shard-channels", false, "With -raft-id, keep the messages of each channel only on the node owning it, chosen by consistent hashing, instead of on every node")
+
+const (
+	// ringReplicas is how many points each node has on the hash ring, so
+	// that channels spread evenly
+	ringReplicas = 64
+	// shardOutboxSize is how many events may wait to be delivered to another
+	// node before new ones are dropped for it
+	shardOutboxSize = 1024
+	// shardBatch is how many events are delivered to another node at once
+	shardBatch = 100
+	// rebalanceInterval is how often owners look for channels to hand off,
+	// besides whenever nodes join or leave
+	rebalanceInterval = 10 * time.Second
+	// shardForwardedHeader marks requests routed to the owner of a channel,
+	// which must not route them any further
+	shardForwardedHeader = "x-shard-forwarded"
+	// shardIndexHeader carries how far the node routing a request has
+	// applied the Raft log, for the owner to catch up to first
+	shardIndexHeader = "x-shard-applied-index"
+)
+
+// hashRing assigns keys to nodes by consistent hashing. A key belongs to the
+// node of the first point at or after its hash, so a node joining or leaving
+// only moves the keys next to its own points.
+type hashRing struct {
+	hashes []uint64
+	nodes  map[uint64]string
+}
+
+func newHashRing(nodes []string) *hashRing {
+	ring := &hashRing{nodes: make(map[uint64]string, len(nodes)*ringReplicas)}
+	for _, node := range nodes {
+		for i := 0; i < ringReplicas; i++ {
+			hash := ringHash(node + "#" + strconv.Itoa(i))
+			ring.hashes = append(ring.hashes, hash)
+			ring.nodes[hash] = node
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool { return ring.hashes[i] < ring.hashes[j] })
+	return ring
+}
+
+func ringHash(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// owner returns the node a key belongs to, or "" if the ring is empty.
+func (ring *hashRing) owner(key string) string {
+	if len(ring.hashes) == 0 {
+		return ""
+	}
+	hash := ringHash(key)
+	i := sort.Search(len(ring.hashes), func(i int) bool { return ring.hashes[i] >= hash })
+	if i == len(ring.hashes) {
+		i = 0
+	}
+	return ring.nodes[ring.hashes[i]]
+}
+
+// sharding spreads the messages of channels across the nodes of a Raft
+// cluster. Each channel has an owner, which alone stores its messages and
+// the read positions in it. The other nodes forward new messages, edits,
+// deletions and read markers to the owner, route ListMessages there, and ask
+// it for single messages, unread counts and search results. The owner
+// delivers the message events to the subscribers of every node. When nodes
+// join or leave, owners hand their channels to the node the ring assigns
+// them to now.
+type sharding struct {
+	s *server
+	r *replication
+
+	// moving holds the channels being handed off, which refuse new
+	// messages until the new owner takes over. It is guarded by s.mu.
+	moving    map[string]bool
+	rebalance chan struct{}
+
+	mu sync.Mutex
+	// outboxes holds the events waiting to be delivered to the other nodes
+	// by node id
+	outboxes map[string]chan *pb.Event
+}
+
+// startSharding shards the messages of channels across the nodes of the Raft
+// cluster, if enabled.
+func (s *server) startSharding(enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	if s.replication == nil {
+		return fmt.Errorf("sharding channels needs a Raft cluster, see -raft-id")
+	}
+
+	sh := &sharding{
+		s:         s,
+		r:         s.replication,
+		moving:    make(map[string]bool),
+		rebalance: make(chan struct{}, 1),
+		outboxes:  make(map[string]chan *pb.Event),
+	}
+	s.hub.observe(sh.enqueue)
+
+	s.mu.Lock()
+	s.sharding = sh
+	sh.nodesChanged()
+	s.mu.Unlock()
+
+	go sh.run()
+	return nil
+}
+
+// nodesChanged keeps an outbox for every other node and triggers a
+// rebalance. The caller must hold s.mu.
+func (sh *sharding) nodesChanged() {
+	if sh == nil {
+		return
+	}
+
+	sh.mu.Lock()
+	for id, outbox := range sh.outboxes {
+		if _, exists := sh.s.nodes[id]; !exists {
+			close(outbox)
+			delete(sh.outboxes, id)
+		}
+	}
+	for id := range sh.s.nodes {
+		if _, exists := sh.outboxes[id]; exists || id == string(sh.r.id) {
+			continue
+		}
+		outbox := make(chan *pb.Event, shardOutboxSize)
+		sh.outboxes[id] = outbox
+		go sh.deliver(id, outbox)
+	}
+	sh.mu.Unlock()
+
+	select {
+	case sh.rebalance <- struct{}{}:
+	default:
+	}
+}
+
+// ownerFor returns the node the ring assigns a channel to, or "" if channels
+// are not sharded. The caller must hold s.mu.
+func (sh *sharding) ownerFor(channelID string) string {
+	if sh == nil {
+		return ""
+	}
+	return sh.ring().owner(channelID)
+}
+
+// ring returns the hash ring over the registered nodes. The caller must hold
+// s.mu.
+func (sh *sharding) ring() *hashRing {
+	nodes := make([]string, 0, len(sh.s.nodes))
+	for id := range sh.s.nodes {
+		nodes = append(nodes, id)
+	}
+	return newHashRing(nodes)
+}
+
+// store stores a message on the node owning its channel. The caller must hold
+// s.mu, which is released while the message is forwarded to another node.
+func (sh *sharding) store(serverID, channelID string, msg *pb.Message) (*pb.Message, error) {
+	s := sh.s
+	owner := s.owners[channelID]
+	switch {
+	case owner == "":
+		return nil, grpc.Errorf(codes.Unavailable, "channel %s has no owner yet", channelID)
+	case owner == string(sh.r.id):
+		if sh.moving[channelID] {
+			return nil, grpc.Errorf(codes.Unavailable, "channel %s is moving to another node", channelID)
+		}
+		s.applyStoreMessage(serverID, channelID, msg)
+		return msg, nil
+	}
+
+	s.mu.Unlock()
+	defer s.mu.Lock()
+
+	client, err := sh.r.client(owner)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(sh.r.outgoing(context.Background()), raftApplyTimeout)
+	defer cancel()
+	return client.StoreMessage(ctx, &pb.StoreMessageCommand{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Message:   msg,
+	})
+}
+
+// remoteOwner returns the node owning a channel if that is another node, or
+// "" if this node serves the channel itself. The caller must hold s.mu.
+func (sh *sharding) remoteOwner(channelID string) string {
+	if sh == nil {
+		return ""
+	}
+	if owner := sh.s.owners[channelID]; owner != string(sh.r.id) {
+		return owner
+	}
+	return ""
+}
+
+// forward returns a client for the owner of a channel, and a context
+// carrying the credentials of the request for calling it, if another node
+// owns the channel. The client is nil if this node serves the request
+// itself.
+func (sh *sharding) forward(ctx context.Context, channelID string) (pb.ChatServerClient, context.Context, error) {
+	if sh == nil {
+		return nil, ctx, nil
+	}
+	s := sh.s
+	s.mu.Lock()
+	owner := sh.remoteOwner(channelID)
+	s.mu.Unlock()
+	md, _ := metadata.FromIncomingContext(ctx)
+	if owner == "" {
+		return nil, ctx, sh.catchUp(md)
+	}
+
+	if len(md.Get(shardForwardedHeader)) > 0 {
+		// The nodes disagree on the owner while it changes
+		return nil, ctx, grpc.Errorf(codes.Unavailable, "channel %s is moving to another node", channelID)
+	}
+	conn, err := sh.r.nodeConn(owner)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	forwarded := metadata.Pairs(
+		shardForwardedHeader, string(sh.r.id),
+		shardIndexHeader, strconv.FormatUint(sh.r.raft.AppliedIndex(), 10),
+	)
+	for _, key := range []string{"authorization", apiKeyHeader} {
+		forwarded.Set(key, md.Get(key)...)
+	}
+	return pb.NewChatServerClient(conn), metadata.NewOutgoingContext(ctx, forwarded), nil
+}
+
+// outgoing adds the cluster secret and how far this node has applied the
+// Raft log to a request to another node.
+func (sh *sharding) outgoing(ctx context.Context) context.Context {
+	index := strconv.FormatUint(sh.r.raft.AppliedIndex(), 10)
+	return metadata.AppendToOutgoingContext(sh.r.outgoing(ctx), shardIndexHeader, index)
+}
+
+// catchUp waits until this node has applied the Raft log as far as the node
+// that routed a request to it had, so that the request sees the same users
+// and memberships, like a user who just joined the chat server.
+func (sh *sharding) catchUp(md metadata.MD) error {
+	if sh == nil {
+		return nil
+	}
+	values := md.Get(shardIndexHeader)
+	if len(values) == 0 {
+		return nil
+	}
+	index, err := strconv.ParseUint(values[0], 10, 64)
+	if err != nil {
+		return grpc.Errorf(codes.InvalidArgument, "invalid %s", shardIndexHeader)
+	}
+
+	timeout := time.After(raftApplyTimeout)
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for sh.r.raft.AppliedIndex() < index {
+		select {
+		case <-timeout:
+			return grpc.Errorf(codes.Unavailable, "timed out catching up with the cluster")
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// apply applies a command changing the messages of a channel on the node
+// that owns it. The messages of sharded channels are not in the Raft log, so
+// neither are their edits and deletions. The caller must hold s.mu, which is
+// released while another owner is asked.
+func (sh *sharding) apply(channelID string, cmd *pb.Command) (*pb.ApplyResponse, error) {
+	s := sh.s
+	owner := s.owners[channelID]
+	switch {
+	case owner == "":
+		return nil, grpc.Errorf(codes.Unavailable, "channel %s has no owner yet", channelID)
+	case owner == string(sh.r.id):
+		if sh.moving[channelID] {
+			return nil, grpc.Errorf(codes.Unavailable, "channel %s is moving to another node", channelID)
+		}
+		return s.applyCommand(cmd)
+	}
+
+	s.mu.Unlock()
+	defer s.mu.Lock()
+
+	client, err := sh.r.client(owner)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(sh.r.outgoing(context.Background()), raftApplyTimeout)
+	defer cancel()
+	return client.ChangeMessage(ctx, &pb.ChangeMessageRequest{ChannelId: channelID, Command: cmd})
+}
+
+// fetchMessage reads a message of a channel another node owns from the
+// owner. The caller must hold s.mu, which is released while the owner is
+// asked.
+func (sh *sharding) fetchMessage(owner, channelID, messageID string) (*pb.Message, error) {
+	s := sh.s
+	s.mu.Unlock()
+	defer s.mu.Lock()
+
+	client, err := sh.r.client(owner)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(sh.outgoing(context.Background()), raftApplyTimeout)
+	defer cancel()
+	return client.FetchMessage(ctx, &pb.FetchMessageRequest{ChannelId: channelID, MessageId: messageID})
+}
+
+// unreadCounts asks the owners of the channels of a chat server, or of every
+// chat server the user joined if serverID is empty, for the unread counts of
+// the user in the channels other nodes own, by channel id. Owners that cannot
+// be reached are left out, so their channels show no unread messages. The
+// caller must not hold s.mu.
+func (sh *sharding) unreadCounts(username, serverID string) map[string]*pb.UnreadCount {
+	if sh == nil {
+		return nil
+	}
+	s := sh.s
+	s.mu.Lock()
+	byOwner := make(map[string][]string)
+	for id, channels := range s.channels {
+		if serverID != "" && id != serverID {
+			continue
+		}
+		if _, member := s.members[id][username]; serverID == "" && !member {
+			continue
+		}
+		for channelID := range channels {
+			if owner := sh.remoteOwner(channelID); owner != "" {
+				byOwner[owner] = append(byOwner[owner], channelID)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	counts := make(map[string]*pb.UnreadCount)
+	for owner, channelIDs := range byOwner {
+		client, err := sh.r.client(owner)
+		if err == nil {
+			var resp *pb.CountUnreadResponse
+			ctx, cancel := context.WithTimeout(sh.outgoing(context.Background()), raftApplyTimeout)
+			resp, err = client.CountUnread(ctx, &pb.CountUnreadRequest{Username: username, ChannelIds: channelIDs})
+			cancel()
+			for channelID, count := range resp.GetCounts() {
+				counts[channelID] = count
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to count unread messages on node %s: %v", owner, err)
+		}
+	}
+	return counts
+}
+
+// search runs a search on every other node, each searching the channels it
+// owns, and returns the newest limit matches of each with their total count.
+// Nodes that cannot be reached are left out. The caller must not hold s.mu.
+func (sh *sharding) search(username string, req *pb.SearchMessagesRequest, limit int) ([]*pb.SearchResult, int) {
+	if sh == nil {
+		return nil, 0
+	}
+	s := sh.s
+	s.mu.Lock()
+	var nodes []string
+	for id := range s.nodes {
+		if id != string(sh.r.id) {
+			nodes = append(nodes, id)
+		}
+	}
+	s.mu.Unlock()
+
+	var results []*pb.SearchResult
+	total := 0
+	for _, id := range nodes {
+		client, err := sh.r.client(id)
+		if err == nil {
+			var resp *pb.SearchShardResponse
+			ctx, cancel := context.WithTimeout(sh.outgoing(context.Background()), raftApplyTimeout)
+			resp, err = client.SearchShard(ctx, &pb.SearchShardRequest{
+				Username: username,
+				Query:    req.GetQuery(),
+				ServerId: req.GetServerId(),
+				Limit:    int32(limit),
+			})
+			cancel()
+			results = append(results, resp.GetResults()...)
+			total += int(resp.GetTotalCount())
+		}
+		if err != nil {
+			log.Printf("Failed to search node %s: %v", id, err)
+		}
+	}
+	return results, total
+}
+
+// routeListMessages serves ListMessages from the owner of the channel if that
+// is another node, and reports whether it did.
+func (sh *sharding) routeListMessages(req *pb.ListMessagesRequest, stream pb.ChatServer_ListMessagesServer) (bool, error) {
+	owner, ctx, err := sh.forward(stream.Context(), req.GetChannelId())
+	if err != nil {
+		return true, err
+	}
+	if owner == nil {
+		return false, nil
+	}
+	upstream, err := owner.ListMessages(ctx, req)
+	if err != nil {
+		return true, err
+	}
+	for {
+		msg, err := upstream.Recv()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		if err := stream.Send(msg); err != nil {
+			return true, err
+		}
+	}
+}
+
+// enqueue queues the message events of this node for the other nodes. It is
+// called for every event the hub publishes and does not block.
+func (sh *sharding) enqueue(event *pb.Event) {
+	switch event.GetPayload().(type) {
+	case *pb.Event_MessageCreated, *pb.Event_MessageEdited, *pb.Event_MessageExpired, *pb.Event_MessageDeleted:
+	default:
+		// Other events come from the Raft log, which every node applies
+		// itself, or concern state that stays on its node
+		return
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	for id, outbox := range sh.outboxes {
+		select {
+		case outbox <- event:
+		default:
+			log.Printf("Dropping event for slow node %s", id)
+		}
+	}
+}
+
+// deliver sends the events queued for a node in batches until the node
+// leaves. Events that cannot be delivered are dropped, like for a slow
+// subscriber.
+func (sh *sharding) deliver(id string, outbox chan *pb.Event) {
+	for event := range outbox {
+		batch := []*pb.Event{event}
+	fill:
+		for len(batch) < shardBatch {
+			select {
+			case event, ok := <-outbox:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, event)
+			default:
+				break fill
+			}
+		}
+
+		client, err := sh.r.client(id)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(sh.r.outgoing(context.Background()), raftApplyTimeout)
+			_, err = client.Deliver(ctx, &pb.DeliverRequest{Events: batch})
+			cancel()
+		}
+		if err != nil {
+			log.Printf("Failed to deliver %d events to node %s: %v", len(batch), id, err)
+		}
+	}
+}
+
+// run rebalances the channels whenever nodes join or leave, and periodically
+// to retry hand-offs that failed.
+func (sh *sharding) run() {
+	ticker := time.NewTicker(rebalanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sh.rebalance:
+		case <-ticker.C:
+		}
+		sh.rebalanceChannels()
+	}
+}
+
+type channelMove struct {
+	channelID string
+	owner     string
+}
+
+// rebalanceChannels hands the channels this node owns to the node the ring
+// assigns them to. The leader also assigns the channels without an owner,
+// like those of nodes that left without handing them off, whose messages are
+// lost.
+func (sh *sharding) rebalanceChannels() {
+	s := sh.s
+	s.mu.Lock()
+	ring := sh.ring()
+	self := string(sh.r.id)
+	leader := sh.r.raft.State() == raft.Leader
+	var moves, orphans []channelMove
+	for _, channels := range s.channels {
+		for channelID := range channels {
+			owner, want := s.owners[channelID], ring.owner(channelID)
+			if want == "" || owner == want {
+				continue
+			}
+			if owner == self {
+				moves = append(moves, channelMove{channelID: channelID, owner: want})
+			} else if _, exists := s.nodes[owner]; !exists && leader {
+				orphans = append(orphans, channelMove{channelID: channelID, owner: want})
+			}
+		}
+	}
+
+	for _, orphan := range orphans {
+		_, err := s.commit(&pb.Command{Payload: &pb.Command_SetChannelOwner{SetChannelOwner: &pb.SetChannelOwnerCommand{
+			ChannelId: orphan.channelID,
+			Owner:     orphan.owner,
+		}}})
+		if err != nil {
+			log.Printf("Failed to assign channel %s to node %s: %v", orphan.channelID, orphan.owner, err)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, move := range moves {
+		if err := sh.move(move.channelID, move.owner); err != nil {
+			log.Printf("Failed to hand channel %s to node %s: %v", move.channelID, move.owner, err)
+		}
+	}
+}
+
+// move hands a channel this node owns to another node. New messages are
+// refused while its history is copied over, then the cluster records the new
+// owner and this node drops the history.
+func (sh *sharding) move(channelID, owner string) error {
+	s := sh.s
+	self := string(sh.r.id)
+	s.mu.Lock()
+	if sh.moving[channelID] || s.owners[channelID] != self {
+		s.mu.Unlock()
+		return nil
+	}
+	sh.moving[channelID] = true
+	serverID, _ := s.channelServer(channelID)
+	req := &pb.ImportChannelRequest{
+		ServerId:  serverID,
+		ChannelId: channelID,
+		Sequence:  s.sequences[channelID],
+	}
+	for _, msg := range s.messages[channelID] {
+		req.Messages = append(req.Messages, proto.Clone(msg).(*pb.Message))
+	}
+	// Read positions live with the messages they count unread ones of
+	for username, channels := range s.readState {
+		if seq, ok := channels[channelID]; ok {
+			if req.ReadPositions == nil {
+				req.ReadPositions = make(map[string]int64)
+			}
+			req.ReadPositions[username] = seq
+		}
+	}
+	s.mu.Unlock()
+
+	err := func() error {
+		client, err := sh.r.client(owner)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(sh.r.outgoing(context.Background()), raftApplyTimeout)
+		defer cancel()
+		if _, err := client.ImportChannel(ctx, req); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_, err = s.commit(&pb.Command{Payload: &pb.Command_SetChannelOwner{SetChannelOwner: &pb.SetChannelOwnerCommand{
+			ChannelId: channelID,
+			Owner:     owner,
+		}}})
+		return err
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(sh.moving, channelID)
+	if err != nil {
+		return err
+	}
+	if s.owners[channelID] != self {
+		for _, msg := range s.messages[channelID] {
+			s.index.remove(msg.GetId())
+		}
+		delete(s.messages, channelID)
+		delete(s.sequences, channelID)
+		for _, channels := range s.readState {
+			delete(channels, channelID)
+		}
+	}
+	log.Printf("Handed channel %s with %d messages to node %s", channelID, len(req.GetMessages()), owner)
+	return nil
+}
+
+// handOff moves every channel this node owns to the other nodes, for leaving
+// the cluster.
+func (sh *sharding) handOff() error {
+	if sh == nil {
+		return nil
+	}
+
+	s := sh.s
+	for attempt := 1; ; attempt++ {
+		sh.rebalanceChannels()
+
+		s.mu.Lock()
+		owned := 0
+		for _, owner := range s.owners {
+			if owner == string(sh.r.id) {
+				owned++
+			}
+		}
+		s.mu.Unlock()
+		if owned == 0 {
+			return nil
+		}
+		if attempt == 10 {
+			return fmt.Errorf("%d channels could not be handed off", owned)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// StoreMessage stores a message forwarded by another node in a channel this
+// node owns.
+func (r *replication) StoreMessage(ctx context.Context, req *pb.StoreMessageCommand) (*pb.Message, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sharding == nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "channels are not sharded")
+	}
+	if s.owners[req.GetChannelId()] != string(r.id) {
+		// Forwarding again could go in circles while the owner changes
+		return nil, grpc.Errorf(codes.Unavailable, "channel %s is owned by another node", req.GetChannelId())
+	}
+	return s.sharding.store(req.GetServerId(), req.GetChannelId(), req.GetMessage())
+}
+
+// ChangeMessage applies an edit or deletion forwarded by another node to a
+// channel this node owns.
+func (r *replication) ChangeMessage(ctx context.Context, req *pb.ChangeMessageRequest) (*pb.ApplyResponse, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sharding == nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "channels are not sharded")
+	}
+	if s.owners[req.GetChannelId()] != string(r.id) {
+		// Forwarding again could go in circles while the owner changes
+		return nil, grpc.Errorf(codes.Unavailable, "channel %s is owned by another node", req.GetChannelId())
+	}
+	return s.sharding.apply(req.GetChannelId(), req.GetCommand())
+}
+
+// ImportChannel takes over the history of a channel from its previous owner,
+// replacing any older copy.
+func (r *replication) ImportChannel(ctx context.Context, req *pb.ImportChannelRequest) (*pb.ImportChannelResponse, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sharding == nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "channels are not sharded")
+	}
+	channelID := req.GetChannelId()
+	for _, msg := range s.messages[channelID] {
+		s.index.remove(msg.GetId())
+	}
+	delete(s.messages, channelID)
+	s.sequences[channelID] = req.GetSequence()
+	if len(req.GetMessages()) > 0 {
+		s.messages[channelID] = req.GetMessages()
+	}
+	for _, msg := range req.GetMessages() {
+		s.index.add(req.GetServerId(), channelID, msg)
+		s.scheduleExpiry(req.GetServerId(), channelID, msg)
+	}
+	for username, seq := range req.GetReadPositions() {
+		if s.readState[username] == nil {
+			s.readState[username] = make(map[string]int64)
+		}
+		if seq > s.readState[username][channelID] {
+			s.readState[username][channelID] = seq
+		}
+	}
+	return &pb.ImportChannelResponse{}, nil
+}
+
+// Deliver hands the message events of channels owned by another node to the
+// subscribers of this one. The pins and saved messages of this node drop the
+// messages that were removed.
+func (r *replication) Deliver(ctx context.Context, req *pb.DeliverRequest) (*pb.DeliverResponse, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	s := r.s
+	for _, event := range req.GetEvents() {
+		var channelID, messageID string
+		switch p := event.GetPayload().(type) {
+		case *pb.Event_MessageDeleted:
+			channelID, messageID = p.MessageDeleted.GetChannelId(), p.MessageDeleted.GetMessageId()
+		case *pb.Event_MessageExpired:
+			channelID, messageID = p.MessageExpired.GetChannelId(), p.MessageExpired.GetMessageId()
+		}
+		if messageID != "" {
+			s.mu.Lock()
+			s.forgetMessages(channelID, []*pb.Message{{Id: messageID}})
+			s.mu.Unlock()
+		}
+		s.hub.deliver(event)
+	}
+	return &pb.DeliverResponse{}, nil
+}
+
+// FetchMessage returns a message of a channel this node owns. The calling
+// node checked that the user may read it.
+func (r *replication) FetchMessage(ctx context.Context, req *pb.FetchMessageRequest) (*pb.Message, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	s := r.s
+	md, _ := metadata.FromIncomingContext(ctx)
+	if err := s.sharding.catchUp(md); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sharding == nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "channels are not sharded")
+	}
+	if s.owners[req.GetChannelId()] != string(r.id) {
+		return nil, grpc.Errorf(codes.Unavailable, "channel %s is owned by another node", req.GetChannelId())
+	}
+	msg := s.findMessage(req.GetChannelId(), req.GetMessageId())
+	if msg == nil {
+		return nil, grpc.Errorf(codes.NotFound, "message not found")
+	}
+	return proto.Clone(msg).(*pb.Message), nil
+}
+
+// CountUnread counts the unread messages of a user in the given channels
+// this node owns, leaving out the others.
+func (r *replication) CountUnread(ctx context.Context, req *pb.CountUnreadRequest) (*pb.CountUnreadResponse, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	s := r.s
+	md, _ := metadata.FromIncomingContext(ctx)
+	if err := s.sharding.catchUp(md); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sharding == nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "channels are not sharded")
+	}
+	username := req.GetUsername()
+	resp := &pb.CountUnreadResponse{Counts: make(map[string]*pb.UnreadCount)}
+	for _, channelID := range req.GetChannelIds() {
+		serverID, ok := s.channelServer(channelID)
+		if !ok || s.owners[channelID] != string(r.id) {
+			continue
+		}
+		unread, mentions := s.unreadCounts(username, s.members[serverID][username], channelID)
+		resp.Counts[channelID] = &pb.UnreadCount{UnreadCount: unread, MentionCount: mentions}
+	}
+	return resp, nil
+}
+
+// SearchShard searches the channels this node owns for a user of another
+// node.
+func (r *replication) SearchShard(ctx context.Context, req *pb.SearchShardRequest) (*pb.SearchShardResponse, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	q, err := parseSearchQuery(req.GetQuery())
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	s := r.s
+	md, _ := metadata.FromIncomingContext(ctx)
+	if err := s.sharding.catchUp(md); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sharding == nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "channels are not sharded")
+	}
+	results := s.searchResults(q, req.GetServerId(), req.GetUsername())
+	resp := &pb.SearchShardResponse{TotalCount: int32(len(results))}
+	for i := 0; i < len(results) && i < int(req.GetLimit()); i++ {
+		result := results[i]
+		result.Message = proto.Clone(result.GetMessage()).(*pb.Message)
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
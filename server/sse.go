@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// sseKeepAlive is how often an idle event stream gets a comment, so proxies
+// do not close the connection.
+const sseKeepAlive = 15 * time.Second
+
+// handleChannelEvents streams the new messages of a channel as Server-Sent
+// Events. Every event carries the seq of its message as id, so a client that
+// reconnects with Last-Event-ID first gets the messages it missed. The token
+// comes from ?token=, since EventSource cannot set headers, or from the
+// Authorization header like on the REST gateway.
+func (s *server) handleChannelEvents(w http.ResponseWriter, r *http.Request) {
+	md := metadata.MD{}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	}
+	if token != "" {
+		md.Set("authorization", token)
+	}
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		md.Set(apiKeyHeader, key)
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	var lastSeq int64
+	if lastEventID != "" {
+		seq, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || seq < 0 {
+			writeJSONError(w, http.StatusBadRequest, "Last-Event-ID must be a message seq")
+			return
+		}
+		lastSeq = seq
+	}
+
+	channelID := r.PathValue("id")
+	s.mu.Lock()
+	serverID, ok := s.channelServer(channelID)
+	if !ok {
+		s.mu.Unlock()
+		writeJSONError(w, http.StatusNotFound, "channel not found")
+		return
+	}
+	if _, member := s.members[serverID][username]; !member {
+		s.mu.Unlock()
+		writeJSONError(w, http.StatusForbidden, "not a member of the chat server")
+		return
+	}
+	// Subscribe before reading the history so no message falls in between
+	events := s.hub.subscribe(serverID)
+	if lastEventID == "" {
+		lastSeq = s.sequences[channelID]
+	}
+	backlog, lastSeq := s.sseMessagesAfter(channelID, lastSeq)
+	remote := s.sharding.remoteOwner(channelID) != ""
+	s.mu.Unlock()
+	defer s.hub.unsubscribe(serverID, events)
+	if remote && lastEventID != "" {
+		// The owner alone keeps the messages of a sharded channel
+		var err error
+		backlog, lastSeq, err = s.remoteMessagesAfter(ctx, serverID, channelID, lastSeq)
+		if err != nil {
+			writeJSONError(w, http.StatusServiceUnavailable, status.Convert(err).Message())
+			return
+		}
+	}
+	defer s.trackStream(ctx)()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	send := func(events []string) bool {
+		for _, event := range events {
+			if _, err := fmt.Fprint(w, event); err != nil {
+				return false
+			}
+		}
+		return rc.Flush() == nil
+	}
+	if !send(backlog) {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if !send([]string{": keep-alive\n\n"}) {
+				return
+			}
+		case event := <-events:
+			switch p := event.GetPayload().(type) {
+			case *pb.Event_MessageCreated:
+				if p.MessageCreated.GetChannelId() != channelID {
+					continue
+				}
+				var messages []string
+				s.mu.Lock()
+				if msg := p.MessageCreated.GetMessage(); msg.GetVisibleTo() != "" {
+					// Ephemeral messages are never stored and have no
+					// seq to resume from
+					if visibleTo(event, username) {
+						messages = append(messages, sseEvent(msg, false))
+					}
+				} else {
+					// Catching up from the history also covers events
+					// the hub dropped because the client was slow
+					messages, lastSeq = s.sseMessagesAfter(channelID, lastSeq)
+					// Messages posted on another replica may not be in the
+					// history of this one yet
+					if msg.GetSeq() > lastSeq {
+						messages = append(messages, sseEvent(msg, true))
+						lastSeq = msg.GetSeq()
+					}
+				}
+				s.mu.Unlock()
+				if !send(messages) {
+					return
+				}
+			case *pb.Event_MemberLeft:
+				if p.MemberLeft.GetUsername() == username {
+					return
+				}
+			case *pb.Event_ChannelDeleted:
+				if p.ChannelDeleted.GetChannelId() == channelID {
+					return
+				}
+			}
+		}
+	}
+}
+
+// sseMessagesAfter formats the messages of a channel after the given seq as
+// events and returns the seq of the last one. The caller must hold s.mu.
+func (s *server) sseMessagesAfter(channelID string, seq int64) ([]string, int64) {
+	messages := s.messages[channelID]
+	i := len(messages)
+	for i > 0 && messages[i-1].GetSeq() > seq {
+		i--
+	}
+
+	var events []string
+	now := time.Now()
+	for _, msg := range messages[i:] {
+		seq = msg.GetSeq()
+		// Self-destructing messages may outlive their expiry by a moment
+		if msg.GetExpiresAt() != nil && !msg.GetExpiresAt().AsTime().After(now) {
+			continue
+		}
+		events = append(events, sseEvent(msg, true))
+	}
+	return events, seq
+}
+
+// remoteMessagesAfter is sseMessagesAfter for a channel another node owns,
+// reading the messages from the owner. The caller must not hold s.mu.
+func (s *server) remoteMessagesAfter(ctx context.Context, serverID, channelID string, seq int64) ([]string, int64, error) {
+	owner, ctx, err := s.sharding.forward(ctx, channelID)
+	if err != nil || owner == nil {
+		return nil, seq, err
+	}
+	stream, err := owner.ListMessages(ctx, &pb.ListMessagesRequest{ServerId: serverID, ChannelId: channelID})
+	if err != nil {
+		return nil, seq, err
+	}
+
+	var events []string
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return events, seq, nil
+		}
+		if err != nil {
+			return nil, seq, err
+		}
+		if msg.GetSeq() <= seq {
+			continue
+		}
+		seq = msg.GetSeq()
+		events = append(events, sseEvent(msg, true))
+	}
+}
+
+// sseEvent formats a message as a message event with the message as JSON
+// data, using its seq as the event id when withID is set.
+func sseEvent(msg *pb.Message, withID bool) string {
+	data, err := marshalJSON(msg)
+	if err != nil {
+		return ""
+	}
+	event := "event: message\n"
+	if withID {
+		event += fmt.Sprintf("id: %d\n", msg.GetSeq())
+	}
+	return event + "data: " + string(data) + "\n\n"
+}
+
+// channelServer returns the chat server a channel belongs to. The caller must
+// hold s.mu.
+func (s *server) channelServer(channelID string) (string, bool) {
+	for serverID, channels := range s.channels {
+		if _, ok := channels[channelID]; ok {
+			return serverID, true
+		}
+	}
+	return "", false
+}
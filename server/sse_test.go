@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/metadata"
+)
+
+// sseMessage is a message event read from a channel event stream.
+type sseMessage struct {
+	id   string
+	text string
+}
+
+// openEventStream opens the event stream of a channel and returns a function
+// reading its next message event.
+func openEventStream(t *testing.T, url, token, channelID, lastEventID string) func() sseMessage {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, "GET", url+"/channels/"+channelID+"/events?token="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("the event stream answered %d", resp.StatusCode)
+	}
+
+	events := make(chan sseMessage, 100)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var event sseMessage
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				var msg struct {
+					Text string `json:"text"`
+				}
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &msg)
+				event.text = msg.Text
+			case line == "":
+				if event.text != "" {
+					events <- event
+				}
+				event = sseMessage{}
+			}
+		}
+	}()
+	return func() sseMessage {
+		t.Helper()
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("the event stream ended")
+			}
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatal("no event received")
+			return sseMessage{}
+		}
+	}
+}
+
+func TestChannelEventStream(t *testing.T) {
+	s, client := startTestServer(t)
+	srv := httptest.NewServer(s.httpHandler(dialTestServer(t, s)))
+	t.Cleanup(srv.Close)
+
+	res, err := client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := metadata.AppendToOutgoingContext(context.Background(), "authorization", res.GetToken())
+	serverID, channelID := testChannel(t, client, alice)
+
+	next := openEventStream(t, srv.URL, res.GetToken(), channelID, "")
+	err = send(alice, client,
+		&pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "first"},
+		&pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := next()
+	if first.text != "first" || first.id == "" {
+		t.Fatalf("got %+v, want the first message with its seq as id", first)
+	}
+	if second := next(); second.text != "second" {
+		t.Fatalf("got %+v, want the second message", second)
+	}
+
+	// Reconnecting with Last-Event-ID replays what came after it
+	next = openEventStream(t, srv.URL, res.GetToken(), channelID, first.id)
+	if missed := next(); missed.text != "second" {
+		t.Fatalf("got %+v after reconnecting, want the second message", missed)
+	}
+}
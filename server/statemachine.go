@@ -0,0 +1,482 @@
+package main
+
+import (
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+// commit applies a change to the users, chat servers, channels, memberships
+// or messages. Without replication the change is applied right away. With
+// replication it goes through the Raft log, and s.mu is released until this
+// node has applied it, so anything read before may have changed when commit
+// returns. The caller must hold s.mu.
+func (s *server) commit(cmd *pb.Command) (*pb.ApplyResponse, error) {
+	if s.replication == nil {
+		return s.applyCommand(cmd)
+	}
+
+	s.mu.Unlock()
+	defer s.mu.Lock()
+	return s.replication.commit(cmd)
+}
+
+// commitMessageChange commits a command changing the messages of a channel.
+// When channels are sharded only the owner keeps them, so the command is
+// applied by the owner instead of through the Raft log. The caller must hold
+// s.mu, which may be released.
+func (s *server) commitMessageChange(channelID string, cmd *pb.Command) (*pb.ApplyResponse, error) {
+	if s.sharding != nil {
+		return s.sharding.apply(channelID, cmd)
+	}
+	return s.commit(cmd)
+}
+
+// applyCommand applies a command to the state. It must behave the same on
+// every node, since each applies every command of the Raft log. The caller
+// must hold s.mu.
+func (s *server) applyCommand(cmd *pb.Command) (*pb.ApplyResponse, error) {
+	switch p := cmd.GetPayload().(type) {
+	case *pb.Command_Login:
+		s.users[p.Login.GetUsername()] = p.Login.GetToken()
+
+	case *pb.Command_CreateChatServer:
+		c := p.CreateChatServer
+		s.servers[c.GetServerId()] = &ChatServer{
+			ID:   c.GetServerId(),
+			Name: c.GetName(),
+		}
+		s.members[c.GetServerId()] = map[string]string{c.GetOwner(): roleOwner}
+
+	case *pb.Command_CreateChannel:
+		c := p.CreateChannel
+		if _, exists := s.servers[c.GetServerId()]; !exists {
+			return nil, grpc.Errorf(codes.NotFound, "chat server not found")
+		}
+		if s.channels[c.GetServerId()] == nil {
+			s.channels[c.GetServerId()] = make(map[string]string)
+		}
+		s.channels[c.GetServerId()][c.GetChannelId()] = c.GetName()
+		if c.GetOwner() != "" {
+			s.owners[c.GetChannelId()] = c.GetOwner()
+		}
+
+		s.hub.publish(&pb.Event{
+			ServerId: c.GetServerId(),
+			Payload: &pb.Event_ChannelCreated{ChannelCreated: &pb.ChannelCreated{
+				ChannelId:   c.GetChannelId(),
+				ChannelName: c.GetName(),
+			}},
+		})
+
+	case *pb.Command_RenameChannel:
+		c := p.RenameChannel
+		if _, exists := s.channels[c.GetServerId()][c.GetChannelId()]; !exists {
+			return nil, grpc.Errorf(codes.NotFound, "channel not found")
+		}
+		s.channels[c.GetServerId()][c.GetChannelId()] = c.GetName()
+
+		s.hub.publish(&pb.Event{
+			ServerId: c.GetServerId(),
+			Payload: &pb.Event_ChannelRenamed{ChannelRenamed: &pb.ChannelRenamed{
+				ChannelId:   c.GetChannelId(),
+				ChannelName: c.GetName(),
+			}},
+		})
+
+	case *pb.Command_Join:
+		c := p.Join
+		if _, exists := s.servers[c.GetServerId()]; !exists {
+			return nil, grpc.Errorf(codes.NotFound, "chat server not found")
+		}
+		if s.members[c.GetServerId()] == nil {
+			s.members[c.GetServerId()] = make(map[string]string)
+		}
+		// Joining again keeps the role the member already has
+		if _, ok := s.members[c.GetServerId()][c.GetUsername()]; !ok {
+			s.members[c.GetServerId()][c.GetUsername()] = roleMember
+		}
+
+		s.hub.publish(&pb.Event{
+			ServerId: c.GetServerId(),
+			Payload: &pb.Event_MemberJoined{MemberJoined: &pb.MemberJoined{
+				Username:  c.GetUsername(),
+				InvitedBy: c.GetInvitedBy(),
+			}},
+		})
+
+	case *pb.Command_Leave:
+		c := p.Leave
+		if _, exists := s.servers[c.GetServerId()]; !exists {
+			return nil, grpc.Errorf(codes.NotFound, "chat server not found")
+		}
+		delete(s.members[c.GetServerId()], c.GetUsername())
+
+		s.hub.publish(&pb.Event{
+			ServerId: c.GetServerId(),
+			Payload: &pb.Event_MemberLeft{MemberLeft: &pb.MemberLeft{
+				Username: c.GetUsername(),
+				KickedBy: c.GetKickedBy(),
+			}},
+		})
+
+	case *pb.Command_SetRole:
+		c := p.SetRole
+		if _, ok := s.members[c.GetServerId()][c.GetUsername()]; !ok {
+			return nil, grpc.Errorf(codes.NotFound, "user is not a member of the chat server")
+		}
+		s.members[c.GetServerId()][c.GetUsername()] = c.GetRole()
+
+		s.hub.publish(&pb.Event{
+			ServerId: c.GetServerId(),
+			Payload: &pb.Event_RoleChanged{RoleChanged: &pb.RoleChanged{
+				Username: c.GetUsername(),
+				Role:     c.GetRole(),
+			}},
+		})
+
+	case *pb.Command_StoreMessage:
+		c := p.StoreMessage
+		s.applyStoreMessage(c.GetServerId(), c.GetChannelId(), c.GetMessage())
+		return &pb.ApplyResponse{Message: c.GetMessage()}, nil
+
+	case *pb.Command_DeleteChannel:
+		c := p.DeleteChannel
+		if _, exists := s.channels[c.GetServerId()][c.GetChannelId()]; !exists {
+			return nil, grpc.Errorf(codes.NotFound, "channel not found")
+		}
+		s.applyDeleteChannel(c.GetServerId(), c.GetChannelId())
+
+	case *pb.Command_EditMessage:
+		c := p.EditMessage
+		msg := s.findMessage(c.GetChannelId(), c.GetMessageId())
+		if msg == nil {
+			return nil, grpc.Errorf(codes.NotFound, "message not found")
+		}
+		// Stored messages are shared with events, pins and responses that
+		// may be in flight, so the edit goes to a copy
+		msg = proto.Clone(msg).(*pb.Message)
+		msg.Text = c.GetText()
+		msg.EditedAt = c.GetEditedAt()
+		msg.Mentions = s.parseMentions(c.GetServerId(), msg.GetUsername(), msg.GetText())
+		s.replaceMessage(c.GetServerId(), c.GetChannelId(), msg)
+
+		s.hub.publish(&pb.Event{
+			ServerId:  c.GetServerId(),
+			Timestamp: c.GetEditedAt(),
+			Payload: &pb.Event_MessageEdited{MessageEdited: &pb.MessageEdited{
+				ChannelId: c.GetChannelId(),
+				Message:   msg,
+			}},
+		})
+		return &pb.ApplyResponse{Message: msg}, nil
+
+	case *pb.Command_DeleteMessage:
+		c := p.DeleteMessage
+		if !s.removeMessage(c.GetChannelId(), c.GetMessageId()) {
+			return nil, grpc.Errorf(codes.NotFound, "message not found")
+		}
+
+		s.hub.publish(&pb.Event{
+			ServerId: c.GetServerId(),
+			Payload: &pb.Event_MessageDeleted{MessageDeleted: &pb.MessageDeleted{
+				ChannelId: c.GetChannelId(),
+				MessageId: c.GetMessageId(),
+				DeletedBy: c.GetDeletedBy(),
+			}},
+		})
+
+	case *pb.Command_AddNode:
+		s.nodes[p.AddNode.GetId()] = p.AddNode.GetAddress()
+		s.sharding.nodesChanged()
+
+	case *pb.Command_RemoveNode:
+		delete(s.nodes, p.RemoveNode.GetId())
+		s.sharding.nodesChanged()
+
+	case *pb.Command_SetChannelOwner:
+		s.owners[p.SetChannelOwner.GetChannelId()] = p.SetChannelOwner.GetOwner()
+
+	case *pb.Command_CreateBot:
+		c := p.CreateBot
+		name := c.GetBot().GetName()
+		if _, exists := s.users[name]; exists || s.isBot(name) {
+			return nil, grpc.Errorf(codes.AlreadyExists, "name %s is taken", name)
+		}
+		s.bots[name] = &storedBot{info: c.GetBot(), keyHash: c.GetKeyHash()}
+		s.botKeys[c.GetKeyHash()] = name
+
+	case *pb.Command_DeleteBot:
+		name := p.DeleteBot.GetName()
+		bot, exists := s.bots[name]
+		if !exists {
+			return nil, grpc.Errorf(codes.NotFound, "bot not found")
+		}
+		delete(s.bots, name)
+		delete(s.botKeys, bot.keyHash)
+
+		for serverID, members := range s.members {
+			if _, ok := members[name]; !ok {
+				continue
+			}
+			delete(members, name)
+			s.hub.publish(&pb.Event{
+				ServerId: serverID,
+				Payload:  &pb.Event_MemberLeft{MemberLeft: &pb.MemberLeft{Username: name}},
+			})
+		}
+
+	case *pb.Command_SetTopic:
+		c := p.SetTopic
+		if _, exists := s.channels[c.GetServerId()][c.GetChannelId()]; !exists {
+			return nil, grpc.Errorf(codes.NotFound, "channel not found")
+		}
+		if c.GetTopic() == "" {
+			delete(s.topics, c.GetChannelId())
+		} else {
+			s.topics[c.GetChannelId()] = c.GetTopic()
+		}
+
+		s.hub.publish(&pb.Event{
+			ServerId: c.GetServerId(),
+			Payload: &pb.Event_ChannelTopicChanged{ChannelTopicChanged: &pb.ChannelTopicChanged{
+				ChannelId: c.GetChannelId(),
+				Topic:     c.GetTopic(),
+				ChangedBy: c.GetChangedBy(),
+			}},
+		})
+
+	case *pb.Command_PinMessage:
+		c := p.PinMessage
+		pin := c.GetPin()
+		channelID := pin.GetChannelId()
+		if _, exists := s.channels[c.GetServerId()][channelID]; !exists {
+			return nil, grpc.Errorf(codes.NotFound, "channel not found")
+		}
+		for _, pinned := range s.pins[channelID] {
+			if pinned.GetMessage().GetId() == pin.GetMessage().GetId() {
+				return &pb.ApplyResponse{}, nil
+			}
+		}
+		if len(s.pins[channelID]) >= maxPinsPerChannel {
+			return nil, grpc.Errorf(codes.FailedPrecondition, "a channel can have at most %d pins", maxPinsPerChannel)
+		}
+		s.pins[channelID] = append(s.pins[channelID], pin)
+
+		s.hub.publish(&pb.Event{
+			ServerId: c.GetServerId(),
+			Payload:  &pb.Event_MessagePinned{MessagePinned: &pb.MessagePinned{Pin: pin}},
+		})
+
+	case *pb.Command_UnpinMessage:
+		c := p.UnpinMessage
+		pins := s.pins[c.GetChannelId()]
+		i := 0
+		for i < len(pins) && pins[i].GetMessage().GetId() != c.GetMessageId() {
+			i++
+		}
+		if i == len(pins) {
+			return nil, grpc.Errorf(codes.NotFound, "message is not pinned")
+		}
+		s.pins[c.GetChannelId()] = append(pins[:i:i], pins[i+1:]...)
+
+		s.hub.publish(&pb.Event{
+			ServerId: c.GetServerId(),
+			Payload: &pb.Event_MessageUnpinned{MessageUnpinned: &pb.MessageUnpinned{
+				ChannelId:  c.GetChannelId(),
+				MessageId:  c.GetMessageId(),
+				UnpinnedBy: c.GetUnpinnedBy(),
+			}},
+		})
+
+	case *pb.Command_SetRetention:
+		c := p.SetRetention
+		if _, exists := s.channels[c.GetServerId()][c.GetChannelId()]; !exists {
+			return nil, grpc.Errorf(codes.NotFound, "channel not found")
+		}
+		s.retention[c.GetChannelId()] = c.GetRetention()
+
+	case *pb.Command_PruneMessages:
+		c := p.PruneMessages
+		s.applyPruneMessages(c.GetServerId(), c.GetChannelId(), c.GetMessageIds())
+
+	default:
+		return nil, grpc.Errorf(codes.InvalidArgument, "unknown command")
+	}
+	return &pb.ApplyResponse{}, nil
+}
+
+// applyStoreMessage appends a message to the channel history and search
+// index, and notifies subscribers of the chat server and mentioned members.
+// The caller must hold s.mu.
+func (s *server) applyStoreMessage(serverID, channelID string, msg *pb.Message) {
+	s.sequences[channelID]++
+	msg.Seq = s.sequences[channelID]
+	s.messages[channelID] = append(s.messages[channelID], msg)
+	s.index.add(serverID, channelID, msg)
+	s.typing.stop(serverID, channelID, msg.GetUsername())
+
+	s.hub.publish(&pb.Event{
+		ServerId:  serverID,
+		Timestamp: msg.GetTimestamp(),
+		Payload: &pb.Event_MessageCreated{MessageCreated: &pb.MessageCreated{
+			ChannelId: channelID,
+			Message:   msg,
+		}},
+	})
+	s.notifyMentions(serverID, channelID, msg)
+	s.scheduleExpiry(serverID, channelID, msg)
+}
+
+// applyDeleteChannel removes a channel with everything that belongs to it and
+// tells subscribers it is gone. The caller must hold s.mu.
+func (s *server) applyDeleteChannel(serverID, channelID string) {
+	delete(s.channels[serverID], channelID)
+	s.forgetMessages(channelID, s.messages[channelID])
+	delete(s.messages, channelID)
+	delete(s.sequences, channelID)
+	delete(s.pins, channelID)
+	delete(s.topics, channelID)
+	delete(s.retention, channelID)
+	delete(s.owners, channelID)
+	for _, channels := range s.readState {
+		delete(channels, channelID)
+	}
+	s.federation.unlinkChannel(channelID)
+
+	s.hub.publish(&pb.Event{
+		ServerId: serverID,
+		Payload:  &pb.Event_ChannelDeleted{ChannelDeleted: &pb.ChannelDeleted{ChannelId: channelID}},
+	})
+}
+
+// scheduleExpiry removes a self-destructing message once it expires. Every
+// node expires its copy by itself.
+func (s *server) scheduleExpiry(serverID, channelID string, msg *pb.Message) {
+	if msg.GetExpiresAt() == nil {
+		return
+	}
+	time.AfterFunc(time.Until(msg.GetExpiresAt().AsTime()), func() {
+		s.expireMessage(serverID, channelID, msg.GetId())
+	})
+}
+
+// replicatedState returns a snapshot of the replicated state. The caller must
+// hold s.mu.
+func (s *server) replicatedState() *pb.ReplicatedState {
+	state := &pb.ReplicatedState{
+		Users: make(map[string]string, len(s.users)),
+		Nodes: make(map[string]string, len(s.nodes)),
+	}
+	for username, token := range s.users {
+		state.Users[username] = token
+	}
+	for id, address := range s.nodes {
+		state.Nodes[id] = address
+	}
+	for _, bot := range s.bots {
+		state.Bots = append(state.Bots, &pb.ReplicatedBot{Bot: bot.info, KeyHash: bot.keyHash})
+	}
+	for serverID, chatServer := range s.servers {
+		replicated := &pb.ReplicatedServer{
+			Id:      serverID,
+			Name:    chatServer.Name,
+			Members: make(map[string]string, len(s.members[serverID])),
+		}
+		for username, role := range s.members[serverID] {
+			replicated.Members[username] = role
+		}
+		for channelID, name := range s.channels[serverID] {
+			channel := &pb.ReplicatedChannel{
+				Id:        channelID,
+				Name:      name,
+				Owner:     s.owners[channelID],
+				Topic:     s.topics[channelID],
+				Pins:      s.pins[channelID],
+				Retention: s.retention[channelID],
+			}
+			if s.sharding == nil {
+				channel.Sequence = s.sequences[channelID]
+				channel.Messages = s.messages[channelID]
+			}
+			replicated.Channels = append(replicated.Channels, channel)
+		}
+		state.Servers = append(state.Servers, replicated)
+	}
+	return state
+}
+
+// restoreState replaces the replicated state with a snapshot. When channels
+// are sharded, the messages this node owns are kept. The caller must hold
+// s.mu.
+func (s *server) restoreState(state *pb.ReplicatedState) {
+	s.users = make(map[string]string, len(state.GetUsers()))
+	for username, token := range state.GetUsers() {
+		s.users[username] = token
+	}
+	s.nodes = make(map[string]string, len(state.GetNodes()))
+	for id, address := range state.GetNodes() {
+		s.nodes[id] = address
+	}
+	defer s.sharding.nodesChanged()
+	s.bots = make(map[string]*storedBot, len(state.GetBots()))
+	s.botKeys = make(map[string]string, len(state.GetBots()))
+	for _, replicated := range state.GetBots() {
+		name := replicated.GetBot().GetName()
+		s.bots[name] = &storedBot{info: replicated.GetBot(), keyHash: replicated.GetKeyHash()}
+		s.botKeys[replicated.GetKeyHash()] = name
+	}
+
+	s.servers = make(map[string]*ChatServer)
+	s.members = make(map[string]map[string]string)
+	s.channels = make(map[string]map[string]string)
+	s.owners = make(map[string]string)
+	s.topics = make(map[string]string)
+	s.pins = make(map[string][]*pb.Pin)
+	s.retention = make(map[string]*pb.RetentionPolicy)
+	if s.sharding == nil {
+		s.messages = make(map[string][]*pb.Message)
+		s.sequences = make(map[string]int64)
+		s.index = newSearchIndex()
+	}
+	for _, replicated := range state.GetServers() {
+		serverID := replicated.GetId()
+		s.servers[serverID] = &ChatServer{ID: serverID, Name: replicated.GetName()}
+		s.members[serverID] = make(map[string]string, len(replicated.GetMembers()))
+		for username, role := range replicated.GetMembers() {
+			s.members[serverID][username] = role
+		}
+		s.channels[serverID] = make(map[string]string, len(replicated.GetChannels()))
+		for _, channel := range replicated.GetChannels() {
+			channelID := channel.GetId()
+			s.channels[serverID][channelID] = channel.GetName()
+			if channel.GetOwner() != "" {
+				s.owners[channelID] = channel.GetOwner()
+			}
+			if channel.GetTopic() != "" {
+				s.topics[channelID] = channel.GetTopic()
+			}
+			if len(channel.GetPins()) > 0 {
+				s.pins[channelID] = channel.GetPins()
+			}
+			if channel.GetRetention() != nil {
+				s.retention[channelID] = channel.GetRetention()
+			}
+			if s.sharding != nil {
+				continue
+			}
+			s.sequences[channelID] = channel.GetSequence()
+			if len(channel.GetMessages()) == 0 {
+				continue
+			}
+			s.messages[channelID] = channel.GetMessages()
+			for _, msg := range channel.GetMessages() {
+				s.index.add(serverID, channelID, msg)
+				s.scheduleExpiry(serverID, channelID, msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var (
+	tlsCert     = flag.String("tls-cert", "", "PEM certificate file to serve TLS with, also presented to the cluster nodes and federation peers this server connects to; empty serves plaintext")
+	tlsKey      = flag.String("tls-key", "", "PEM private key file of -tls-cert")
+	tlsClientCA = flag.String("tls-client-ca", "", "PEM bundle of the CAs client certificates must be signed by; set to require client certificates (mutual TLS)")
+	tlsCA       = flag.String("tls-ca", "", "PEM bundle of the CAs to verify the cluster nodes and federation peers this server connects to, empty uses the system roots")
+)
+
+// tlsReloadInterval is how often the certificate files are checked for
+// changes.
+const tlsReloadInterval = 5 * time.Second
+
+// certificates holds the TLS certificate of the server and the CA bundles,
+// and reloads them when their files change, so renewed certificates are
+// picked up without a restart. New connections use the reloaded files;
+// established ones keep theirs.
+type certificates struct {
+	certFile, keyFile, clientCAFile, caFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	rootCAs   *x509.CertPool
+	// modTimes holds when each file was last modified as of the last load
+	modTimes map[string]time.Time
+}
+
+// loadCertificates loads the certificate and key, and the CA bundles if
+// given, then watches the files for changes. It returns nil if certFile is
+// empty, which serves plaintext.
+func loadCertificates(certFile, keyFile, clientCAFile, caFile string) (*certificates, error) {
+	if certFile == "" {
+		if keyFile != "" || clientCAFile != "" || caFile != "" {
+			return nil, fmt.Errorf("-tls-key, -tls-client-ca and -tls-ca need -tls-cert")
+		}
+		return nil, nil
+	}
+	if keyFile == "" {
+		return nil, fmt.Errorf("-tls-cert needs -tls-key")
+	}
+
+	c := &certificates{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		caFile:       caFile,
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	go c.watch(tlsReloadInterval)
+	return c, nil
+}
+
+// files returns the files the certificates are loaded from.
+func (c *certificates) files() []string {
+	files := []string{c.certFile, c.keyFile}
+	for _, file := range []string{c.clientCAFile, c.caFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// load reads the files. Nothing changes unless all of them are valid.
+func (c *certificates) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	var clientCAs, rootCAs *x509.CertPool
+	if c.clientCAFile != "" {
+		if clientCAs, err = loadCertPool(c.clientCAFile); err != nil {
+			return err
+		}
+	}
+	if c.caFile != "" {
+		if rootCAs, err = loadCertPool(c.caFile); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cert = &cert
+	c.clientCAs = clientCAs
+	c.rootCAs = rootCAs
+	c.modTimes = modTimes
+	return nil
+}
+
+// watch reloads the files whenever one of them is modified. If they fail to
+// load, like while a certificate and its key are being replaced one after the
+// other, the previous certificates stay in use until the files change again.
+func (c *certificates) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		modTimes := make(map[string]time.Time)
+		changed := false
+		c.mu.RLock()
+		for _, file := range c.files() {
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			modTimes[file] = info.ModTime()
+			if !info.ModTime().Equal(c.modTimes[file]) {
+				changed = true
+			}
+		}
+		c.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		if err := c.load(); err != nil {
+			log.Printf("Failed to reload TLS certificates, keeping the previous ones: %v", err)
+			// Try again once the files change again
+			c.mu.Lock()
+			for file, modTime := range modTimes {
+				c.modTimes[file] = modTime
+			}
+			c.mu.Unlock()
+			continue
+		}
+		log.Println("Reloaded TLS certificates")
+	}
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// serverConfig returns the TLS configuration of the listeners. Every
+// handshake uses the certificates loaded last, and requires a client
+// certificate if -tls-client-ca is set.
+func (c *certificates) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*c.cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+			if c.clientCAs != nil {
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+				config.ClientCAs = c.clientCAs
+			}
+			return config, nil
+		},
+	}
+}
+
+// clientConfig returns the TLS configuration for connecting to cluster nodes
+// and federation peers, presenting the certificate of this server. The
+// verification is done by hand so the CA bundle loaded last is used.
+func (c *certificates) clientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			return c.cert, nil
+		},
+		// VerifyConnection does the verification instead
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			c.mu.RLock()
+			roots := c.rootCAs
+			c.mu.RUnlock()
+
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("the server presented no certificate")
+			}
+			opts := x509.VerifyOptions{
+				Roots:         roots,
+				DNSName:       state.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range state.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := state.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+}
+
+// dialOption returns the transport credentials for connecting to cluster
+// nodes and federation peers.
+func (c *certificates) dialOption() grpc.DialOption {
+	if c == nil {
+		return grpc.WithTransportCredentials(insecure.NewCredentials())
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(c.clientConfig()))
+}
+
+// serverOption returns the transport credentials of the gRPC server.
+func (c *certificates) serverOption() grpc.ServerOption {
+	if c == nil {
+		return grpc.Creds(insecure.NewCredentials())
+	}
+	return grpc.Creds(credentials.NewTLS(c.serverConfig()))
+}
+
+// listen wraps a listener to serve TLS, or returns it as is for plaintext.
+func (c *certificates) listen(lis net.Listener) net.Listener {
+	if c == nil {
+		return lis
+	}
+	return tls.NewListener(lis, c.serverConfig())
+}
+
+// tlsStreamLayer carries the Raft traffic between nodes over mutual TLS.
+type tlsStreamLayer struct {
+	net.Listener
+	advertise net.Addr
+	certs     *certificates
+}
+
+func (l *tlsStreamLayer) Addr() net.Addr {
+	return l.advertise
+}
+
+func (l *tlsStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(string(address))
+	if err != nil {
+		return nil, err
+	}
+	config := l.certs.clientConfig()
+	config.ServerName = host
+	return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", string(address), config)
+}
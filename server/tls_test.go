@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func TestLoadCertificatesNeedsACertificate(t *testing.T) {
+	for _, files := range [][3]string{
+		{"server.key", "", ""},
+		{"", "ca.crt", ""},
+		{"", "", "ca.crt"},
+	} {
+		if _, err := loadCertificates("", files[0], files[1], files[2]); err == nil {
+			t.Errorf("loadCertificates without a certificate accepted key %q, client CA %q and CA %q", files[0], files[1], files[2])
+		}
+	}
+	if certs, err := loadCertificates("", "", "", ""); certs != nil || err != nil {
+		t.Errorf("loadCertificates without files = %v, %v, want plaintext", certs, err)
+	}
+}
+
+// testCA is a certificate authority issuing test certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for 127.0.0.1, usable by servers
+// and clients.
+func (ca *testCA) issue(t *testing.T, name string) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeTestFile writes a file, marking it modified at the given time so the
+// certificate watcher notices every rewrite.
+func writeTestFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startTLSTestServer serves a new chat server over TLS with the given
+// certificates and returns its address.
+func startTLSTestServer(t *testing.T, certs *certificates) string {
+	t.Helper()
+
+	blobs, err := newLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(blobs, &localBroker{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer(certs.serverOption())
+	s.registerServices(grpcServer)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+	return lis.Addr().String()
+}
+
+// tlsLogin logs in over TLS trusting roots, presenting the certificate if
+// any.
+func tlsLogin(t *testing.T, addr string, roots *testCA, certPEM, keyPEM []byte) error {
+	t.Helper()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(roots.cert)
+	config := &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+	if certPEM != nil {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = pb.NewChatServerClient(conn).Login(ctx, &pb.LoginRequest{Username: "alice", Password: "secret"})
+	return err
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca, rogue := newTestCA(t, "test CA"), newTestCA(t, "rogue CA")
+	dir := t.TempDir()
+	certFile, keyFile, clientCAFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt")
+	serverCert, serverKey := ca.issue(t, "server")
+	now := time.Now()
+	writeTestFile(t, certFile, serverCert, now)
+	writeTestFile(t, keyFile, serverKey, now)
+	writeTestFile(t, clientCAFile, ca.pem, now)
+
+	certs, err := loadCertificates(certFile, keyFile, clientCAFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startTLSTestServer(t, certs)
+
+	clientCert, clientKey := ca.issue(t, "alice")
+	if err := tlsLogin(t, addr, ca, clientCert, clientKey); err != nil {
+		t.Fatalf("a client certificate signed by the client CA was rejected: %v", err)
+	}
+	if err := tlsLogin(t, addr, ca, nil, nil); err == nil {
+		t.Fatal("a client without a certificate was accepted")
+	}
+	rogueCert, rogueKey := rogue.issue(t, "mallory")
+	if err := tlsLogin(t, addr, ca, rogueCert, rogueKey); err == nil {
+		t.Fatal("a client certificate signed by another CA was accepted")
+	}
+}
+
+func TestCertificatesReloadWithoutRestart(t *testing.T) {
+	oldCA, newCA := newTestCA(t, "old CA"), newTestCA(t, "new CA")
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	serverCert, serverKey := oldCA.issue(t, "server")
+	loaded := time.Now().Add(-time.Minute)
+	writeTestFile(t, certFile, serverCert, loaded)
+	writeTestFile(t, keyFile, serverKey, loaded)
+
+	certs, err := loadCertificates(certFile, keyFile, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Check for changes far more often than tlsReloadInterval
+	go certs.watch(20 * time.Millisecond)
+	addr := startTLSTestServer(t, certs)
+	if err := tlsLogin(t, addr, oldCA, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A key that does not match the certificate keeps the old pair in use
+	renewedCert, renewedKey := newCA.issue(t, "server")
+	writeTestFile(t, certFile, renewedCert, loaded.Add(time.Second))
+	time.Sleep(100 * time.Millisecond)
+	if err := tlsLogin(t, addr, oldCA, nil, nil); err != nil {
+		t.Fatalf("a half-replaced certificate was loaded: %v", err)
+	}
+
+	writeTestFile(t, keyFile, renewedKey, loaded.Add(2*time.Second))
+	eventually(t, 2*time.Second, func() bool {
+		return tlsLogin(t, addr, newCA, nil, nil) == nil
+	})
+	if err := tlsLogin(t, addr, oldCA, nil, nil); err == nil {
+		t.Fatal("the server still presents the old certificate")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// typingTimeout is how long a typing indicator lasts unless it is renewed.
+const typingTimeout = 5 * time.Second
+
+type typingKey struct {
+	serverID  string
+	channelID string
+	username  string
+}
+
+// typingTracker keeps the short-lived "is typing" state of each user. It is
+// never persisted.
+type typingTracker struct {
+	mu     sync.Mutex
+	hub    *hub
+	timers map[typingKey]*time.Timer
+}
+
+func newTypingTracker(h *hub) *typingTracker {
+	return &typingTracker{
+		hub:    h,
+		timers: make(map[typingKey]*time.Timer),
+	}
+}
+
+// start marks the user as typing in a channel, or renews the indicator if
+// they already are.
+func (t *typingTracker) start(serverID, channelID, username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := typingKey{serverID: serverID, channelID: channelID, username: username}
+	old, renewing := t.timers[key]
+	if renewing && old.Stop() {
+		old.Reset(typingTimeout)
+		return
+	}
+
+	// A timer that already fired may have its callback waiting for t.mu, so
+	// it is replaced rather than reset. The callback then finds another timer
+	// in place and leaves the indicator alone.
+	var timer *time.Timer
+	timer = time.AfterFunc(typingTimeout, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		// The indicator may have been renewed, or stopped and started again,
+		// meanwhile.
+		if t.timers[key] != timer {
+			return
+		}
+		delete(t.timers, key)
+		t.publish(key, false)
+	})
+	t.timers[key] = timer
+	if !renewing {
+		t.publish(key, true)
+	}
+}
+
+// stop clears the indicator, typically because the user sent their message.
+func (t *typingTracker) stop(serverID, channelID, username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := typingKey{serverID: serverID, channelID: channelID, username: username}
+	timer, ok := t.timers[key]
+	if !ok {
+		return
+	}
+	timer.Stop()
+	delete(t.timers, key)
+	t.publish(key, false)
+}
+
+func (t *typingTracker) publish(key typingKey, typing bool) {
+	t.hub.publish(&pb.Event{
+		ServerId: key.serverID,
+		Payload: &pb.Event_Typing{Typing: &pb.Typing{
+			ChannelId: key.channelID,
+			Username:  key.username,
+			Typing:    typing,
+		}},
+	})
+}
+
+func (s *server) StartTyping(ctx context.Context, req *pb.StartTypingRequest) (*pb.StartTypingResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	err := s.checkChannelAccess(req.GetServerId(), req.GetChannelId(), username)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.typing.start(req.GetServerId(), req.GetChannelId(), username)
+	return &pb.StartTypingResponse{}, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// MarkRead moves the read position of the caller in a channel. With sharded
+// channels read positions are kept by the owner of the channel, next to the
+// messages they count unread ones of.
+func (s *server) MarkRead(ctx context.Context, req *pb.MarkReadRequest) (*pb.MarkReadResponse, error) {
+	owner, ctx, err := s.sharding.forward(ctx, req.GetChannelId())
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil {
+		return owner.MarkRead(ctx, req)
+	}
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkChannelAccess(req.GetServerId(), req.GetChannelId(), username); err != nil {
+		return nil, err
+	}
+
+	channelID := req.GetChannelId()
+	seq := s.sequences[channelID]
+	if req.GetUpToMessageId() != "" {
+		msg := s.findMessage(channelID, req.GetUpToMessageId())
+		if msg == nil {
+			return nil, grpc.Errorf(codes.NotFound, "message not found")
+		}
+		seq = msg.GetSeq()
+	}
+
+	if s.readState[username] == nil {
+		s.readState[username] = make(map[string]int64)
+	}
+	// Read positions only move forward
+	if seq > s.readState[username][channelID] {
+		s.readState[username][channelID] = seq
+	}
+
+	return &pb.MarkReadResponse{}, nil
+}
+
+func (s *server) GetUnreadSummary(ctx context.Context, req *pb.GetUnreadSummaryRequest) (*pb.GetUnreadSummaryResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	remote := s.sharding.unreadCounts(username, "")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := &pb.GetUnreadSummaryResponse{}
+	for serverID, members := range s.members {
+		if _, ok := members[username]; !ok {
+			continue
+		}
+
+		summary := &pb.ServerUnread{
+			ServerId:   serverID,
+			ServerName: s.servers[serverID].Name,
+		}
+		for _, channel := range s.channelList(serverID, username, remote) {
+			if channel.GetUnreadCount() == 0 {
+				continue
+			}
+			summary.UnreadCount += channel.GetUnreadCount()
+			summary.MentionCount += channel.GetMentionCount()
+			summary.Channels = append(summary.Channels, channel)
+		}
+
+		resp.UnreadCount += summary.GetUnreadCount()
+		resp.MentionCount += summary.GetMentionCount()
+		resp.Servers = append(resp.Servers, summary)
+	}
+
+	sort.Slice(resp.Servers, func(i, j int) bool {
+		return resp.Servers[i].GetServerName() < resp.Servers[j].GetServerName()
+	})
+
+	return resp, nil
+}
+
+// channelList returns the channels of a chat server sorted by name, with
+// unread counts for the given user. The caller must hold s.mu.
+func (s *server) channelList(serverID, username string, remote map[string]*pb.UnreadCount) []*pb.Channel {
+	var channels []*pb.Channel
+	for channelID := range s.channels[serverID] {
+		channels = append(channels, s.channelInfo(serverID, channelID, username, remote))
+	}
+
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].GetName() < channels[j].GetName()
+	})
+	return channels
+}
+
+// channelInfo describes a channel of a chat server with unread counts for
+// the given user. remote holds the counts of the channels other nodes own,
+// see sharding.unreadCounts. The caller must hold s.mu.
+func (s *server) channelInfo(serverID, channelID, username string, remote map[string]*pb.UnreadCount) *pb.Channel {
+	unread, mentions := s.unreadCounts(username, s.members[serverID][username], channelID)
+	if count, ok := remote[channelID]; ok {
+		unread, mentions = count.GetUnreadCount(), count.GetMentionCount()
+	}
+	return &pb.Channel{
+		Id:           channelID,
+		Name:         s.channels[serverID][channelID],
+		UnreadCount:  unread,
+		MentionCount: mentions,
+		Retention:    s.retention[channelID],
+		Topic:        s.topics[channelID],
+	}
+}
+
+// unreadCounts returns how many messages in a channel the user has not read
+// yet, and how many of those mention them. The user's own messages are never
+// unread. The caller must hold s.mu.
+func (s *server) unreadCounts(username, role, channelID string) (unread, mentions int32) {
+	lastRead := s.readState[username][channelID]
+	messages := s.messages[channelID]
+
+	for i := len(messages) - 1; i >= 0 && messages[i].GetSeq() > lastRead; i-- {
+		if messages[i].GetUsername() == username {
+			continue
+		}
+		unread++
+		if mentioned(messages[i], username, role) {
+			mentions++
+		}
+	}
+	return unread, mentions
+}
+
+// findMessage returns the message with the given id in a channel, or nil.
+// The caller must hold s.mu.
+func (s *server) findMessage(channelID, messageID string) *pb.Message {
+	for _, msg := range s.messages[channelID] {
+		if msg.GetId() == messageID {
+			return msg
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc/codes"
+)
+
+func TestMarkReadChecksChannel(t *testing.T) {
+	_, client := startTestServer(t)
+	alice, mallory := login(t, client, "alice"), login(t, client, "mallory")
+	serverID, channelID := testChannel(t, client, alice)
+	otherServerID, _ := testChannel(t, client, mallory)
+
+	_, err := client.MarkRead(mallory, &pb.MarkReadRequest{ServerId: serverID, ChannelId: channelID})
+	wantCode(t, err, codes.PermissionDenied)
+	_, err = client.MarkRead(mallory, &pb.MarkReadRequest{ServerId: otherServerID, ChannelId: channelID})
+	wantCode(t, err, codes.NotFound)
+
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Username: "alice", Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	bob := login(t, client, "bob")
+	if _, err := client.JoinChatServer(bob, &pb.JoinChatServerRequest{ServerId: serverID, Username: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := client.GetUnreadSummary(bob, &pb.GetUnreadSummaryRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.GetUnreadCount() != 1 {
+		t.Fatalf("bob has %d unread messages, want 1", summary.GetUnreadCount())
+	}
+	if _, err := client.MarkRead(bob, &pb.MarkReadRequest{ServerId: serverID, ChannelId: channelID}); err != nil {
+		t.Fatal(err)
+	}
+	summary, err = client.GetUnreadSummary(bob, &pb.GetUnreadSummaryRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.GetUnreadCount() != 0 {
+		t.Fatalf("bob has %d unread messages after marking the channel read", summary.GetUnreadCount())
+	}
+}
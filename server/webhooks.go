@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	webhookTimeout      = flag.Duration("webhook-timeout", 10*time.Second, "How long a webhook endpoint has to answer a delivery")
+	webhookMaxAttempts  = flag.Int("webhook-max-attempts", 5, "How many times a webhook delivery is attempted before it is dead-lettered")
+	webhookRetryBackoff = flag.Duration("webhook-retry-backoff", time.Second, "Delay before the first webhook retry, doubled after every attempt")
+)
+
+const (
+	// maxWebhooksPerServer limits how many webhooks a chat server can have.
+	maxWebhooksPerServer = 20
+	// webhookHistory is how many recent deliveries and how many dead letters
+	// are kept per webhook.
+	webhookHistory = 100
+	// webhookWorkers limits how many deliveries are in flight at once.
+	webhookWorkers = 16
+	// webhookQueueSize is how many deliveries can wait for a webhook's
+	// worker. Deliveries beyond it are dead-lettered right away.
+	webhookQueueSize = 1000
+)
+
+// Event types sent to webhooks.
+const (
+	webhookMessageCreated = "message.created"
+	webhookMemberJoined   = "member.joined"
+	webhookMemberLeft     = "member.left"
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of
+// the timestamp, a dot and the body, keyed with the webhook secret.
+const (
+	webhookSignatureHeader = "X-Chat-Signature"
+	webhookTimestampHeader = "X-Chat-Timestamp"
+	webhookEventHeader     = "X-Chat-Event"
+	webhookDeliveryHeader  = "X-Chat-Delivery"
+)
+
+type storedWebhook struct {
+	info   *pb.Webhook
+	secret string
+	// deliveries holds the most recent deliveries, oldest first
+	deliveries []*pb.WebhookDelivery
+	// deadLetters holds the deliveries that ran out of attempts, oldest first
+	deadLetters []*pb.WebhookDelivery
+	// queue feeds the worker delivering to this webhook one delivery at a
+	// time, so the endpoint gets events in order
+	queue chan *pb.WebhookDelivery
+	// deleted is closed when the webhook is deleted to stop its worker
+	deleted chan struct{}
+}
+
+// webhookPayload is the JSON body of a delivery.
+type webhookPayload struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	ServerID  string          `json:"server_id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// webhookDispatcher delivers events to outgoing webhooks. It has its own lock
+// so events can be queued while s.mu is held.
+type webhookDispatcher struct {
+	mu     sync.Mutex
+	hooks  map[string]*storedWebhook
+	client *http.Client
+	// workers limits concurrent deliveries across webhooks
+	workers   chan struct{}
+	queueSize int
+}
+
+func newWebhookDispatcher() *webhookDispatcher {
+	return &webhookDispatcher{
+		hooks:     make(map[string]*storedWebhook),
+		client:    &http.Client{Timeout: *webhookTimeout},
+		workers:   make(chan struct{}, webhookWorkers),
+		queueSize: webhookQueueSize,
+	}
+}
+
+// add registers a webhook and starts its worker. The caller must hold d.mu.
+func (d *webhookDispatcher) add(hook *storedWebhook) {
+	hook.queue = make(chan *pb.WebhookDelivery, d.queueSize)
+	hook.deleted = make(chan struct{})
+	d.hooks[hook.info.GetId()] = hook
+	go d.work(hook)
+}
+
+// remove deletes a webhook and stops its worker, dropping the deliveries
+// still queued. The caller must hold d.mu.
+func (d *webhookDispatcher) remove(hook *storedWebhook) {
+	delete(d.hooks, hook.info.GetId())
+	close(hook.deleted)
+}
+
+// work delivers the queued deliveries of a webhook one after the other until
+// the webhook is deleted.
+func (d *webhookDispatcher) work(hook *storedWebhook) {
+	for {
+		select {
+		case <-hook.deleted:
+			return
+		case delivery := <-hook.queue:
+			d.deliver(hook, delivery)
+		}
+	}
+}
+
+// webhookEventType returns the webhook event type of an event and the
+// channel it happened in, or an empty type for events webhooks do not get.
+func webhookEventType(event *pb.Event) (string, string) {
+	switch p := event.GetPayload().(type) {
+	case *pb.Event_MessageCreated:
+		// Ephemeral messages are not meant for the channel
+		if p.MessageCreated.GetMessage().GetVisibleTo() != "" {
+			return "", ""
+		}
+		return webhookMessageCreated, p.MessageCreated.GetChannelId()
+	case *pb.Event_MemberJoined:
+		return webhookMemberJoined, ""
+	case *pb.Event_MemberLeft:
+		return webhookMemberLeft, ""
+	}
+	return "", ""
+}
+
+// enqueue queues an event for every webhook that wants it. It is called for
+// every event the hub publishes and does not block: when a webhook's queue
+// is full, because its endpoint is slow or down, the delivery is
+// dead-lettered instead.
+func (d *webhookDispatcher) enqueue(event *pb.Event) {
+	eventType, channelID := webhookEventType(event)
+	if eventType == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, hook := range d.hooks {
+		if hook.info.GetServerId() != event.GetServerId() {
+			continue
+		}
+		// Channel webhooks get the messages of their channel and every
+		// membership change
+		if hook.info.GetChannelId() != "" && channelID != "" && hook.info.GetChannelId() != channelID {
+			continue
+		}
+
+		delivery, err := newWebhookDelivery(hook.info.GetId(), eventType, event)
+		if err != nil {
+			continue
+		}
+		hook.deliveries = appendBounded(hook.deliveries, delivery)
+		select {
+		case hook.queue <- delivery:
+		default:
+			delivery.Status = pb.WebhookDelivery_FAILED
+			delivery.LastError = "delivery queue is full"
+			hook.deadLetters = appendBounded(hook.deadLetters, delivery)
+		}
+	}
+}
+
+func newWebhookDelivery(webhookID, eventType string, event *pb.Event) (*pb.WebhookDelivery, error) {
+	eventJSON, err := protojson.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	payload, err := json.Marshal(webhookPayload{
+		ID:        id,
+		Type:      eventType,
+		ServerID:  event.GetServerId(),
+		Timestamp: event.GetTimestamp().AsTime(),
+		Event:     eventJSON,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := timestamppb.Now()
+	return &pb.WebhookDelivery{
+		Id:        id,
+		WebhookId: webhookID,
+		EventType: eventType,
+		Payload:   string(payload),
+		Status:    pb.WebhookDelivery_PENDING,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// appendBounded appends a delivery and drops the oldest ones beyond
+// webhookHistory.
+func appendBounded(deliveries []*pb.WebhookDelivery, delivery *pb.WebhookDelivery) []*pb.WebhookDelivery {
+	deliveries = append(deliveries, delivery)
+	if len(deliveries) > webhookHistory {
+		deliveries = append([]*pb.WebhookDelivery(nil), deliveries[len(deliveries)-webhookHistory:]...)
+	}
+	return deliveries
+}
+
+// deliver attempts a delivery until it succeeds, fails permanently or runs
+// out of attempts, backing off exponentially between attempts. Later
+// deliveries to the webhook wait meanwhile.
+func (d *webhookDispatcher) deliver(hook *storedWebhook, delivery *pb.WebhookDelivery) {
+	backoff := *webhookRetryBackoff
+	for {
+		d.workers <- struct{}{}
+		code, err := d.post(hook, delivery)
+		<-d.workers
+
+		d.mu.Lock()
+		delivery.Attempts++
+		delivery.ResponseCode = int32(code)
+		delivery.UpdatedAt = timestamppb.Now()
+		if err == nil {
+			delivery.Status = pb.WebhookDelivery_DELIVERED
+			delivery.LastError = ""
+			d.mu.Unlock()
+			return
+		}
+		delivery.LastError = err.Error()
+		if !retryable(code) || int(delivery.Attempts) >= *webhookMaxAttempts {
+			delivery.Status = pb.WebhookDelivery_FAILED
+			hook.deadLetters = appendBounded(hook.deadLetters, delivery)
+			d.mu.Unlock()
+			return
+		}
+		d.mu.Unlock()
+
+		select {
+		case <-hook.deleted:
+			// Nobody is waiting for this anymore
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// retryable reports whether a delivery that got the HTTP status code may
+// succeed later. A code of 0 means the endpoint could not be reached.
+func retryable(code int) bool {
+	if code == http.StatusRequestTimeout || code == http.StatusTooManyRequests {
+		return true
+	}
+	return code < 400 || code >= 500
+}
+
+// post sends a delivery once and returns the HTTP status code it got.
+func (d *webhookDispatcher) post(hook *storedWebhook, delivery *pb.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.info.GetUrl(), bytes.NewBufferString(delivery.GetPayload()))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookEventHeader, delivery.GetEventType())
+	req.Header.Set(webhookDeliveryHeader, delivery.GetId())
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(hook.secret, timestamp, delivery.GetPayload()))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func signWebhook(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreateWebhook registers an outgoing webhook. Only admins may manage
+// webhooks.
+func (s *server) CreateWebhook(ctx context.Context, req *pb.CreateWebhookRequest) (*pb.CreateWebhookResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+
+	u, err := url.Parse(req.GetUrl())
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "webhook url must be an absolute http or https url")
+	}
+
+	secret, err := newSecret("whsec_")
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "failed to generate secret: %v", err)
+	}
+
+	if err := s.checkAdmin(req.GetServerId(), username, "webhooks"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	_, channelExists := s.channels[req.GetServerId()][req.GetChannelId()]
+	s.mu.Unlock()
+	if req.GetChannelId() != "" && !channelExists {
+		return nil, grpc.Errorf(codes.NotFound, "channel not found")
+	}
+
+	hook := &storedWebhook{
+		info: &pb.Webhook{
+			Id:        uuid.New().String(),
+			ServerId:  req.GetServerId(),
+			ChannelId: req.GetChannelId(),
+			Url:       u.String(),
+			CreatedBy: username,
+			CreatedAt: timestamppb.Now(),
+		},
+		secret: secret,
+	}
+
+	d := s.webhooks
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	count := 0
+	for _, other := range d.hooks {
+		if other.info.GetServerId() == req.GetServerId() {
+			count++
+		}
+	}
+	if count >= maxWebhooksPerServer {
+		return nil, grpc.Errorf(codes.ResourceExhausted, "a chat server can have at most %d webhooks", maxWebhooksPerServer)
+	}
+	d.add(hook)
+
+	return &pb.CreateWebhookResponse{Webhook: hook.info, Secret: hook.secret}, nil
+}
+
+func (s *server) ListWebhooks(ctx context.Context, req *pb.ListWebhooksRequest) (*pb.ListWebhooksResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if err := s.checkAdmin(req.GetServerId(), username, "webhooks"); err != nil {
+		return nil, err
+	}
+
+	d := s.webhooks
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var webhooks []*pb.Webhook
+	for _, hook := range d.hooks {
+		if hook.info.GetServerId() == req.GetServerId() {
+			webhooks = append(webhooks, hook.info)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].GetCreatedAt().AsTime().Before(webhooks[j].GetCreatedAt().AsTime())
+	})
+
+	return &pb.ListWebhooksResponse{Webhooks: webhooks}, nil
+}
+
+func (s *server) DeleteWebhook(ctx context.Context, req *pb.DeleteWebhookRequest) (*pb.DeleteWebhookResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if err := s.checkAdmin(req.GetServerId(), username, "webhooks"); err != nil {
+		return nil, err
+	}
+
+	d := s.webhooks
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hook, exists := d.hooks[req.GetWebhookId()]
+	if !exists || hook.info.GetServerId() != req.GetServerId() {
+		return nil, grpc.Errorf(codes.NotFound, "webhook not found")
+	}
+	d.remove(hook)
+
+	return &pb.DeleteWebhookResponse{}, nil
+}
+
+// ListWebhookDeliveries lists the recent deliveries of a webhook, or its dead
+// letters, newest first.
+func (s *server) ListWebhookDeliveries(ctx context.Context, req *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesResponse, error) {
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		return nil, grpc.Errorf(codes.Unauthenticated, "not authenticated")
+	}
+	if err := s.checkAdmin(req.GetServerId(), username, "webhooks"); err != nil {
+		return nil, err
+	}
+
+	d := s.webhooks
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hook, exists := d.hooks[req.GetWebhookId()]
+	if !exists || hook.info.GetServerId() != req.GetServerId() {
+		return nil, grpc.Errorf(codes.NotFound, "webhook not found")
+	}
+
+	deliveries := hook.deliveries
+	if req.GetDeadLetters() {
+		deliveries = hook.deadLetters
+	}
+	// Deliveries keep changing while they are retried, so copy them
+	resp := &pb.ListWebhookDeliveriesResponse{}
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		resp.Deliveries = append(resp.Deliveries, proto.Clone(deliveries[i]).(*pb.WebhookDelivery))
+	}
+	return resp, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+)
+
+// webhookEndpoint records the deliveries it receives and answers them with
+// the status codes returned by respond.
+type webhookEndpoint struct {
+	mu       sync.Mutex
+	received []webhookPayload
+	respond  func(attempt int) int
+	attempts int
+}
+
+func (e *webhookEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.attempts++
+	if code := e.respond(e.attempts); code != http.StatusOK {
+		w.WriteHeader(code)
+		return
+	}
+	var payload webhookPayload
+	json.Unmarshal(body, &payload)
+	e.received = append(e.received, payload)
+}
+
+// waitFor polls until the endpoint received n deliveries.
+func (e *webhookEndpoint) waitFor(t *testing.T, n int) []webhookPayload {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		e.mu.Lock()
+		received := append([]webhookPayload(nil), e.received...)
+		e.mu.Unlock()
+		if len(received) >= n {
+			return received
+		}
+	}
+	t.Fatalf("endpoint did not receive %d deliveries", n)
+	return nil
+}
+
+func TestWebhookDeliveriesArriveInOrder(t *testing.T) {
+	defer func(backoff time.Duration) { *webhookRetryBackoff = backoff }(*webhookRetryBackoff)
+	*webhookRetryBackoff = 10 * time.Millisecond
+
+	// The first message fails twice, which must not let later ones overtake
+	// it
+	endpoint := &webhookEndpoint{respond: func(attempt int) int {
+		if attempt <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}}
+	srv := httptest.NewServer(endpoint)
+	defer srv.Close()
+
+	_, client := startTestServer(t)
+	alice := login(t, client, "alice")
+	serverID, channelID := testChannel(t, client, alice)
+	hook, err := client.CreateWebhook(alice, &pb.CreateWebhookRequest{ServerId: serverID, ChannelId: channelID, Url: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	texts := []string{"one", "two", "three", "four", "five"}
+	for _, text := range texts {
+		if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: channelID, Text: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := endpoint.waitFor(t, len(texts))
+	for i, payload := range received {
+		if payload.Type != webhookMessageCreated || !strings.Contains(string(payload.Event), `"`+texts[i]+`"`) {
+			t.Fatalf("delivery %d = %s %s, want message %q", i, payload.Type, payload.Event, texts[i])
+		}
+	}
+
+	deliveries, err := client.ListWebhookDeliveries(alice, &pb.ListWebhookDeliveriesRequest{ServerId: serverID, WebhookId: hook.GetWebhook().GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := deliveries.GetDeliveries()[len(deliveries.GetDeliveries())-1]
+	if first.GetStatus() != pb.WebhookDelivery_DELIVERED || first.GetAttempts() != 3 {
+		t.Fatalf("first delivery = %v", first)
+	}
+}
+
+func TestWebhookQueueOverflowIsDeadLettered(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	d := newWebhookDispatcher()
+	d.queueSize = 1
+	hook := &storedWebhook{info: &pb.Webhook{Id: "hook", ServerId: "server", Url: srv.URL}}
+	d.mu.Lock()
+	d.add(hook)
+	d.mu.Unlock()
+
+	event := func() *pb.Event {
+		return &pb.Event{ServerId: "server", Payload: &pb.Event_MemberJoined{MemberJoined: &pb.MemberJoined{Username: "bob"}}}
+	}
+	// The first delivery is taken by the worker and hangs, the second one
+	// waits in the queue and the third one does not fit
+	d.enqueue(event())
+	time.Sleep(50 * time.Millisecond)
+	d.enqueue(event())
+	d.enqueue(event())
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(hook.deadLetters) != 1 || hook.deadLetters[0].GetStatus() != pb.WebhookDelivery_FAILED {
+		t.Fatalf("dead letters = %v", hook.deadLetters)
+	}
+	d.remove(hook)
+}
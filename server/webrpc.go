@@ -0,0 +1,575 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// maxWebMessage limits the size of a single gRPC-Web or Connect request
+// message, like the default receive limit of grpc-go.
+const maxWebMessage = 4 << 20
+
+// Flags of the five byte envelope in front of every message of a gRPC-Web or
+// Connect stream.
+const (
+	envelopeCompressed = 0x01
+	envelopeEndStream  = 0x02 // Connect end of stream
+	envelopeTrailer    = 0x80 // gRPC-Web trailers
+)
+
+// Wire protocols understood by webProxy.
+type webProtocol int
+
+const (
+	protocolGRPCWeb webProtocol = iota
+	protocolGRPCWebText
+	protocolConnectUnary
+	protocolConnectStream
+)
+
+// webMethods maps the paths of the ChatServer methods, such as
+// /pb.ChatServer/Login, to their descriptors.
+var webMethods = chatServerMethods()
+
+func chatServerMethods() map[string]protoreflect.MethodDescriptor {
+	service := pb.File_pb_app_proto.Services().ByName("ChatServer")
+	methods := make(map[string]protoreflect.MethodDescriptor)
+	for i := 0; i < service.Methods().Len(); i++ {
+		method := service.Methods().Get(i)
+		methods["/"+string(service.FullName())+"/"+string(method.Name())] = method
+	}
+	return methods
+}
+
+// webProxy serves gRPC-Web and the Connect protocol on the HTTP port. Calls
+// are translated and forwarded to the gRPC server through conn, so they go
+// through the same checks as any gRPC client. Native gRPC is served by the
+// gRPC server itself on the gRPC port.
+type webProxy struct {
+	conn grpc.ClientConnInterface
+}
+
+func (p *webProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Calls authenticate with metadata rather than cookies, so browsers on
+	// any origin may call the service
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "*")
+	}
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "POST")
+		w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+		w.Header().Set("Access-Control-Max-Age", "7200")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	call, ok := newWebCall(w, r.Header.Get("Content-Type"))
+	if !ok {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	method, ok := webMethods[r.URL.Path]
+	if !ok {
+		call.finish(nil, status.Errorf(codes.Unimplemented, "unknown method %s", r.URL.Path))
+		return
+	}
+	if call.protocol == protocolConnectUnary && (method.IsStreamingClient() || method.IsStreamingServer()) {
+		http.Error(w, "streaming methods need application/connect+proto or application/connect+json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err := call.checkEncoding(r.Header); err != nil {
+		call.finish(nil, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	timeout, err := call.timeout(r.Header)
+	if err != nil {
+		call.finish(nil, err)
+		return
+	}
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+	ctx = metadata.NewOutgoingContext(ctx, requestMetadata(r.Header))
+
+	// Client streams such as Chat keep reading the request body while the
+	// response is written
+	http.NewResponseController(w).EnableFullDuplex()
+
+	desc := &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+	stream, err := p.conn.NewStream(ctx, desc, r.URL.Path, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		call.finish(nil, err)
+		return
+	}
+
+	sendErr := make(chan error, 1)
+	go func() {
+		if err := call.forward(stream, r.Body, method.Input()); err != nil {
+			sendErr <- err
+			cancel()
+		}
+	}()
+
+	if header, err := stream.Header(); err == nil {
+		call.header = header
+	}
+	for {
+		var msg []byte
+		err := stream.RecvMsg(&msg)
+		if err == io.EOF {
+			call.finish(stream.Trailer(), nil)
+			return
+		}
+		if err != nil {
+			// A request that could not be forwarded explains the
+			// cancellation better than the stream does
+			select {
+			case err = <-sendErr:
+			default:
+			}
+			call.finish(stream.Trailer(), err)
+			return
+		}
+		if msg, err = call.encode(method.Output(), msg); err != nil {
+			cancel()
+			call.finish(nil, err)
+			return
+		}
+		if err := call.send(msg); err != nil {
+			return
+		}
+	}
+}
+
+// webCall is a single gRPC-Web or Connect call being forwarded.
+type webCall struct {
+	w           http.ResponseWriter
+	protocol    webProtocol
+	json        bool
+	contentType string
+
+	header      metadata.MD
+	wroteHeader bool
+	// unary holds the response of a Connect unary call, which is written
+	// together with the status.
+	unary []byte
+}
+
+// newWebCall picks the protocol of a call from its content type.
+func newWebCall(w http.ResponseWriter, contentType string) (*webCall, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	call := &webCall{w: w, contentType: mediaType}
+
+	base, codec, _ := strings.Cut(mediaType, "+")
+	switch base {
+	case "application/grpc-web":
+		call.protocol = protocolGRPCWeb
+	case "application/grpc-web-text":
+		call.protocol = protocolGRPCWebText
+	case "application/connect":
+		call.protocol = protocolConnectStream
+	case "application/proto":
+		call.protocol = protocolConnectUnary
+		return call, codec == ""
+	case "application/json":
+		call.protocol = protocolConnectUnary
+		call.json = true
+		return call, codec == ""
+	default:
+		return nil, false
+	}
+
+	switch codec {
+	case "":
+		if call.protocol == protocolConnectStream {
+			return nil, false
+		}
+	case "proto":
+	case "json":
+		call.json = true
+	default:
+		return nil, false
+	}
+	return call, true
+}
+
+// checkEncoding rejects compressed requests; every client can send
+// uncompressed messages.
+func (c *webCall) checkEncoding(header http.Header) error {
+	key := "Grpc-Encoding"
+	switch c.protocol {
+	case protocolConnectUnary:
+		key = "Content-Encoding"
+	case protocolConnectStream:
+		key = "Connect-Content-Encoding"
+	}
+	if encoding := header.Get(key); encoding != "" && encoding != "identity" {
+		return status.Errorf(codes.Unimplemented, "compression %q is not supported", encoding)
+	}
+	return nil
+}
+
+// timeout returns the deadline a client asked for, or 0 when there is none.
+func (c *webCall) timeout(header http.Header) (time.Duration, error) {
+	if c.protocol == protocolConnectUnary || c.protocol == protocolConnectStream {
+		value := header.Get("Connect-Timeout-Ms")
+		if value == "" {
+			return 0, nil
+		}
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || ms < 0 || len(value) > 10 {
+			return 0, status.Errorf(codes.InvalidArgument, "invalid Connect-Timeout-Ms %q", value)
+		}
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+
+	value := header.Get("Grpc-Timeout")
+	if value == "" {
+		return 0, nil
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[value[len(value)-1]]
+	n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if !ok || err != nil || n < 0 || len(value) > 9 {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid grpc-timeout %q", value)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// forward sends the request messages in body to stream and closes the send
+// side once the body ends.
+func (c *webCall) forward(stream grpc.ClientStream, body io.Reader, input protoreflect.MessageDescriptor) error {
+	if c.protocol == protocolConnectUnary {
+		data, err := io.ReadAll(io.LimitReader(body, maxWebMessage+1))
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to read request: %v", err)
+		}
+		if len(data) > maxWebMessage {
+			return status.Errorf(codes.ResourceExhausted, "request is larger than %d bytes", maxWebMessage)
+		}
+		if data, err = c.decode(input, data); err != nil {
+			return err
+		}
+		if err := stream.SendMsg(&data); err != nil {
+			// The status of the call is reported by RecvMsg
+			return nil
+		}
+		return stream.CloseSend()
+	}
+
+	if c.protocol == protocolGRPCWebText {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	for {
+		flags, data, err := readEnvelope(body)
+		if err == io.EOF {
+			return stream.CloseSend()
+		}
+		if err != nil {
+			return err
+		}
+		if flags&envelopeCompressed != 0 {
+			return status.Error(codes.Unimplemented, "compressed messages are not supported")
+		}
+		if data, err = c.decode(input, data); err != nil {
+			return err
+		}
+		if err := stream.SendMsg(&data); err != nil {
+			return nil
+		}
+	}
+}
+
+// readEnvelope reads one length-prefixed message of a stream.
+func readEnvelope(r io.Reader) (byte, []byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if err == io.EOF {
+			return 0, nil, io.EOF
+		}
+		return 0, nil, status.Errorf(codes.InvalidArgument, "failed to read message: %v", err)
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxWebMessage {
+		return 0, nil, status.Errorf(codes.ResourceExhausted, "message is larger than %d bytes", maxWebMessage)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, status.Errorf(codes.InvalidArgument, "failed to read message: %v", err)
+	}
+	return prefix[0], data, nil
+}
+
+// decode turns a request message into protobuf wire format.
+func (c *webCall) decode(input protoreflect.MessageDescriptor, data []byte) ([]byte, error) {
+	if !c.json {
+		return data, nil
+	}
+	msg, err := messageOf(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := gatewayUnmarshal.Unmarshal(data, msg); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid JSON message: %v", err)
+		}
+	}
+	return proto.Marshal(msg)
+}
+
+// encode turns a response message into the codec of the call.
+func (c *webCall) encode(output protoreflect.MessageDescriptor, data []byte) ([]byte, error) {
+	if !c.json {
+		return data, nil
+	}
+	msg, err := messageOf(output)
+	if err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to decode response: %v", err)
+	}
+	return marshalJSON(msg)
+}
+
+// messageOf returns an empty message of the generated type for desc.
+func messageOf(desc protoreflect.MessageDescriptor) (proto.Message, error) {
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unknown message %s", desc.FullName())
+	}
+	return messageType.New().Interface(), nil
+}
+
+func (c *webCall) writeHeader(code int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+
+	header := c.w.Header()
+	for key, values := range headerMetadata(c.header) {
+		header[http.CanonicalHeaderKey(key)] = values
+	}
+	header.Set("Content-Type", c.contentType)
+	c.w.WriteHeader(code)
+}
+
+// send writes a response message.
+func (c *webCall) send(msg []byte) error {
+	if c.protocol == protocolConnectUnary {
+		c.unary = msg
+		return nil
+	}
+	c.writeHeader(http.StatusOK)
+	return c.writeEnvelope(0, msg)
+}
+
+// finish ends the response with the status of the call and its trailers.
+func (c *webCall) finish(trailer metadata.MD, err error) {
+	st := status.Convert(err)
+
+	switch c.protocol {
+	case protocolConnectUnary:
+		for key, values := range headerMetadata(trailer) {
+			c.w.Header()[http.CanonicalHeaderKey("trailer-"+key)] = values
+		}
+		if st.Code() != codes.OK {
+			c.contentType = "application/json"
+			c.writeHeader(httpStatusFromCode(st.Code()))
+			json.NewEncoder(c.w).Encode(connectError(st))
+			return
+		}
+		c.writeHeader(http.StatusOK)
+		c.w.Write(c.unary)
+
+	case protocolConnectStream:
+		end := make(map[string]interface{})
+		if st.Code() != codes.OK {
+			end["error"] = connectError(st)
+		}
+		if values := headerMetadata(trailer); len(values) > 0 {
+			end["metadata"] = values
+		}
+		body, _ := json.Marshal(end)
+		c.writeHeader(http.StatusOK)
+		c.writeEnvelope(envelopeEndStream, body)
+
+	default:
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "grpc-status: %d\r\n", st.Code())
+		if st.Message() != "" {
+			fmt.Fprintf(&buf, "grpc-message: %s\r\n", encodeGRPCMessage(st.Message()))
+		}
+		for key, values := range headerMetadata(trailer) {
+			for _, value := range values {
+				fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+			}
+		}
+		c.writeHeader(http.StatusOK)
+		c.writeEnvelope(envelopeTrailer, buf.Bytes())
+	}
+}
+
+func (c *webCall) writeEnvelope(flags byte, data []byte) error {
+	frame := make([]byte, 5+len(data))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	copy(frame[5:], data)
+	if c.protocol == protocolGRPCWebText {
+		frame = []byte(base64.StdEncoding.EncodeToString(frame))
+	}
+
+	if _, err := c.w.Write(frame); err != nil {
+		return err
+	}
+	return http.NewResponseController(c.w).Flush()
+}
+
+// connectError is the JSON form of an error in the Connect protocol, such as
+// {"code": "not_found", "message": "..."}.
+func connectError(st *status.Status) map[string]string {
+	// Connect names codes like gRPC does, in snake case
+	var code strings.Builder
+	for i, r := range st.Code().String() {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				code.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		code.WriteRune(r)
+	}
+	return map[string]string{
+		"code":    code.String(),
+		"message": st.Message(),
+	}
+}
+
+// encodeGRPCMessage percent-encodes a status message for the grpc-message
+// trailer.
+func encodeGRPCMessage(msg string) string {
+	var buf strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c >= ' ' && c <= '~' && c != '%' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+// requestMetadata forwards the headers of a request as gRPC metadata,
+// leaving out those that belong to HTTP or to the protocols themselves.
+func requestMetadata(header http.Header) metadata.MD {
+	md := metadata.MD{}
+	for key, values := range header {
+		key = strings.ToLower(key)
+		if !forwardedHeader(key) {
+			continue
+		}
+		for _, value := range values {
+			if strings.HasSuffix(key, "-bin") {
+				decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+				if err != nil {
+					continue
+				}
+				value = string(decoded)
+			}
+			md.Append(key, value)
+		}
+	}
+	return md
+}
+
+func forwardedHeader(key string) bool {
+	switch key {
+	case "accept", "accept-encoding", "connection", "content-encoding", "content-length",
+		"content-type", "host", "http2-settings", "keep-alive", "origin", "proxy-connection",
+		"referer", "te", "trailer", "transfer-encoding", "upgrade", "user-agent",
+		"x-grpc-web", "x-user-agent":
+		return false
+	}
+	for _, prefix := range []string{"access-control-", "connect-", "grpc-", "sec-"} {
+		if strings.HasPrefix(key, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// headerMetadata converts gRPC metadata into header values, leaving out the
+// same keys as requestMetadata. Binary values are base64 encoded.
+func headerMetadata(md metadata.MD) map[string][]string {
+	values := make(map[string][]string)
+	for key, vs := range md {
+		if !forwardedHeader(key) || strings.HasPrefix(key, ":") {
+			continue
+		}
+		for _, v := range vs {
+			if strings.HasSuffix(key, "-bin") {
+				v = base64.RawStdEncoding.EncodeToString([]byte(v))
+			}
+			values[key] = append(values[key], v)
+		}
+	}
+	return values
+}
+
+// rawCodec passes messages that are already in protobuf wire format through
+// to the gRPC server and back.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
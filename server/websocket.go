@@ -0,0 +1,335 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// webSocketSchema is the JSON schema of the frames of the WebSocket bridge.
+//
+//go:embed websocket.schema.json
+var webSocketSchema []byte
+
+// Frame types of the WebSocket bridge.
+const (
+	wsAuth          = "auth"
+	wsAuthenticated = "authenticated"
+	wsSubscribe     = "subscribe"
+	wsUnsubscribe   = "unsubscribe"
+	wsMessage       = "message"
+	wsTyping        = "typing"
+	wsError         = "error"
+)
+
+// wsFrame is a frame of the WebSocket bridge. Apart from type, token and
+// error it mirrors pb.ChatMessage.
+type wsFrame struct {
+	Type  string `json:"type"`
+	Token string `json:"token,omitempty"`
+	Error string `json:"error,omitempty"`
+
+	ServerID      string     `json:"server_id,omitempty"`
+	ChannelID     string     `json:"channel_id,omitempty"`
+	Username      string     `json:"username,omitempty"`
+	Text          string     `json:"text,omitempty"`
+	Timestamp     *time.Time `json:"timestamp,omitempty"`
+	Typing        *bool      `json:"typing,omitempty"`
+	AttachmentIDs []string   `json:"attachment_ids,omitempty"`
+	TTLSeconds    int64      `json:"ttl_seconds,omitempty"`
+	VisibleTo     string     `json:"visible_to,omitempty"`
+	IsBot         bool       `json:"is_bot,omitempty"`
+}
+
+// wsFrameFromChat converts a frame of the Chat stream. Typing frames always
+// carry typing, so clients can tell a stopped indicator from a message.
+func wsFrameFromChat(msg *pb.ChatMessage, typing bool) wsFrame {
+	frame := wsFrame{
+		Type:          wsMessage,
+		ServerID:      msg.GetServerId(),
+		ChannelID:     msg.GetChannelId(),
+		Username:      msg.GetUsername(),
+		Text:          msg.GetText(),
+		AttachmentIDs: msg.GetAttachmentIds(),
+		TTLSeconds:    msg.GetTtlSeconds(),
+		VisibleTo:     msg.GetVisibleTo(),
+		IsBot:         msg.GetIsBot(),
+	}
+	if typing {
+		frame.Type = wsTyping
+		frame.Typing = proto.Bool(msg.GetTyping())
+	}
+	if msg.GetTimestamp() != nil {
+		t := msg.GetTimestamp().AsTime()
+		frame.Timestamp = &t
+	}
+	return frame
+}
+
+// webSocketHandler serves the WebSocket bridge, which gives browsers the live
+// chat of the Chat RPC. A client authenticates with ?token= or an auth frame,
+// subscribes to any number of channels and posts messages; events come from
+// the same hub as the Chat stream.
+func (s *server) webSocketHandler() http.Handler {
+	// Clients authenticate with a token rather than cookies, so any origin
+	// may connect
+	return websocket.Server{Handler: s.serveWebSocket}
+}
+
+// wsSession is a single WebSocket connection.
+type wsSession struct {
+	s        *server
+	conn     *websocket.Conn
+	username string
+
+	// writeMu serializes frames written to conn
+	writeMu sync.Mutex
+
+	mu   sync.Mutex
+	subs map[string]*wsSubscription
+}
+
+// wsSubscription follows the events of a chat server for the subscribed
+// channels in it.
+type wsSubscription struct {
+	events   chan *pb.Event
+	channels map[string]bool
+	done     chan struct{}
+}
+
+func (s *server) serveWebSocket(conn *websocket.Conn) {
+	defer conn.Close()
+
+	sess := &wsSession{
+		s:    s,
+		conn: conn,
+		subs: make(map[string]*wsSubscription),
+	}
+
+	token := conn.Request().URL.Query().Get("token")
+	if token == "" {
+		var frame wsFrame
+		if err := websocket.JSON.Receive(conn, &frame); err != nil {
+			return
+		}
+		if frame.Type != wsAuth {
+			sess.send(wsFrame{Type: wsError, Error: "the first frame must be an auth frame"})
+			return
+		}
+		token = frame.Token
+	}
+
+	ctx := metadata.NewIncomingContext(conn.Request().Context(), metadata.Pairs("authorization", token))
+	username, ok := s.userFromContext(ctx)
+	if !ok {
+		sess.send(wsFrame{Type: wsError, Error: "not authenticated"})
+		return
+	}
+	sess.username = username
+	defer s.trackStream(ctx)()
+	defer sess.unsubscribeAll()
+
+	if err := sess.send(wsFrame{Type: wsAuthenticated, Username: username}); err != nil {
+		return
+	}
+
+	for {
+		var frame wsFrame
+		if err := websocket.JSON.Receive(conn, &frame); err != nil {
+			return
+		}
+		if err := sess.handle(frame); err != nil {
+			if sess.send(wsFrame{Type: wsError, Error: status.Convert(err).Message(), ServerID: frame.ServerID, ChannelID: frame.ChannelID}) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (sess *wsSession) send(frame wsFrame) error {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+
+	return websocket.JSON.Send(sess.conn, frame)
+}
+
+// handle applies a frame sent by the client. Errors are reported back to the
+// client without closing the connection.
+func (sess *wsSession) handle(frame wsFrame) error {
+	s := sess.s
+
+	switch frame.Type {
+	case wsSubscribe:
+		if err := sess.checkMember(frame.ServerID); err != nil {
+			return err
+		}
+		sess.subscribe(frame.ServerID, frame.ChannelID)
+	case wsUnsubscribe:
+		sess.unsubscribe(frame.ServerID, frame.ChannelID)
+	case wsTyping:
+		if err := sess.checkMember(frame.ServerID); err != nil {
+			return err
+		}
+		if frame.Typing != nil && !*frame.Typing {
+			s.typing.stop(frame.ServerID, frame.ChannelID, sess.username)
+		} else {
+			s.typing.start(frame.ServerID, frame.ChannelID, sess.username)
+		}
+	case wsMessage:
+		if err := sess.checkMember(frame.ServerID); err != nil {
+			return err
+		}
+		if frame.Text == "" && len(frame.AttachmentIDs) == 0 {
+			return fmt.Errorf("messages need text or attachments")
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, exists := s.channels[frame.ServerID][frame.ChannelID]; !exists {
+			return fmt.Errorf("channel not found")
+		}
+		// Messages are always posted as the authenticated user
+		_, err := s.postMessage(newMessage{
+			serverID:      frame.ServerID,
+			channelID:     frame.ChannelID,
+			username:      sess.username,
+			text:          frame.Text,
+			attachmentIDs: frame.AttachmentIDs,
+			ttl:           time.Duration(frame.TTLSeconds) * time.Second,
+			visibleTo:     frame.VisibleTo,
+		})
+		return err
+	default:
+		return fmt.Errorf("unknown frame type %q", frame.Type)
+	}
+	return nil
+}
+
+func (sess *wsSession) checkMember(serverID string) error {
+	sess.s.mu.Lock()
+	defer sess.s.mu.Unlock()
+
+	if _, exists := sess.s.servers[serverID]; !exists {
+		return fmt.Errorf("chat server not found")
+	}
+	if !sess.s.isMember(serverID, sess.username) {
+		return fmt.Errorf("not a member of the chat server")
+	}
+	return nil
+}
+
+func (sess *wsSession) subscribe(serverID, channelID string) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	sub, ok := sess.subs[serverID]
+	if !ok {
+		sub = &wsSubscription{
+			events:   sess.s.hub.subscribe(serverID),
+			channels: make(map[string]bool),
+			done:     make(chan struct{}),
+		}
+		sess.subs[serverID] = sub
+		go sess.forward(serverID, sub)
+	}
+	sub.channels[channelID] = true
+}
+
+func (sess *wsSession) unsubscribe(serverID, channelID string) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	sub, ok := sess.subs[serverID]
+	if !ok {
+		return
+	}
+	delete(sub.channels, channelID)
+	if len(sub.channels) == 0 {
+		sess.s.hub.unsubscribe(serverID, sub.events)
+		close(sub.done)
+		delete(sess.subs, serverID)
+	}
+}
+
+func (sess *wsSession) unsubscribeAll() {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	for serverID, sub := range sess.subs {
+		sess.s.hub.unsubscribe(serverID, sub.events)
+		close(sub.done)
+	}
+	sess.subs = make(map[string]*wsSubscription)
+}
+
+// drop ends the subscription to a chat server the user is no longer a
+// member of.
+func (sess *wsSession) drop(serverID string, sub *wsSubscription) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.subs[serverID] != sub {
+		return
+	}
+	sess.s.hub.unsubscribe(serverID, sub.events)
+	close(sub.done)
+	delete(sess.subs, serverID)
+}
+
+// forward sends the events of a chat server to the client as frames for
+// every subscribed channel they belong to. The subscription ends when the
+// user leaves the chat server, and a channel is unsubscribed when it is
+// deleted; the client gets an error frame for either.
+func (sess *wsSession) forward(serverID string, sub *wsSubscription) {
+	for {
+		select {
+		case <-sub.done:
+			return
+		case event := <-sub.events:
+			if !visibleTo(event, sess.username) {
+				continue
+			}
+			if left := event.GetMemberLeft(); left != nil && left.GetUsername() == sess.username {
+				sess.drop(serverID, sub)
+				sess.send(wsFrame{Type: wsError, Error: "no longer a member of the chat server", ServerID: serverID})
+				return
+			}
+			if deleted := event.GetChannelDeleted(); deleted != nil {
+				sess.mu.Lock()
+				subscribed := sub.channels[deleted.GetChannelId()]
+				sess.mu.Unlock()
+				if subscribed {
+					sess.unsubscribe(serverID, deleted.GetChannelId())
+					if sess.send(wsFrame{Type: wsError, Error: "channel deleted", ServerID: serverID, ChannelID: deleted.GetChannelId()}) != nil {
+						return
+					}
+				}
+				continue
+			}
+
+			_, typing := event.GetPayload().(*pb.Event_Typing)
+			sess.mu.Lock()
+			var frames []*pb.ChatMessage
+			for channelID := range sub.channels {
+				if frame := chatFrame(event, channelID); frame != nil {
+					frames = append(frames, frame)
+				}
+			}
+			sess.mu.Unlock()
+
+			for _, frame := range frames {
+				if err := sess.send(wsFrameFromChat(frame, typing)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/Melo04/grpc-chat/pb"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/metadata"
+)
+
+// dialWebSocket connects to the WebSocket bridge as the user with the token.
+func dialWebSocket(t *testing.T, url, token string) *websocket.Conn {
+	t.Helper()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws?token="+token, "", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var frame wsFrame
+	if err := websocket.JSON.Receive(conn, &frame); err != nil || frame.Type != wsAuthenticated {
+		t.Fatalf("got frame %v, error %v, want authenticated", frame, err)
+	}
+	return conn
+}
+
+// receiveFrame returns the next frame, or fails the test if none arrives.
+func receiveFrame(t *testing.T, conn *websocket.Conn) wsFrame {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var frame wsFrame
+	if err := websocket.JSON.Receive(conn, &frame); err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestWebSocketSubscriptionsEnd(t *testing.T) {
+	s, client := startTestServer(t)
+	srv := httptest.NewServer(s.httpHandler(dialTestServer(t, s)))
+	t.Cleanup(srv.Close)
+
+	alice := login(t, client, "alice")
+	res, err := client.Login(context.Background(), &pb.LoginRequest{Username: "bob", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverID, channelID := testChannel(t, client, alice)
+	other, err := client.CreateChannel(alice, &pb.CreateChannelRequest{ServerId: serverID, ChannelName: "random"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := metadata.AppendToOutgoingContext(context.Background(), "authorization", res.GetToken())
+	if _, err := client.JoinChatServer(bob, &pb.JoinChatServerRequest{ServerId: serverID}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := dialWebSocket(t, srv.URL, res.GetToken())
+	for _, channel := range []string{channelID, other.GetChannelId()} {
+		if err := websocket.JSON.Send(conn, wsFrame{Type: wsSubscribe, ServerID: serverID, ChannelID: channel}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Wait until the server has subscribed the connection
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := client.DeleteChannel(alice, &pb.DeleteChannelRequest{ServerId: serverID, ChannelId: channelID}); err != nil {
+		t.Fatal(err)
+	}
+	if frame := receiveFrame(t, conn); frame.Type != wsError || frame.ChannelID != channelID {
+		t.Fatalf("got %v, want an error frame for the deleted channel", frame)
+	}
+
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: other.GetChannelId(), Text: "/kick bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if frame := receiveFrame(t, conn); frame.Type != wsError || frame.ServerID != serverID || frame.ChannelID != "" {
+		t.Fatalf("got %v, want an error frame for the chat server", frame)
+	}
+	if err := send(alice, client, &pb.SendMessageRequest{ServerId: serverID, ChannelId: other.GetChannelId(), Text: "bob is gone"}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var frame wsFrame
+	if err := websocket.JSON.Receive(conn, &frame); err == nil {
+		t.Fatalf("got %v after bob was kicked", frame)
+	}
+}